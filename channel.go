@@ -20,6 +20,7 @@ type ChannelImpl struct {
 	readwait  time.Duration
 	gpool     *ants.Pool
 	state     int32 // 0 init 1 started 2 closed
+	createdAt time.Time
 	lg        *zap.Logger
 }
 
@@ -43,6 +44,11 @@ func (ch *ChannelImpl) ID() string {
 	return ch.id
 }
 
+// CreatedAt returns the time when the channel is created
+func (ch *ChannelImpl) CreatedAt() time.Time {
+	return ch.createdAt
+}
+
 // Push implements Channel
 // 异步写入消息
 func (ch *ChannelImpl) Push(payload []byte) error {
@@ -122,6 +128,7 @@ func NewChannel(id string, meta Meta, conn Conn, gpool *ants.Pool, logger *zap.L
 		readwait:  DefaultReadwait,
 		gpool:     gpool,
 		state:     0,
+		createdAt: time.Now(),
 		lg:        logger,
 	}
 
@@ -0,0 +1,269 @@
+package container
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// AdminInfo returns a snapshot of a config shown by the admin api, such as the route of the gateway
+type AdminInfo func() any
+
+type channelInfo struct {
+	ID   string            `json:"id"`
+	Meta map[string]string `json:"meta"`
+	Age  string            `json:"age,omitempty"`
+}
+
+type clientInfo struct {
+	ID    string            `json:"id"`
+	State string            `json:"state"`
+	Meta  map[string]string `json:"meta"`
+	Conns int               `json:"conns"`
+	Size  int               `json:"size"`
+}
+
+type depInfo struct {
+	Service  string `json:"service"`
+	Warmup   string `json:"warmup"`
+	PoolSize int    `json:"pool_size"`
+	Clients  int    `json:"clients"`
+	Adults   int    `json:"adults"`
+}
+
+// channelLister is implemented by qim.DefaultServer
+type channelLister interface {
+	Channels() []qim.Channel
+}
+
+// SetAdminToken enables the admin actions guarded by the token, they are disabled if the token is empty
+func (c *Container) SetAdminToken(token string) {
+	c.adminToken = token
+}
+
+// AddAdminInfo adds a config shown in /admin/config
+func (c *Container) AddAdminInfo(name string, info AdminInfo) {
+	c.Lock()
+	defer c.Unlock()
+	c.adminInfos[name] = info
+}
+
+func (c *Container) monitorHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", c.handleLive)
+	mux.HandleFunc("/live", c.handleLive)
+	mux.HandleFunc("/ready", c.handleReady)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	mux.HandleFunc("/admin/channels", c.handleChannels)
+	mux.HandleFunc("/admin/clients", c.handleClients)
+	mux.HandleFunc("/admin/deps", c.handleDeps)
+	mux.HandleFunc("/admin/config", c.handleConfig)
+	mux.HandleFunc("/admin/channels/close", c.guard(http.MethodPost, c.handleCloseChannel))
+	mux.HandleFunc("/admin/deregister", c.guard(http.MethodPost, c.handleDeregister))
+	mux.HandleFunc("/admin/reload", c.guard(http.MethodPost, c.handleReload))
+	mux.HandleFunc("/admin/drain", c.guard(http.MethodPost, c.handleDrain))
+
+	mux.HandleFunc("/debug/pprof/", c.guard(http.MethodGet, pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", c.guard(http.MethodGet, pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", c.guard(http.MethodGet, pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", c.guard(http.MethodGet, pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", c.guard(http.MethodGet, pprof.Trace))
+	return mux
+}
+
+// guard allows the request only if it carries the admin token
+func (c *Container) guard(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.Header.Get("Authorization")
+		if c.adminToken == "" ||
+			subtle.ConstantTimeCompare([]byte(token), []byte("Bearer "+c.adminToken)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		c.lg.Info("admin action", zap.String("path", r.URL.Path), zap.String("remote", r.RemoteAddr))
+		next(w, r)
+	}
+}
+
+func (c *Container) handleLive(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("ok"))
+}
+
+// handleReady reports ready if the container is started and every dep has an adult client
+func (c *Container) handleReady(w http.ResponseWriter, r *http.Request) {
+	reasons := make([]string, 0)
+	if atomic.LoadUint32(&c.state) != stateStarted {
+		reasons = append(reasons, "container is not started")
+	}
+	if c.isDraining() {
+		reasons = append(reasons, "container is draining")
+	}
+	for _, dep := range c.depInfos() {
+		if dep.Adults == 0 {
+			reasons = append(reasons, "no service available: "+dep.Service)
+		}
+	}
+	if len(reasons) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"ready": false, "reasons": reasons})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ready": true})
+}
+
+func (c *Container) handleChannels(w http.ResponseWriter, r *http.Request) {
+	lister, ok := c.Srv.(channelLister)
+	if !ok {
+		http.Error(w, "channels are not supported by the server", http.StatusNotImplemented)
+		return
+	}
+	now := time.Now()
+	list := make([]channelInfo, 0)
+	for _, ch := range lister.Channels() {
+		info := channelInfo{
+			ID:   ch.ID(),
+			Meta: ch.GetMeta(),
+		}
+		if aged, ok := ch.(interface{ CreatedAt() time.Time }); ok {
+			info.Age = now.Sub(aged.CreatedAt()).Truncate(time.Second).String()
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (c *Container) handleClients(w http.ResponseWriter, r *http.Request) {
+	res := make(map[string][]clientInfo)
+	for service, clients := range c.clientMaps() {
+		list := make([]clientInfo, 0)
+		for _, srv := range clients.Services() {
+			info := clientInfo{
+				ID:    srv.ServiceID(),
+				State: srv.GetMeta()[KeyServiceState],
+				Meta:  srv.GetMeta(),
+				Conns: 1,
+				Size:  1,
+			}
+			if pool, ok := srv.(*ClientPool); ok {
+				info.Conns = pool.Live()
+				info.Size = pool.Size()
+			}
+			list = append(list, info)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		res[service] = list
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (c *Container) handleDeps(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.depInfos())
+}
+
+func (c *Container) handleConfig(w http.ResponseWriter, r *http.Request) {
+	c.RLock()
+	res := make(map[string]any, len(c.adminInfos))
+	for name, info := range c.adminInfos {
+		res[name] = info()
+	}
+	c.RUnlock()
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (c *Container) handleCloseChannel(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	lister, ok := c.Srv.(channelLister)
+	if !ok {
+		http.Error(w, "channels are not supported by the server", http.StatusNotImplemented)
+		return
+	}
+	for _, ch := range lister.Channels() {
+		if ch.ID() != id {
+			continue
+		}
+		if err := ch.Close(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"closed": id})
+		return
+	}
+	http.Error(w, "channel not found", http.StatusNotFound)
+}
+
+func (c *Container) handleDeregister(w http.ResponseWriter, r *http.Request) {
+	if c.Naming == nil {
+		http.Error(w, "naming is nil", http.StatusInternalServerError)
+		return
+	}
+	if err := c.Naming.Deregister(c.Srv.ServiceID()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"deregistered": c.Srv.ServiceID()})
+}
+
+func (c *Container) handleReload(w http.ResponseWriter, r *http.Request) {
+	if err := c.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"reloaded": true})
+}
+
+func (c *Container) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if err := c.Drain(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"draining": c.Srv.ServiceID()})
+}
+
+func (c *Container) clientMaps() map[string]ClientMap {
+	c.RLock()
+	defer c.RUnlock()
+	res := make(map[string]ClientMap, len(c.srvclients))
+	for service, clients := range c.srvclients {
+		res[service] = clients
+	}
+	return res
+}
+
+func (c *Container) depInfos() []depInfo {
+	clientMaps := c.clientMaps()
+	list := make([]depInfo, 0, len(c.deps))
+	for dep := range c.deps {
+		opts := c.depOptions(dep)
+		info := depInfo{
+			Service:  dep,
+			Warmup:   opts.Warmup.String(),
+			PoolSize: opts.PoolSize,
+		}
+		if clients, ok := clientMaps[dep]; ok {
+			info.Clients = len(clients.Services())
+			info.Adults = len(clients.Services(KeyServiceState, StateAdult))
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Service < list[j].Service })
+	return list
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,91 @@
+package container
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/wire"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type channelServer struct {
+	*qim.MockServer
+	channels []qim.Channel
+}
+
+func (s *channelServer) Channels() []qim.Channel {
+	return s.channels
+}
+
+func TestAdmin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	ch := qim.NewMockChannel(ctrl)
+	ch.EXPECT().ID().AnyTimes().Return("ch1")
+	ch.EXPECT().GetMeta().AnyTimes().Return(qim.Meta{"account": "test1"})
+	ch.EXPECT().Close().Times(1).Return(nil)
+
+	srv := &channelServer{MockServer: qim.NewMockServer(ctrl), channels: []qim.Channel{ch}}
+	srv.EXPECT().ServiceID().AnyTimes().Return("gateway1")
+
+	c := New(srv, zap.NewNop(), wire.SNChat)
+	c.AddAdminInfo("route", func() any { return map[string]string{"route_by": "app"} })
+	handler := c.monitorHandler()
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/live", "").Code)
+	// not started and no chat service
+	assert.Equal(t, http.StatusServiceUnavailable, do(http.MethodGet, "/ready", "").Code)
+
+	cli := qim.NewMockClient(ctrl)
+	cli.EXPECT().ServiceID().AnyTimes().Return("chat1")
+	cli.EXPECT().GetMeta().AnyTimes().Return(map[string]string{KeyServiceState: StateAdult})
+	clients := NewClients(1)
+	clients.Add(cli)
+	c.srvclients[wire.SNChat] = clients
+	c.state = stateStarted
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/ready", "").Code)
+
+	var channels []channelInfo
+	w := do(http.MethodGet, "/admin/channels", "")
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &channels))
+	assert.Equal(t, "ch1", channels[0].ID)
+	assert.Equal(t, "test1", channels[0].Meta["account"])
+
+	var deps []depInfo
+	w = do(http.MethodGet, "/admin/deps", "")
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &deps))
+	assert.Equal(t, []depInfo{{Service: wire.SNChat, Warmup: DefaultWarmup.String(), PoolSize: DefaultPoolSize, Clients: 1, Adults: 1}}, deps)
+
+	var clientInfos map[string][]clientInfo
+	w = do(http.MethodGet, "/admin/clients", "")
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &clientInfos))
+	assert.Equal(t, StateAdult, clientInfos[wire.SNChat][0].State)
+
+	w = do(http.MethodGet, "/admin/config", "")
+	assert.Contains(t, w.Body.String(), "route_by")
+
+	// the actions are disabled without a token
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/admin/channels/close?id=ch1", "").Code)
+	c.SetAdminToken("secret")
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/admin/channels/close?id=ch1", "wrong").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/debug/pprof/", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodGet, "/admin/channels/close?id=ch1", "secret").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/admin/channels/close?id=ch2", "secret").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/admin/channels/close?id=ch1", "secret").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/debug/pprof/", "secret").Code)
+}
@@ -0,0 +1,154 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+	"go.uber.org/zap"
+)
+
+// DefaultCallTimeout is the deadline of a call if the context has none
+const DefaultCallTimeout = time.Second * 5
+
+var ErrContainerClosed = errors.New("container closed")
+
+var ErrNotReady = errors.New("service is not ready")
+
+// pendingCalls are the calls waiting for their responses, keyed by sequence
+type pendingCalls struct {
+	sync.Mutex
+	calls map[uint32]*pendingCall
+}
+
+type pendingCall struct {
+	channel string
+	resp    chan *pkt.LogicPkt
+}
+
+func newPendingCalls() *pendingCalls {
+	return &pendingCalls{
+		calls: make(map[uint32]*pendingCall),
+	}
+}
+
+func (p *pendingCalls) add(seq uint32, channel string) *pendingCall {
+	call := &pendingCall{
+		channel: channel,
+		resp:    make(chan *pkt.LogicPkt, 1),
+	}
+	p.Lock()
+	p.calls[seq] = call
+	p.Unlock()
+	return call
+}
+
+func (p *pendingCalls) remove(seq uint32) {
+	p.Lock()
+	delete(p.calls, seq)
+	p.Unlock()
+}
+
+// deliver returns true if the packet is the response of a pending call
+func (p *pendingCalls) deliver(packet *pkt.LogicPkt) bool {
+	if packet.Flag != pkt.Flag_Response {
+		return false
+	}
+	p.Lock()
+	call, ok := p.calls[packet.Sequence]
+	if ok && call.channel == packet.ChannelId {
+		delete(p.calls, packet.Sequence)
+	} else {
+		ok = false
+	}
+	p.Unlock()
+	if ok {
+		call.resp <- packet
+	}
+	return ok
+}
+
+// Call sends a request to the service and waits for its response, the request is
+// correlated with the response by sequence. The status of the response is not
+// checked, a non-nil error means that no response is received before the deadline.
+func Call(ctx context.Context, serviceName string, packet *pkt.LogicPkt) (*pkt.LogicPkt, error) {
+	return defaultContainer.Call(ctx, serviceName, packet)
+}
+
+func (c *Container) Call(ctx context.Context, serviceName string, packet *pkt.LogicPkt) (*pkt.LogicPkt, error) {
+	if packet == nil {
+		return nil, errors.New("packet is nil")
+	}
+	if packet.Command == "" {
+		return nil, errors.New("command is empty in packet")
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultCallTimeout)
+		defer cancel()
+	}
+
+	// the response is sent back to the channel of this server
+	packet.ChannelId = c.Srv.ServiceID()
+	packet.Sequence = wire.Seq.Next()
+	packet.Flag = pkt.Flag_Request
+	packet.AddStringMeta(wire.MetaCallFrom, c.Srv.ServiceID())
+
+	start := time.Now()
+	call := c.calls.add(packet.Sequence, packet.ChannelId)
+	defer c.calls.remove(packet.Sequence)
+
+	if err := c.ForwardWithSelector(serviceName, packet, c.seletor); err != nil {
+		callTotal.WithLabelValues(serviceName, "error").Inc()
+		return nil, err
+	}
+
+	select {
+	case resp := <-call.resp:
+		callTotal.WithLabelValues(serviceName, "ok").Inc()
+		callDurationSeconds.WithLabelValues(serviceName).Observe(time.Since(start).Seconds())
+		return resp, nil
+	case <-ctx.Done():
+		callTotal.WithLabelValues(serviceName, "timeout").Inc()
+		c.lg.Warn("call timeout", zap.String("service", serviceName),
+			zap.String("command", packet.Command), zap.Uint32("seq", packet.Sequence))
+		return nil, ctx.Err()
+	case <-c.closed:
+		callTotal.WithLabelValues(serviceName, "error").Inc()
+		return nil, ErrContainerClosed
+	}
+}
+
+// Ping sends wire.CommandInnerPing over the client and waits for its response, the service
+// behind the client is ready if the response is Success. It is a ReadinessCheck.
+func Ping(ctx context.Context, cli Client) error {
+	return defaultContainer.Ping(ctx, cli)
+}
+
+func (c *Container) Ping(ctx context.Context, cli Client) error {
+	packet := pkt.New(wire.CommandInnerPing, pkt.WithChannel(c.Srv.ServiceID()), pkt.WithSeq(wire.Seq.Next()))
+	packet.AddStringMeta(wire.MetaCallFrom, c.Srv.ServiceID())
+	packet.AddStringMeta(wire.MetaDestServer, c.Srv.ServiceID())
+
+	call := c.calls.add(packet.Sequence, packet.ChannelId)
+	defer c.calls.remove(packet.Sequence)
+
+	if err := cli.Send(pkt.Marshal(packet)); err != nil {
+		return err
+	}
+	select {
+	case resp := <-call.resp:
+		if resp.Status != pkt.Status_Success {
+			return fmt.Errorf("%w: %s", ErrNotReady, resp.Status)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return ErrContainerClosed
+	}
+}
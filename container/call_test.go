@@ -0,0 +1,132 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/tcp"
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCall(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	srv := qim.NewMockServer(ctrl)
+	srv.EXPECT().ServiceID().AnyTimes().Return("chat1")
+
+	frames := make(chan qim.Frame, 10)
+	cli := qim.NewMockClient(ctrl)
+	cli.EXPECT().ServiceID().AnyTimes().Return("login1")
+	cli.EXPECT().ServiceName().AnyTimes().Return(wire.SNLogin)
+	cli.EXPECT().GetMeta().AnyTimes().Return(map[string]string{KeyServiceState: StateAdult})
+	cli.EXPECT().Read().AnyTimes().DoAndReturn(func() (qim.Frame, error) {
+		frame, ok := <-frames
+		if !ok {
+			return nil, io.EOF
+		}
+		return frame, nil
+	})
+	// the service responds to the requests but the ones of CommandLoginSignOut
+	cli.EXPECT().Send(gomock.Any()).AnyTimes().DoAndReturn(func(payload []byte) error {
+		req, err := pkt.MustReadLogicPkt(bytes.NewBuffer(payload))
+		if err != nil {
+			return err
+		}
+		if req.Command == wire.CommandLoginSignOut {
+			return nil
+		}
+		from, _ := req.GetMeta(wire.MetaCallFrom)
+		assert.Equal(t, "chat1", from)
+
+		resp := pkt.NewFrom(&req.Header)
+		resp.Flag = pkt.Flag_Response
+		resp.WriteBody(&pkt.ErrorResp{Message: "pong"})
+		resp.AddStringMeta(wire.MetaDestServer, "chat1")
+		resp.AddStringMeta(wire.MetaDestChannels, req.ChannelId)
+		frames <- &tcp.Frame{OpCode: qim.OpBinary, Payload: pkt.Marshal(resp)}
+		return nil
+	})
+
+	c := New(srv, zap.NewNop(), wire.SNLogin)
+	clients := NewClients(1)
+	clients.Add(cli)
+	c.srvclients[wire.SNLogin] = clients
+	go func() {
+		_ = c.readloop(cli)
+	}()
+	defer close(frames)
+
+	resp, err := c.Call(context.Background(), wire.SNLogin, pkt.New(wire.CommandLoginSignIn))
+	assert.Nil(t, err)
+	assert.Equal(t, pkt.Flag_Response, resp.Flag)
+	var body pkt.ErrorResp
+	assert.Nil(t, resp.ReadBody(&body))
+	assert.Equal(t, "pong", body.Message)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err = c.Call(ctx, wire.SNLogin, pkt.New(wire.CommandLoginSignOut))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Empty(t, c.calls.calls)
+
+	_, err = c.Call(context.Background(), wire.SNChat, pkt.New(wire.CommandLoginSignIn))
+	assert.Error(t, err)
+}
+
+func TestPing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	srv := qim.NewMockServer(ctrl)
+	srv.EXPECT().ServiceID().AnyTimes().Return("gateway1")
+
+	status := pkt.Status_SystemException
+	frames := make(chan qim.Frame, 10)
+	cli := qim.NewMockClient(ctrl)
+	cli.EXPECT().ServiceID().AnyTimes().Return("chat1")
+	cli.EXPECT().ServiceName().AnyTimes().Return(wire.SNChat)
+	cli.EXPECT().Read().AnyTimes().DoAndReturn(func() (qim.Frame, error) {
+		frame, ok := <-frames
+		if !ok {
+			return nil, io.EOF
+		}
+		return frame, nil
+	})
+	cli.EXPECT().Send(gomock.Any()).AnyTimes().DoAndReturn(func(payload []byte) error {
+		req, err := pkt.MustReadLogicPkt(bytes.NewBuffer(payload))
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, wire.CommandInnerPing, req.Command)
+		assert.Equal(t, "gateway1", req.ChannelId)
+
+		resp := pkt.NewFrom(&req.Header)
+		resp.Flag = pkt.Flag_Response
+		resp.Status = status
+		resp.AddStringMeta(wire.MetaDestServer, "gateway1")
+		resp.AddStringMeta(wire.MetaDestChannels, req.ChannelId)
+		frames <- &tcp.Frame{OpCode: qim.OpBinary, Payload: pkt.Marshal(resp)}
+		return nil
+	})
+
+	c := New(srv, zap.NewNop(), wire.SNChat)
+	go func() {
+		_ = c.readloop(cli)
+	}()
+	defer close(frames)
+
+	err := c.Ping(context.Background(), cli)
+	assert.True(t, errors.Is(err, ErrNotReady))
+
+	status = pkt.Status_Success
+	assert.Nil(t, c.Ping(context.Background(), cli))
+	assert.Empty(t, c.calls.calls)
+}
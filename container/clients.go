@@ -4,13 +4,14 @@ import (
 	"sync"
 
 	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/logger"
 	"go.uber.org/zap"
 )
 
 type ClientMap interface {
-	Add(client qim.Client)
+	Add(client Client)
 	Remove(id string)
-	Get(id string) (qim.Client, bool)
+	Get(id string) (Client, bool)
 	Services(kvs ...string) []qim.Service
 }
 
@@ -19,25 +20,25 @@ type ClientsImpl struct {
 }
 
 // Add implements ClientMap
-func (ch *ClientsImpl) Add(client qim.Client) {
+func (ch *ClientsImpl) Add(client Client) {
 	if client.ServiceID() == "" {
-		c.lg.Error("client id is required", zap.String("module", "ClientsImpl"))
+		logger.L.Error("client id is required", zap.String("module", "ClientsImpl"))
 	}
 
 	ch.clients.Store(client.ServiceID(), client)
 }
 
 // Get implements ClientMap
-func (ch *ClientsImpl) Get(id string) (qim.Client, bool) {
+func (ch *ClientsImpl) Get(id string) (Client, bool) {
 	if id == "" {
-		c.lg.Error("client id is required", zap.String("module", "ClientsImpl"))
+		logger.L.Error("client id is required", zap.String("module", "ClientsImpl"))
 	}
 
 	val, ok := ch.clients.Load(id)
 	if !ok {
 		return nil, false
 	}
-	return val.(qim.Client), true
+	return val.(Client), true
 }
 
 // Remove implements ClientMap
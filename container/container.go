@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -17,10 +18,14 @@ import (
 	"github.com/joeyscat/qim"
 	"github.com/joeyscat/qim/naming"
 	"github.com/joeyscat/qim/tcp"
+	"github.com/joeyscat/qim/tracing"
 	"github.com/joeyscat/qim/wire"
 	"github.com/joeyscat/qim/wire/pkt"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
 )
 
 const (
@@ -37,38 +42,187 @@ const (
 
 const (
 	KeyServiceState = "service_state"
+	// KeyServiceAdultAt is the time in unix nano when a service grown up
+	KeyServiceAdultAt = "service_adult_at"
 )
 
+const (
+	// DefaultWarmup is the warm-up period of a newly discovered service
+	DefaultWarmup = time.Second * 10
+
+	readinessInterval = time.Second
+	readinessTimeout  = time.Second * 3
+
+	reconnectBackoff    = time.Second
+	maxReconnectBackoff = time.Second * 10
+	maxReconnects       = 3
+)
+
+// ReadinessCheck returns nil if the service behind the client is ready to receive messages
+type ReadinessCheck func(ctx context.Context, cli Client) error
+
+// DepOptions controls how a newly discovered service of a dep grows up
+type DepOptions struct {
+	// Warmup is the period before a new service receives messages
+	Warmup time.Duration
+	// Readiness is checked after the warm-up until it passes, optional
+	Readiness ReadinessCheck
+	// PoolSize is the connections to each service
+	PoolSize int
+}
+
 type Container struct {
 	sync.RWMutex
-	Naming     naming.Naming
-	Srv        qim.Server
-	state      uint32
-	srvclients map[string]ClientMap
-	seletor    Selector
-	dialer     qim.Dialer
-	deps       map[string]struct{}
-	monitor    sync.Once
-	lg         *zap.Logger
+	Naming       naming.Naming
+	Srv          qim.Server
+	state        uint32
+	srvclients   map[string]ClientMap
+	seletor      Selector
+	dialer       qim.Dialer
+	deps         map[string]struct{}
+	depOpts      map[string]DepOptions
+	failover     FailoverOptions
+	budget       *retryBudget
+	outliers     *outlierDetector
+	monitor      sync.Once
+	adminToken   string
+	adminInfos   map[string]AdminInfo
+	reloaders    []reloader
+	calls        *pendingCalls
+	loadInterval time.Duration
+	drainOpts    DrainOptions
+	draining     int32
+	closed       chan struct{}
+	lg           *zap.Logger
 }
 
 // Default Container
-var c = &Container{
-	state:   0,
-	seletor: &HashSelector{},
-	deps:    map[string]struct{}{},
+var defaultContainer = newContainer()
+
+func newContainer() *Container {
+	c := &Container{
+		state:      stateUninitialized,
+		seletor:    &HashSelector{},
+		deps:       map[string]struct{}{},
+		depOpts:    map[string]DepOptions{},
+		adminInfos: map[string]AdminInfo{},
+		calls:      newPendingCalls(),
+		closed:     make(chan struct{}),
+	}
+	c.SetFailover(DefaultFailoverOptions())
+	c.SetDrain(DefaultDrainOptions())
+	return c
 }
 
 func Default() *Container {
+	return defaultContainer
+}
+
+// New creates a Container with a Server and its deps,
+// so that several servers can run in one process.
+func New(srv qim.Server, lg *zap.Logger, deps ...string) *Container {
+	c := newContainer()
+	_ = c.Init(srv, lg, deps...)
 	return c
 }
 
-// init container with a Server, and its deps
+// init the default container with a Server, and its deps
 //
 // For example, in the gateway, it depends on the login and chat services,
 // and it will cal the function like this:
 // _ = container.Init(srv, wire.SNChat, wire.SNLogin)
 func Init(srv qim.Server, lg *zap.Logger, deps ...string) error {
+	return defaultContainer.Init(srv, lg, deps...)
+}
+
+func SetDialer(dialer qim.Dialer) {
+	defaultContainer.SetDialer(dialer)
+}
+
+func SetSelector(selector Selector) {
+	defaultContainer.SetSelector(selector)
+}
+
+func SetServiceNaming(nm naming.Naming) {
+	defaultContainer.SetServiceNaming(nm)
+}
+
+func SetFailover(opts FailoverOptions) {
+	defaultContainer.SetFailover(opts)
+}
+
+func SetWarmup(service string, warmup time.Duration) {
+	defaultContainer.SetWarmup(service, warmup)
+}
+
+func SetPoolSize(service string, size int) {
+	defaultContainer.SetPoolSize(service, size)
+}
+
+func SetReadinessCheck(service string, check ReadinessCheck) {
+	defaultContainer.SetReadinessCheck(service, check)
+}
+
+func SetAdminToken(token string) {
+	defaultContainer.SetAdminToken(token)
+}
+
+func AddAdminInfo(name string, info AdminInfo) {
+	defaultContainer.AddAdminInfo(name, info)
+}
+
+func OnReload(name string, fn Reloader) {
+	defaultContainer.OnReload(name, fn)
+}
+
+func Reload() error {
+	return defaultContainer.Reload()
+}
+
+// SetLoadReport of the default container
+func SetLoadReport(interval time.Duration) {
+	defaultContainer.SetLoadReport(interval)
+}
+
+func SetDrain(opts DrainOptions) {
+	defaultContainer.SetDrain(opts)
+}
+
+func Drain() error {
+	return defaultContainer.Drain()
+}
+
+// EnableMonitor serves the health checks, metrics and the admin api
+func EnableMonitor(listen string) {
+	defaultContainer.EnableMonitor(listen)
+}
+
+// Start the default container
+func Start() error {
+	return defaultContainer.Start()
+}
+
+// Shutdown the default container
+func Shutdown() error {
+	return defaultContainer.Shutdown()
+}
+
+// Push message to server through the default container
+func Push(server string, p *pkt.LogicPkt) error {
+	return defaultContainer.Push(server, p)
+}
+
+// Forward message to service through the default container
+func Forward(serviceName string, packet *pkt.LogicPkt) error {
+	return defaultContainer.Forward(serviceName, packet)
+}
+
+func ForwardWithSelector(serviceName string, packet *pkt.LogicPkt, selector Selector) error {
+	return defaultContainer.ForwardWithSelector(serviceName, packet, selector)
+}
+
+// Init the container with a Server, and its deps
+func (c *Container) Init(srv qim.Server, lg *zap.Logger, deps ...string) error {
 	if !atomic.CompareAndSwapUint32(&c.state, stateUninitialized, stateInitialized) {
 		return errors.New("already initialized")
 	}
@@ -86,32 +240,66 @@ func Init(srv qim.Server, lg *zap.Logger, deps ...string) error {
 	return nil
 }
 
-func SetDialer(dialer qim.Dialer) {
+func (c *Container) SetDialer(dialer qim.Dialer) {
 	c.dialer = dialer
 }
 
-func SetSelector(selector Selector) {
+func (c *Container) SetSelector(selector Selector) {
 	c.seletor = selector
 }
 
-func SetServiceNaming(nm naming.Naming) {
+func (c *Container) SetServiceNaming(nm naming.Naming) {
 	c.Naming = nm
 }
 
-func EnableMonitor(listen string) {
+// SetFailover sets the retry budget and the outlier ejection of Forward
+func (c *Container) SetFailover(opts FailoverOptions) {
+	c.failover = opts
+	c.budget = newRetryBudget(opts.BudgetRatio, opts.MinRetries)
+	c.outliers = newOutlierDetector(opts.EjectionThreshold, opts.EjectionTime)
+}
+
+// SetWarmup sets the warm-up period of the newly discovered services of a dep
+func (c *Container) SetWarmup(service string, warmup time.Duration) {
+	opts := c.depOptions(service)
+	opts.Warmup = warmup
+	c.depOpts[service] = opts
+}
+
+// SetPoolSize sets the connections to each service of a dep
+func (c *Container) SetPoolSize(service string, size int) {
+	opts := c.depOptions(service)
+	opts.PoolSize = size
+	c.depOpts[service] = opts
+}
+
+// SetReadinessCheck sets the readiness check of the newly discovered services of a dep
+func (c *Container) SetReadinessCheck(service string, check ReadinessCheck) {
+	opts := c.depOptions(service)
+	opts.Readiness = check
+	c.depOpts[service] = opts
+}
+
+func (c *Container) depOptions(service string) DepOptions {
+	opts, ok := c.depOpts[service]
+	if !ok {
+		opts.Warmup = DefaultWarmup
+		opts.PoolSize = DefaultPoolSize
+	}
+	return opts
+}
+
+func (c *Container) EnableMonitor(listen string) {
 	c.monitor.Do(func() {
+		handler := c.monitorHandler()
 		go func() {
-			http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-				_, _ = w.Write([]byte("ok"))
-			})
-			http.Handle("/metrics", promhttp.Handler())
-			_ = http.ListenAndServe(listen, nil)
+			_ = http.ListenAndServe(listen, handler)
 		}()
 	})
 }
 
-// start server
-func Start() error {
+// Start the server, it blocks until a signal is received or the container is shut down
+func (c *Container) Start() error {
 	if c.Naming == nil {
 		return errors.New("naming is nil")
 	}
@@ -129,7 +317,7 @@ func Start() error {
 	// 1.
 	for service := range c.deps {
 		go func(service string) {
-			err := connectToService(service)
+			err := c.connectToService(service)
 			if err != nil {
 				c.lg.Error(err.Error())
 			}
@@ -144,23 +332,63 @@ func Start() error {
 		}
 	}
 
+	if c.loadInterval > 0 {
+		go c.reportLoad()
+	}
+
 	// 3.
 	cx := make(chan os.Signal, 1)
-	signal.Notify(cx, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	signal.Notify(cx, append([]os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT},
+		drainSignals...)...)
+	defer signal.Stop(cx)
 
-	c.lg.Info("shutdown", zap.Any("signal", <-cx))
-	// 4.
-	return shutdown()
+	for {
+		select {
+		case sig := <-cx:
+			if sig == syscall.SIGHUP {
+				_ = c.Reload()
+				continue
+			}
+			if isDrainSignal(sig) {
+				if err := c.Drain(); err != nil {
+					c.lg.Warn("drain failed", zap.Error(err))
+				}
+				continue
+			}
+			c.lg.Info("shutdown", zap.Any("signal", sig))
+			// 4.
+			return c.Shutdown()
+		case <-c.closed:
+			return nil
+		}
+	}
 }
 
-// push message to server
-func Push(server string, p *pkt.LogicPkt) error {
+// Push message to server
+func (c *Container) Push(server string, p *pkt.LogicPkt) error {
+	ctx, span := tracing.Tracer().Start(tracing.Extract(context.Background(), &p.Header), "push "+p.Command,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("qim.dest_server", server)))
+	defer span.End()
+	tracing.Inject(ctx, &p.Header)
+
 	p.AddStringMeta(wire.MetaDestServer, server)
-	return c.Srv.Push(server, pkt.Marshal(p))
+	payload := pkt.Marshal(p)
+	err := c.Srv.Push(server, payload)
+	// the first connection from the server is broken, try the others in its pool
+	for i := 1; err != nil && i < MaxPoolSize; i++ {
+		if c.Srv.Push(PoolChannelID(server, i), payload) == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
 }
 
-// forward message to service
-func Forward(serviceName string, packet *pkt.LogicPkt) error {
+// Forward message to service
+func (c *Container) Forward(serviceName string, packet *pkt.LogicPkt) error {
 	if packet == nil {
 		return errors.New("packet is nil")
 	}
@@ -170,42 +398,86 @@ func Forward(serviceName string, packet *pkt.LogicPkt) error {
 	if packet.ChannelId == "" {
 		return errors.New("ChannelId is empty in packet")
 	}
-	return ForwardWithSelector(serviceName, packet, c.seletor)
+	return c.ForwardWithSelector(serviceName, packet, c.seletor)
 }
 
-func ForwardWithSelector(serviceName string, packet *pkt.LogicPkt, selector Selector) error {
-	cli, err := lookup(serviceName, &packet.Header, selector)
+func (c *Container) ForwardWithSelector(serviceName string, packet *pkt.LogicPkt, selector Selector) error {
+	ctx, span := tracing.Tracer().Start(tracing.Extract(context.Background(), &packet.Header), "forward "+packet.Command,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("qim.service", serviceName)))
+	defer span.End()
+
+	clients, srvs, err := c.lookup(serviceName)
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
+	tracing.Inject(ctx, &packet.Header)
 	// add a tag to packet
 	packet.AddStringMeta(wire.MetaDestServer, c.Srv.ServiceID())
+	payload := pkt.Marshal(packet)
+
+	c.budget.deposit()
+	for retries := 0; ; retries++ {
+		id := selector.Lookup(&packet.Header, srvs)
+		span.SetAttributes(attribute.String("qim.dest_service_id", id))
+		cli, ok := clients.Get(id)
+		if !ok {
+			err = errors.New("no client found")
+			break
+		}
 
-	c.lg.Debug("forward message", zap.String("to", cli.ServiceID()), zap.String("header", packet.Header.String()))
-	return cli.Send(pkt.Marshal(packet))
+		c.lg.Debug("forward message", zap.String("to", id), zap.String("header", packet.Header.String()))
+		if pool, ok := cli.(*ClientPool); ok {
+			// keep the order of the messages of a channel
+			err = pool.SendKey(packet.ChannelId, payload)
+		} else {
+			err = cli.Send(payload)
+		}
+		if err == nil {
+			c.outliers.success(id)
+			return nil
+		}
+		if c.outliers.failure(id) {
+			outlierEjectionTotal.WithLabelValues(serviceName).Inc()
+			c.lg.Warn("eject an outlier", zap.String("serviceID", id), zap.Error(err))
+		}
+
+		srvs = without(srvs, id)
+		if retries >= c.failover.MaxRetries || len(srvs) == 0 {
+			break
+		}
+		if !c.budget.withdraw() {
+			retryBudgetExhaustedTotal.WithLabelValues(serviceName).Inc()
+			break
+		}
+		forwardFailoverTotal.WithLabelValues(serviceName).Inc()
+		c.lg.Info("forward failover", zap.String("from", id), zap.Error(err))
+	}
+	span.SetStatus(codes.Error, err.Error())
+	return err
 }
 
-func lookup(serviceName string, header *pkt.Header, selector Selector) (qim.Client, error) {
+// lookup returns the clients of the service and the instances available
+func (c *Container) lookup(serviceName string) (ClientMap, []qim.Service, error) {
 	clients, ok := c.srvclients[serviceName]
 	if !ok {
-		return nil, fmt.Errorf("service not found: %s", serviceName)
+		return nil, nil, fmt.Errorf("service not found: %s", serviceName)
 	}
 
 	srvs := clients.Services(KeyServiceState, StateAdult)
 	if len(srvs) == 0 {
-		return nil, fmt.Errorf("no services found: %s", serviceName)
-	}
-	id := selector.Lookup(header, srvs)
-	if cli, ok := clients.Get(id); ok {
-		return cli, nil
+		return nil, nil, fmt.Errorf("no services found: %s", serviceName)
 	}
-	return nil, errors.New("no client found")
+	return clients, c.outliers.healthy(srvs), nil
 }
 
-func shutdown() error {
+// Shutdown the server, deregister it and unsubscribe the deps
+func (c *Container) Shutdown() error {
 	if !atomic.CompareAndSwapUint32(&c.state, stateStarted, stateClosed) {
 		return fmt.Errorf("invalid state: %d", c.state)
 	}
+	defer close(c.closed)
 
 	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*10)
 	defer cancel()
@@ -227,28 +499,32 @@ func shutdown() error {
 	return nil
 }
 
-func connectToService(serviceName string) error {
+func (c *Container) connectToService(serviceName string) error {
 	log := c.lg.With(zap.String("func", "connectToService"))
 	clients := NewClients(10)
+	c.Lock()
 	c.srvclients[serviceName] = clients
+	c.Unlock()
 	// 1. Watch for new services
-	delay := time.Second * 10
+	opts := c.depOptions(serviceName)
 	err := c.Naming.Subscribe(serviceName, func(services []qim.ServiceRegistration) {
 		for _, service := range services {
-			if _, ok := clients.Get(service.ServiceID()); ok {
+			if cli, ok := clients.Get(service.ServiceID()); ok {
+				updateMeta(cli, func(meta map[string]string) {
+					refreshMeta(meta, service.GetMeta())
+				})
 				continue
 			}
 			log.Info("Watch for a new service", zap.String("service", service.String()))
 			service.GetMeta()[KeyServiceState] = StateYoung
 
-			go func(service qim.ServiceRegistration) {
-				time.Sleep(delay)
-				service.GetMeta()[KeyServiceState] = StateAdult
-			}(service)
-
-			_, err := buildClient(clients, service)
+			cli, err := c.buildClient(clients, service)
 			if err != nil {
 				log.Warn(err.Error())
+				continue
+			}
+			if cli != nil {
+				go c.warmup(clients, cli, opts)
 			}
 		}
 	})
@@ -264,7 +540,7 @@ func connectToService(serviceName string) error {
 	for _, service := range services {
 		// change service state to adult
 		service.GetMeta()[KeyServiceState] = StateAdult
-		_, err := buildClient(clients, service)
+		_, err := c.buildClient(clients, service)
 		if err != nil {
 			log.Warn(err.Error())
 		}
@@ -272,13 +548,76 @@ func connectToService(serviceName string) error {
 	return nil
 }
 
-func buildClient(clients ClientMap, service qim.ServiceRegistration) (qim.Client, error) {
+// warmup grows a new service up after the warm-up period and the readiness check
+func (c *Container) warmup(clients ClientMap, cli Client, opts DepOptions) {
+	log := c.lg.With(zap.String("func", "warmup"), zap.String("serviceID", cli.ServiceID()))
+	select {
+	case <-time.After(opts.Warmup):
+	case <-c.closed:
+		return
+	}
+
+	for opts.Readiness != nil {
+		if _, ok := clients.Get(cli.ServiceID()); !ok {
+			log.Info("service is gone before ready")
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+		err := opts.Readiness(ctx, cli)
+		cancel()
+		if err == nil {
+			break
+		}
+		log.Warn("service is not ready", zap.Error(err))
+		select {
+		case <-time.After(readinessInterval):
+		case <-c.closed:
+			return
+		}
+	}
+
+	updateMeta(cli, func(meta map[string]string) {
+		meta[KeyServiceAdultAt] = strconv.FormatInt(time.Now().UnixNano(), 10)
+		meta[KeyServiceState] = StateAdult
+	})
+	log.Info("service grown up")
+}
+
+// metaUpdater is implemented by ClientPool
+type metaUpdater interface {
+	UpdateMeta(fn func(meta map[string]string))
+}
+
+// updateMeta changes the meta of the client, see ClientPool.UpdateMeta
+func updateMeta(cli Client, fn func(meta map[string]string)) {
+	if updater, ok := cli.(metaUpdater); ok {
+		updater.UpdateMeta(fn)
+	}
+}
+
+// localMetaKeys are set by the container, they are kept when the meta of a client is refreshed
+var localMetaKeys = []string{KeyServiceState, KeyServiceAdultAt}
+
+// refreshMeta updates the meta of a client with the meta published by its service
+func refreshMeta(meta, published map[string]string) {
+	for key := range meta {
+		if _, ok := published[key]; !ok && !slices.Contains(localMetaKeys, key) {
+			delete(meta, key)
+		}
+	}
+	for key, val := range published {
+		if !slices.Contains(localMetaKeys, key) {
+			meta[key] = val
+		}
+	}
+}
+
+func (c *Container) buildClient(clients ClientMap, service qim.ServiceRegistration) (Client, error) {
 	c.Lock()
 	defer c.Unlock()
 	var (
 		id   = service.ServiceID()
 		name = service.ServiceName()
-		meta = service.GetMeta()
 	)
 	// 1. return if client already exists
 	if _, ok := clients.Get(id); ok {
@@ -288,38 +627,105 @@ func buildClient(clients ClientMap, service qim.ServiceRegistration) (qim.Client
 	if service.GetProtocol() != string(wire.ProtocolTCP) {
 		return nil, fmt.Errorf("unexpected service protocol: %s", service.GetProtocol())
 	}
-	// 3. create client and connect
-	cli := tcp.NewClientWithProps(id, name, meta,
+	if c.dialer == nil {
+		return nil, errors.New("dialer is nil")
+	}
+	// 3. create the connections of the pool
+	pool := NewClientPool(service, c.depOptions(name).PoolSize)
+	for i := 0; i < pool.Size(); i++ {
+		cli, err := c.dial(service, i)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		pool.set(i, cli)
+	}
+	clientPoolConnections.WithLabelValues(name).Add(float64(pool.Size()))
+	// 4. read messages
+	for i := 0; i < pool.Size(); i++ {
+		go c.serveConn(clients, pool, service, i)
+	}
+	// 5.
+	clients.Add(pool)
+	return pool, nil
+}
+
+func (c *Container) dial(service qim.ServiceRegistration, index int) (qim.Client, error) {
+	cli := tcp.NewClientWithProps(service.ServiceID(), service.ServiceName(), service.GetMeta(),
 		c.lg.With(zap.String("module", "client.tcp")),
 		tcp.ClientOptions{
 			Heartbeat: qim.DefaultHeartbeat,
 			Readwait:  qim.DefaultReadwait,
 			Writewait: qim.DefaultWritewait,
 		})
-	if c.dialer == nil {
-		return nil, errors.New("dialer is nil")
-	}
-	cli.SetDialer(c.dialer)
+	cli.SetDialer(&indexedDialer{Dialer: c.dialer, index: index})
 	err := cli.Connect(service.DialURL())
 	if err != nil {
 		return nil, err
 	}
-	// 4. read messages
-	go func(cli qim.Client) {
-		err := readloop(cli)
+	return cli, nil
+}
+
+// serveConn reads messages from a connection of the pool and replaces it once broken,
+// the pool is removed if none of its connections is alive and can be replaced.
+func (c *Container) serveConn(clients ClientMap, pool *ClientPool, service qim.ServiceRegistration, index int) {
+	var (
+		id   = service.ServiceID()
+		name = service.ServiceName()
+		log  = c.lg.With(zap.String("func", "serveConn"), zap.String("serviceID", id), zap.Int("index", index))
+	)
+	cli, ok := pool.conn(index)
+	for ok {
+		err := c.readloop(cli)
 		if err != nil {
-			c.lg.Debug(err.Error())
+			log.Debug(err.Error())
 		}
-		clients.Remove(id)
 		cli.Close()
-	}(cli)
-	// 5.
-	clients.Add(cli)
-	return cli, nil
+		pool.unset(index, cli)
+		clientPoolConnections.WithLabelValues(name).Dec()
+
+		cli, ok = nil, false
+		for attempt := 1; !ok; attempt++ {
+			backoff := reconnectBackoff * time.Duration(attempt)
+			if backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+			select {
+			case <-time.After(backoff):
+			case <-c.closed:
+				return
+			}
+			if pool.isClosed() {
+				return
+			}
+
+			cli, err = c.dial(service, index)
+			if err == nil && pool.set(index, cli) {
+				ok = true
+				clientPoolConnections.WithLabelValues(name).Inc()
+				clientPoolReconnectTotal.WithLabelValues(name, "ok").Inc()
+				log.Info("connection replaced")
+				continue
+			}
+			if cli != nil {
+				cli.Close()
+			}
+			clientPoolReconnectTotal.WithLabelValues(name, "error").Inc()
+			log.Warn("replace connection failed", zap.Int("attempt", attempt), zap.Error(err))
+
+			if attempt >= maxReconnects && pool.Live() == 0 {
+				log.Info("remove the client pool")
+				clients.Remove(id)
+				c.outliers.remove(id)
+				pool.Close()
+				return
+			}
+		}
+	}
 }
 
 // Receive default listener
-func readloop(cli qim.Client) error {
+func (c *Container) readloop(cli qim.Client) error {
 	log := c.lg.With(zap.String("func", "readloop"))
 	log.Info("readloop starting", zap.String("serviceID", cli.ServiceID()), zap.String("serviceName", cli.ServiceName()))
 
@@ -339,7 +745,10 @@ func readloop(cli qim.Client) error {
 			log.Info(err.Error())
 			continue
 		}
-		err = pushMessage(packet)
+		if c.calls.deliver(packet) {
+			continue
+		}
+		err = c.pushMessage(packet)
 		if err != nil {
 			log.Info(err.Error())
 		}
@@ -347,7 +756,7 @@ func readloop(cli qim.Client) error {
 }
 
 // push the message to the channel through the gateway server
-func pushMessage(packet *pkt.LogicPkt) error {
+func (c *Container) pushMessage(packet *pkt.LogicPkt) error {
 	server, _ := packet.GetMeta(wire.MetaDestServer)
 	if server != c.Srv.ServiceID() {
 		return fmt.Errorf("dest_server is incorrect, %s != %s", server, c.Srv.ServiceID())
@@ -358,8 +767,14 @@ func pushMessage(packet *pkt.LogicPkt) error {
 	}
 
 	channelIDs := strings.Split(channels.(string), ",")
+	_, span := tracing.Tracer().Start(tracing.Extract(context.Background(), &packet.Header), "deliver "+packet.Command,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.Int("qim.channels", len(channelIDs))))
+	defer span.End()
+
 	packet.DelMeta(wire.MetaDestServer)
 	packet.DelMeta(wire.MetaDestChannels)
+	tracing.Clean(&packet.Header)
 	payload := pkt.Marshal(packet)
 	c.lg.Debug("pushing message", zap.Strings("channels", channelIDs), zap.String("packet", packet.String()))
 
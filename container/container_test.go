@@ -0,0 +1,110 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestNew(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	lg := zap.NewNop()
+
+	newContainer := func(serverID, chatID string) (*Container, *qim.MockServer, *qim.MockClient) {
+		srv := qim.NewMockServer(ctrl)
+		srv.EXPECT().ServiceID().AnyTimes().Return(serverID)
+
+		cli := qim.NewMockClient(ctrl)
+		cli.EXPECT().ServiceID().AnyTimes().Return(chatID)
+		cli.EXPECT().GetMeta().AnyTimes().Return(map[string]string{KeyServiceState: StateAdult})
+
+		c := New(srv, lg, wire.SNChat)
+		clients := NewClients(1)
+		clients.Add(cli)
+		c.srvclients[wire.SNChat] = clients
+		return c, srv, cli
+	}
+
+	c1, srv1, cli1 := newContainer("gateway1", "chat1")
+	c2, srv2, cli2 := newContainer("gateway2", "chat2")
+	assert.Error(t, c1.Init(srv1, lg))
+
+	cli1.EXPECT().Send(gomock.Any()).Times(1).Return(nil)
+	cli2.EXPECT().Send(gomock.Any()).Times(2).Return(nil)
+
+	packet := pkt.New(wire.CommandChatUserTalk, pkt.WithChannel("ch1"))
+	assert.Nil(t, c1.Forward(wire.SNChat, packet))
+	server, _ := packet.GetMeta(wire.MetaDestServer)
+	assert.Equal(t, "gateway1", server)
+
+	for i := 0; i < 2; i++ {
+		packet = pkt.New(wire.CommandChatUserTalk, pkt.WithChannel("ch1"))
+		assert.Nil(t, c2.Forward(wire.SNChat, packet))
+	}
+	assert.Error(t, c2.Forward(wire.SNLogin, packet))
+
+	srv1.EXPECT().Push("gateway2", gomock.Any()).Times(1).Return(nil)
+	srv2.EXPECT().Push(gomock.Any(), gomock.Any()).Times(0)
+	assert.Nil(t, c1.Push("gateway2", pkt.New(wire.CommandChatUserTalk)))
+
+	// not started
+	assert.Error(t, c1.Shutdown())
+}
+
+func TestWarmup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	meta := map[string]string{KeyServiceState: StateYoung}
+	cli := NewClientPool(&naming.DefaultService{ID: "chat1", Name: wire.SNChat, Meta: meta}, 1)
+	clients := NewClients(1)
+	clients.Add(cli)
+
+	c := New(qim.NewMockServer(ctrl), zap.NewNop(), wire.SNChat)
+	assert.Equal(t, DefaultWarmup, c.depOptions(wire.SNChat).Warmup)
+
+	checks := 0
+	c.SetWarmup(wire.SNChat, time.Millisecond*10)
+	c.SetReadinessCheck(wire.SNChat, func(ctx context.Context, cli Client) error {
+		checks++
+		if checks < 2 {
+			return errors.New("not ready")
+		}
+		return nil
+	})
+
+	c.warmup(clients, cli, c.depOptions(wire.SNChat))
+	assert.Equal(t, 2, checks)
+	assert.Equal(t, StateAdult, cli.GetMeta()[KeyServiceState])
+	assert.NotEmpty(t, cli.GetMeta()[KeyServiceAdultAt])
+	// the meta of the service is copied rather than written
+	assert.Equal(t, StateYoung, meta[KeyServiceState])
+}
+
+func TestRefreshMeta(t *testing.T) {
+	meta := map[string]string{
+		KeyServiceState:   StateAdult,
+		KeyServiceAdultAt: "1",
+		KeyLoadChannels:   "10",
+		"version":         "1.0.0",
+	}
+	refreshMeta(meta, map[string]string{
+		KeyServiceState: StateYoung,
+		KeyLoadChannels: "20",
+		"draining":      "true",
+	})
+	assert.Equal(t, map[string]string{
+		KeyServiceState:   StateAdult,
+		KeyServiceAdultAt: "1",
+		KeyLoadChannels:   "20",
+		"draining":        "true",
+	}, meta)
+}
@@ -0,0 +1,155 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultDrainBatch    = 100
+	DefaultDrainInterval = time.Second
+	DefaultDrainTimeout  = time.Minute * 5
+
+	drainCheckInterval = time.Second
+)
+
+var ErrDraining = errors.New("container is draining")
+
+// SuggestGateway returns the domain of the gateway the channel is suggested to reconnect to,
+// empty if there is none
+type SuggestGateway func(ch qim.Channel) string
+
+// DrainOptions controls how the channels are migrated before the server is shut down
+type DrainOptions struct {
+	// BatchSize is the channels notified in a batch
+	BatchSize int
+	// Interval is the pause between two batches
+	Interval time.Duration
+	// Timeout is the deadline of the drain, the server is shut down even if some channels are left
+	Timeout time.Duration
+	// Suggest is optional
+	Suggest SuggestGateway
+}
+
+func DefaultDrainOptions() DrainOptions {
+	return DrainOptions{
+		BatchSize: DefaultDrainBatch,
+		Interval:  DefaultDrainInterval,
+		Timeout:   DefaultDrainTimeout,
+	}
+}
+
+// drainer is implemented by qim.DefaultServer
+type drainer interface {
+	Drain() error
+}
+
+func (c *Container) SetDrain(opts DrainOptions) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultDrainBatch
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultDrainTimeout
+	}
+	c.drainOpts = opts
+}
+
+// Drain deregisters the server, stops accepting connections and asks the channels to
+// reconnect elsewhere in paced batches, the server is shut down once the channels are
+// gone or the deadline passes. It returns without waiting for the drain.
+func (c *Container) Drain() error {
+	if atomic.LoadUint32(&c.state) != stateStarted {
+		return errors.New("container is not started")
+	}
+	if !atomic.CompareAndSwapInt32(&c.draining, 0, 1) {
+		return ErrDraining
+	}
+	go c.drain()
+	return nil
+}
+
+func isDrainSignal(sig os.Signal) bool {
+	for _, s := range drainSignals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Container) isDraining() bool {
+	return atomic.LoadInt32(&c.draining) == 1
+}
+
+func (c *Container) drain() {
+	var (
+		opts     = c.drainOpts
+		log      = c.lg.With(zap.String("func", "drain"))
+		deadline = time.Now().Add(opts.Timeout)
+	)
+	log.Info("draining", zap.Int("batch", opts.BatchSize), zap.Duration("interval", opts.Interval),
+		zap.Duration("timeout", opts.Timeout))
+
+	// 1. no more users are routed to the server
+	if err := c.Naming.Deregister(c.Srv.ServiceID()); err != nil {
+		log.Warn("deregister failed", zap.Error(err))
+	}
+	// 2.
+	if d, ok := c.Srv.(drainer); ok {
+		if err := d.Drain(); err != nil {
+			log.Warn("stop accepting failed", zap.Error(err))
+		}
+	}
+	// 3.
+	if lister, ok := c.Srv.(channelLister); ok {
+		c.notifyReconnect(lister.Channels(), opts, deadline)
+		// 4.
+		for left := len(lister.Channels()); left > 0 && time.Now().Before(deadline); left = len(lister.Channels()) {
+			log.Debug("waiting for channels", zap.Int("left", left))
+			select {
+			case <-time.After(drainCheckInterval):
+			case <-c.closed:
+				return
+			}
+		}
+		log.Info("drained", zap.Int("left", len(lister.Channels())))
+	}
+	if err := c.Shutdown(); err != nil {
+		log.Warn(err.Error())
+	}
+}
+
+func (c *Container) notifyReconnect(channels []qim.Channel, opts DrainOptions, deadline time.Time) {
+	for i, ch := range channels {
+		if i > 0 && i%opts.BatchSize == 0 {
+			select {
+			case <-time.After(opts.Interval):
+			case <-c.closed:
+				return
+			}
+			if time.Now().After(deadline) {
+				return
+			}
+		}
+		notify := &pkt.ReconnectNotify{Reason: "drain"}
+		if opts.Suggest != nil {
+			notify.Domain = opts.Suggest(ch)
+		}
+		packet := pkt.New(wire.CommandGatewayReconnect, pkt.WithChannel(ch.ID()))
+		packet.Flag = pkt.Flag_Push
+		packet.WriteBody(notify)
+		if err := ch.Push(pkt.Marshal(packet)); err != nil {
+			drainNotifyTotal.WithLabelValues("error").Inc()
+			c.lg.Debug("notify reconnect failed", zap.String("channel", ch.ID()), zap.Error(err))
+			continue
+		}
+		drainNotifyTotal.WithLabelValues("ok").Inc()
+	}
+}
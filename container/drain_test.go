@@ -0,0 +1,146 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeNaming struct {
+	sync.Mutex
+	deregistered []string
+}
+
+func (n *fakeNaming) Find(serviceName string, selectors ...naming.Selector) ([]qim.ServiceRegistration, error) {
+	return nil, nil
+}
+
+func (n *fakeNaming) Subscribe(serviceName string, callback func(services []qim.ServiceRegistration), selectors ...naming.Selector) error {
+	return nil
+}
+
+func (n *fakeNaming) Unsubscribe(serviceName string) error {
+	return nil
+}
+
+func (n *fakeNaming) Register(service qim.ServiceRegistration) error {
+	return nil
+}
+
+func (n *fakeNaming) Update(service qim.ServiceRegistration) error {
+	return nil
+}
+
+func (n *fakeNaming) Deregister(serviceID string) error {
+	n.Lock()
+	defer n.Unlock()
+	n.deregistered = append(n.deregistered, serviceID)
+	return nil
+}
+
+type drainServer struct {
+	*qim.MockServer
+	sync.Mutex
+	channels []qim.Channel
+	drained  bool
+}
+
+func (s *drainServer) Channels() []qim.Channel {
+	s.Lock()
+	defer s.Unlock()
+	return s.channels
+}
+
+func (s *drainServer) Drain() error {
+	s.Lock()
+	defer s.Unlock()
+	s.drained = true
+	return nil
+}
+
+func (s *drainServer) remove(id string) {
+	s.Lock()
+	defer s.Unlock()
+	for i, ch := range s.channels {
+		if ch.ID() == id {
+			s.channels = append(s.channels[:i:i], s.channels[i+1:]...)
+			return
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	srv := &drainServer{MockServer: qim.NewMockServer(ctrl)}
+	srv.EXPECT().ServiceID().AnyTimes().Return("gateway1")
+	srv.EXPECT().Shutdown(gomock.Any()).Times(1).Return(nil)
+
+	var (
+		mu       sync.Mutex
+		notified = make(map[string]*pkt.ReconnectNotify)
+		times    = make([]time.Time, 0)
+	)
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("ch%d", i)
+		ch := qim.NewMockChannel(ctrl)
+		ch.EXPECT().ID().AnyTimes().Return(id)
+		ch.EXPECT().Push(gomock.Any()).Times(1).DoAndReturn(func(payload []byte) error {
+			packet, err := pkt.MustReadLogicPkt(bytes.NewBuffer(payload))
+			assert.Nil(t, err)
+			assert.Equal(t, wire.CommandGatewayReconnect, packet.Command)
+			var notify pkt.ReconnectNotify
+			assert.Nil(t, packet.ReadBody(&notify))
+
+			mu.Lock()
+			notified[id] = &notify
+			times = append(times, time.Now())
+			mu.Unlock()
+			// the client reconnects elsewhere
+			go srv.remove(id)
+			return nil
+		})
+		srv.channels = append(srv.channels, ch)
+	}
+
+	ns := &fakeNaming{}
+	c := New(srv, zap.NewNop())
+	c.SetServiceNaming(ns)
+	c.SetDrain(DrainOptions{
+		BatchSize: 2,
+		Interval:  time.Millisecond * 50,
+		Timeout:   time.Second * 10,
+		Suggest: func(ch qim.Channel) string {
+			return "ws://gateway2"
+		},
+	})
+	assert.Error(t, c.Drain())
+
+	c.state = stateStarted
+	assert.Nil(t, c.Drain())
+	assert.Equal(t, ErrDraining, c.Drain())
+
+	select {
+	case <-c.closed:
+	case <-time.After(time.Second * 5):
+		t.Fatal("drain timeout")
+	}
+
+	assert.True(t, srv.drained)
+	assert.Equal(t, "gateway1", ns.deregistered[0])
+	assert.Len(t, notified, 5)
+	for _, notify := range notified {
+		assert.Equal(t, "ws://gateway2", notify.Domain)
+	}
+	// 3 batches paced by the interval
+	assert.GreaterOrEqual(t, times[4].Sub(times[0]), time.Millisecond*100)
+}
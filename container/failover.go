@@ -0,0 +1,175 @@
+package container
+
+import (
+	"sync"
+	"time"
+
+	"github.com/joeyscat/qim"
+)
+
+const (
+	DefaultMaxRetries        = 2
+	DefaultRetryBudgetRatio  = 0.2
+	DefaultMinRetries        = 10
+	DefaultEjectionThreshold = 3
+	DefaultEjectionTime      = time.Second * 30
+	maxEjectionTime          = time.Minute * 5
+)
+
+// FailoverOptions controls how Forward retries on another instance when a send fails
+type FailoverOptions struct {
+	// MaxRetries is the max retries of a forward, 0 disables the failover
+	MaxRetries int
+	// BudgetRatio is the ratio of retries to forwards allowed
+	BudgetRatio float64
+	// MinRetries is the capacity of the budget and the retries in it at the start, the retries
+	// spent are refilled by the forwards at BudgetRatio, and refused while the budget is empty
+	MinRetries int
+	// EjectionThreshold is the consecutive send failures to eject an instance, 0 disables the ejection
+	EjectionThreshold int
+	// EjectionTime is the base ejection period, it grows with the ejections of an instance
+	EjectionTime time.Duration
+}
+
+func DefaultFailoverOptions() FailoverOptions {
+	return FailoverOptions{
+		MaxRetries:        DefaultMaxRetries,
+		BudgetRatio:       DefaultRetryBudgetRatio,
+		MinRetries:        DefaultMinRetries,
+		EjectionThreshold: DefaultEjectionThreshold,
+		EjectionTime:      DefaultEjectionTime,
+	}
+}
+
+// retryBudget limits the retries to a ratio of the requests, so that
+// retries do not amplify the load when most of the instances are failing.
+type retryBudget struct {
+	sync.Mutex
+	ratio  float64
+	max    float64
+	tokens float64
+}
+
+func newRetryBudget(ratio float64, minRetries int) *retryBudget {
+	max := float64(minRetries)
+	if max < 1 {
+		max = 1
+	}
+	return &retryBudget{
+		ratio:  ratio,
+		max:    max,
+		tokens: max,
+	}
+}
+
+func (b *retryBudget) deposit() {
+	b.Lock()
+	defer b.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type outlier struct {
+	failures     int
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// outlierDetector ejects the instances failing consecutively for a while
+type outlierDetector struct {
+	sync.Mutex
+	threshold int
+	base      time.Duration
+	now       func() time.Time
+	outliers  map[string]*outlier
+}
+
+func newOutlierDetector(threshold int, base time.Duration) *outlierDetector {
+	return &outlierDetector{
+		threshold: threshold,
+		base:      base,
+		now:       time.Now,
+		outliers:  make(map[string]*outlier),
+	}
+}
+
+func (d *outlierDetector) success(id string) {
+	d.Lock()
+	defer d.Unlock()
+	if o, ok := d.outliers[id]; ok {
+		o.failures = 0
+	}
+}
+
+// failure returns true if the instance is ejected
+func (d *outlierDetector) failure(id string) bool {
+	if d.threshold <= 0 {
+		return false
+	}
+	d.Lock()
+	defer d.Unlock()
+	o, ok := d.outliers[id]
+	if !ok {
+		o = &outlier{}
+		d.outliers[id] = o
+	}
+	o.failures++
+	if o.failures < d.threshold {
+		return false
+	}
+	o.failures = 0
+	o.ejections++
+	period := d.base * time.Duration(o.ejections)
+	if period > maxEjectionTime {
+		period = maxEjectionTime
+	}
+	o.ejectedUntil = d.now().Add(period)
+	return true
+}
+
+// healthy filters out the ejected instances, all of them are returned if none is healthy
+func (d *outlierDetector) healthy(srvs []qim.Service) []qim.Service {
+	d.Lock()
+	defer d.Unlock()
+	now := d.now()
+	res := make([]qim.Service, 0, len(srvs))
+	for _, srv := range srvs {
+		o, ok := d.outliers[srv.ServiceID()]
+		if ok && now.Before(o.ejectedUntil) {
+			continue
+		}
+		res = append(res, srv)
+	}
+	if len(res) == 0 {
+		return srvs
+	}
+	return res
+}
+
+func (d *outlierDetector) remove(id string) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.outliers, id)
+}
+
+func without(srvs []qim.Service, id string) []qim.Service {
+	res := make([]qim.Service, 0, len(srvs))
+	for _, srv := range srvs {
+		if srv.ServiceID() != id {
+			res = append(res, srv)
+		}
+	}
+	return res
+}
@@ -0,0 +1,93 @@
+package container
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// minSelector selects the service with the min id
+type minSelector struct{}
+
+func (minSelector) Lookup(header *pkt.Header, srvs []qim.Service) string {
+	id := srvs[0].ServiceID()
+	for _, srv := range srvs {
+		if srv.ServiceID() < id {
+			id = srv.ServiceID()
+		}
+	}
+	return id
+}
+
+func TestForwardFailover(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	srv := qim.NewMockServer(ctrl)
+	srv.EXPECT().ServiceID().AnyTimes().Return("gateway1")
+	c := New(srv, zap.NewNop(), wire.SNChat)
+	c.SetSelector(minSelector{})
+	c.SetFailover(FailoverOptions{
+		MaxRetries:        1,
+		BudgetRatio:       0,
+		MinRetries:        2,
+		EjectionThreshold: 2,
+		EjectionTime:      time.Minute,
+	})
+
+	var sent []string
+	clients := NewClients(2)
+	newClient := func(id string, err error) {
+		cli := qim.NewMockClient(ctrl)
+		cli.EXPECT().ServiceID().AnyTimes().Return(id)
+		cli.EXPECT().GetMeta().AnyTimes().Return(map[string]string{KeyServiceState: StateAdult})
+		cli.EXPECT().Send(gomock.Any()).AnyTimes().DoAndReturn(func(payload []byte) error {
+			sent = append(sent, id)
+			return err
+		})
+		clients.Add(cli)
+	}
+	newClient("chat1", errors.New("broken pipe"))
+	newClient("chat2", nil)
+	c.srvclients[wire.SNChat] = clients
+
+	forward := func() error {
+		return c.Forward(wire.SNChat, pkt.New(wire.CommandChatUserTalk, pkt.WithChannel("ch1")))
+	}
+
+	// retry on another instance
+	assert.Nil(t, forward())
+	assert.Equal(t, []string{"chat1", "chat2"}, sent)
+
+	// ejected after two consecutive failures
+	assert.Nil(t, forward())
+	sent = nil
+	assert.Nil(t, forward())
+	assert.Equal(t, []string{"chat2"}, sent)
+
+	// the budget is exhausted
+	assert.False(t, c.budget.withdraw())
+
+	// all the instances are ejected
+	_ = c.outliers.failure("chat2")
+	_ = c.outliers.failure("chat2")
+	_, srvs, err := c.lookup(wire.SNChat)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(srvs))
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := newRetryBudget(0.5, 1)
+	assert.True(t, b.withdraw())
+	assert.False(t, b.withdraw())
+	b.deposit()
+	assert.False(t, b.withdraw())
+	b.deposit()
+	assert.True(t, b.withdraw())
+}
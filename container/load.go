@@ -0,0 +1,220 @@
+package container
+
+import (
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/joeyscat/qim/wire/pkt"
+	"go.uber.org/zap"
+)
+
+// Meta keys of the load published by a service
+const (
+	KeyLoadChannels    = "load_channels"
+	KeyLoadMessageRate = "load_message_rate"
+	KeyLoadCPU         = "load_cpu"
+)
+
+// DefaultLoadTolerance is the ratio a service is allowed to be loaded above the mean
+const DefaultLoadTolerance = 0.25
+
+var loadKeys = []string{KeyLoadChannels, KeyLoadMessageRate, KeyLoadCPU}
+
+// Load of a service
+type Load struct {
+	Channels int
+	// MessageRate is the messages received per second
+	MessageRate float64
+	// CPU is the percent of all the cores used by the process
+	CPU float64
+}
+
+func (l Load) values() []float64 {
+	return []float64{float64(l.Channels), l.MessageRate, l.CPU}
+}
+
+func (l Load) apply(meta map[string]string) {
+	meta[KeyLoadChannels] = strconv.Itoa(l.Channels)
+	meta[KeyLoadMessageRate] = strconv.FormatFloat(l.MessageRate, 'f', 2, 64)
+	meta[KeyLoadCPU] = strconv.FormatFloat(l.CPU, 'f', 2, 64)
+}
+
+// LoadOf returns the load published by the service, false if it has not published any
+func LoadOf(srv qim.Service) (Load, bool) {
+	meta := srv.GetMeta()
+	channels, err := strconv.Atoi(meta[KeyLoadChannels])
+	if err != nil {
+		return Load{}, false
+	}
+	rate, _ := strconv.ParseFloat(meta[KeyLoadMessageRate], 64)
+	cpu, _ := strconv.ParseFloat(meta[KeyLoadCPU], 64)
+	return Load{Channels: channels, MessageRate: rate, CPU: cpu}, true
+}
+
+// Underloaded filters out the services loaded above the mean by more than the tolerance
+// in any of the load figures. The services without load are kept, and all of them are
+// returned if the tolerance is not positive.
+func Underloaded[T qim.Service](srvs []T, tolerance float64) []T {
+	if tolerance <= 0 || len(srvs) < 2 {
+		return srvs
+	}
+	loads := make([][]float64, len(srvs))
+	sums := make([]float64, len(loadKeys))
+	count := 0
+	for i, srv := range srvs {
+		load, ok := LoadOf(srv)
+		if !ok {
+			continue
+		}
+		loads[i] = load.values()
+		for j, val := range loads[i] {
+			sums[j] += val
+		}
+		count++
+	}
+	if count == 0 {
+		return srvs
+	}
+
+	res := make([]T, 0, len(srvs))
+	for i, srv := range srvs {
+		if !overloaded(loads[i], sums, count, tolerance) {
+			res = append(res, srv)
+		}
+	}
+	if len(res) == 0 {
+		return srvs
+	}
+	return res
+}
+
+func overloaded(load, sums []float64, count int, tolerance float64) bool {
+	for j, val := range load {
+		mean := sums[j] / float64(count)
+		if mean > 0 && val > mean*(1+tolerance) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadAwareSelector prefers the services not overloaded, the inner selector keeps the
+// channels on their services as long as these services are not overloaded.
+type LoadAwareSelector struct {
+	Selector
+	tolerance float64
+}
+
+func NewLoadAwareSelector(selector Selector, tolerance float64) *LoadAwareSelector {
+	return &LoadAwareSelector{
+		Selector:  selector,
+		tolerance: tolerance,
+	}
+}
+
+// Lookup implements Selector
+func (s *LoadAwareSelector) Lookup(header *pkt.Header, srvs []qim.Service) string {
+	return s.Selector.Lookup(header, Underloaded(srvs, s.tolerance))
+}
+
+var _ Selector = (*LoadAwareSelector)(nil)
+
+// messageCounter is implemented by qim.DefaultServer
+type messageCounter interface {
+	Messages() uint64
+}
+
+// loadSampler measures the load of the server between two samples
+type loadSampler struct {
+	srv      qim.Server
+	now      func() time.Time
+	last     time.Time
+	messages uint64
+	cpuTime  time.Duration
+}
+
+func newLoadSampler(srv qim.Server) *loadSampler {
+	s := &loadSampler{
+		srv: srv,
+		now: time.Now,
+	}
+	s.last = s.now()
+	s.cpuTime = processCPUTime()
+	if counter, ok := srv.(messageCounter); ok {
+		s.messages = counter.Messages()
+	}
+	return s
+}
+
+func (s *loadSampler) sample() Load {
+	var load Load
+	now := s.now()
+	elapsed := now.Sub(s.last)
+	s.last = now
+
+	if lister, ok := s.srv.(channelLister); ok {
+		load.Channels = len(lister.Channels())
+	}
+	if counter, ok := s.srv.(messageCounter); ok {
+		messages := counter.Messages()
+		if elapsed > 0 {
+			load.MessageRate = float64(messages-s.messages) / elapsed.Seconds()
+		}
+		s.messages = messages
+	}
+	cpuTime := processCPUTime()
+	if elapsed > 0 {
+		load.CPU = float64(cpuTime-s.cpuTime) / float64(elapsed) / float64(runtime.NumCPU()) * 100
+	}
+	s.cpuTime = cpuTime
+	return load
+}
+
+// SetLoadReport publishes the load of the server into its meta in the naming at the interval,
+// and refreshes the load of the deps. It is disabled if the interval is not positive.
+func (c *Container) SetLoadReport(interval time.Duration) {
+	c.loadInterval = interval
+}
+
+func (c *Container) reportLoad() {
+	log := c.lg.With(zap.String("func", "reportLoad"))
+	sampler := newLoadSampler(c.Srv)
+	ticker := time.NewTicker(c.loadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.closed:
+			return
+		}
+
+		load := sampler.sample()
+		// the load of the deps is refreshed by the callbacks of their subscriptions
+		if err := c.Naming.Update(loaded(c.Srv, load)); err != nil {
+			log.Warn("publish load failed", zap.Error(err))
+		}
+	}
+}
+
+// loaded copies the registration of the service with the load in its meta, the meta of
+// the server itself is not written as it is read by the others at any time
+func loaded(srv qim.ServiceRegistration, load Load) *naming.DefaultService {
+	meta := make(map[string]string, len(srv.GetMeta())+len(loadKeys))
+	for k, v := range srv.GetMeta() {
+		meta[k] = v
+	}
+	load.apply(meta)
+	return &naming.DefaultService{
+		ID:        srv.ServiceID(),
+		Name:      srv.ServiceName(),
+		Address:   srv.PublicAddress(),
+		Port:      srv.PublicPort(),
+		Protocol:  srv.GetProtocol(),
+		Namespace: srv.GetNamespace(),
+		Tags:      srv.GetTags(),
+		Meta:      meta,
+	}
+}
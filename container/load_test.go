@@ -0,0 +1,115 @@
+package container
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadedService(id string, load *Load) *naming.DefaultService {
+	srv := &naming.DefaultService{ID: id, Meta: map[string]string{}}
+	if load != nil {
+		load.apply(srv.Meta)
+	}
+	return srv
+}
+
+func TestUnderloaded(t *testing.T) {
+	srvs := []qim.Service{
+		loadedService("s1", &Load{Channels: 100, MessageRate: 10, CPU: 10}),
+		loadedService("s2", &Load{Channels: 100, MessageRate: 10, CPU: 10}),
+		loadedService("s3", &Load{Channels: 100, MessageRate: 10, CPU: 60}),
+		loadedService("s4", nil),
+	}
+	load, ok := LoadOf(srvs[2])
+	assert.True(t, ok)
+	assert.Equal(t, Load{Channels: 100, MessageRate: 10, CPU: 60}, load)
+	_, ok = LoadOf(srvs[3])
+	assert.False(t, ok)
+
+	// the cpu of s3 is above the mean 26.67 by more than 25%
+	ids := func(srvs []qim.Service) []string {
+		res := make([]string, len(srvs))
+		for i, srv := range srvs {
+			res[i] = srv.ServiceID()
+		}
+		return res
+	}
+	assert.Equal(t, []string{"s1", "s2", "s4"}, ids(Underloaded(srvs, DefaultLoadTolerance)))
+	assert.Equal(t, []string{"s1", "s2", "s3", "s4"}, ids(Underloaded(srvs, 0)))
+	assert.Equal(t, []string{"s1", "s2", "s3", "s4"}, ids(Underloaded(srvs, 2)))
+}
+
+func TestLoadAwareSelector(t *testing.T) {
+	srvs := make([]qim.Service, 5)
+	for i := range srvs {
+		srvs[i] = loadedService(fmt.Sprintf("s%d", i), &Load{Channels: 100})
+	}
+	s := NewLoadAwareSelector(NewRingSelector(DefaultVirtualNodes), DefaultLoadTolerance)
+	before := make([]string, 1000)
+	for i := range before {
+		before[i] = s.Lookup(&pkt.Header{ChannelId: fmt.Sprintf("channel_%d", i)}, srvs)
+	}
+
+	// s0 is overloaded, only its channels are moved
+	srvs[0] = loadedService("s0", &Load{Channels: 300})
+	for i := range before {
+		after := s.Lookup(&pkt.Header{ChannelId: fmt.Sprintf("channel_%d", i)}, srvs)
+		assert.NotEqual(t, "s0", after)
+		if before[i] != "s0" {
+			assert.Equal(t, before[i], after)
+		}
+	}
+}
+
+type loadServer struct {
+	*channelServer
+	messages uint64
+}
+
+func (s *loadServer) Messages() uint64 {
+	return s.messages
+}
+
+func TestLoadSampler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	srv := &loadServer{
+		channelServer: &channelServer{
+			MockServer: qim.NewMockServer(ctrl),
+			channels:   []qim.Channel{qim.NewMockChannel(ctrl), qim.NewMockChannel(ctrl)},
+		},
+		messages: 100,
+	}
+
+	now := time.Now()
+	sampler := newLoadSampler(srv)
+	sampler.now = func() time.Time { return now }
+	sampler.last = now
+
+	now = now.Add(time.Second * 10)
+	srv.messages = 600
+	load := sampler.sample()
+	assert.Equal(t, 2, load.Channels)
+	assert.Equal(t, float64(50), load.MessageRate)
+	assert.GreaterOrEqual(t, load.CPU, float64(0))
+
+	meta := map[string]string{}
+	load.apply(meta)
+	assert.Equal(t, "2", meta[KeyLoadChannels])
+	assert.Equal(t, "50.00", meta[KeyLoadMessageRate])
+
+	// the load is published with a copy of the service
+	service := &naming.DefaultService{ID: "chat1", Name: "chat", Port: 8000, Meta: map[string]string{"zone": "zone1"}}
+	published := loaded(service, load)
+	assert.Equal(t, "chat1", published.ServiceID())
+	assert.Equal(t, uint16(8000), published.PublicPort())
+	assert.Equal(t, "zone1", published.GetMeta()["zone"])
+	assert.Equal(t, "2", published.GetMeta()[KeyLoadChannels])
+	assert.Equal(t, map[string]string{"zone": "zone1"}, service.Meta)
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package container
+
+import "time"
+
+// processCPUTime is not supported on windows, the CPU load is always 0
+func processCPUTime() time.Duration {
+	return 0
+}
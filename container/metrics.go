@@ -10,3 +10,58 @@ var messageOutFlowBytes = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name:      "message_out_flow_bytes",
 	Help:      "网关下发的消息字节数",
 }, []string{"command"})
+
+var forwardFailoverTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "forward_failover_total",
+	Help:      "转发失败后重试其它实例的次数",
+}, []string{"service"})
+
+var retryBudgetExhaustedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "forward_retry_budget_exhausted_total",
+	Help:      "重试预算耗尽而放弃重试的次数",
+}, []string{"service"})
+
+var outlierEjectionTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "outlier_ejection_total",
+	Help:      "连续发送失败而被摘除的实例数",
+}, []string{"service"})
+
+var clientPoolConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "qim",
+	Name:      "client_pool_connections",
+	Help:      "连接池中存活的服务间连接数",
+}, []string{"service"})
+
+var clientPoolReconnectTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "client_pool_reconnect_total",
+	Help:      "连接池替换断开连接的次数",
+}, []string{"service", "result"})
+
+var reloadTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "config_reload_total",
+	Help:      "配置热加载的次数",
+}, []string{"name", "result"})
+
+var callTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "call_total",
+	Help:      "服务间同步调用的次数",
+}, []string{"service", "result"})
+
+var callDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "qim",
+	Name:      "call_duration_seconds",
+	Help:      "服务间同步调用的耗时",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"service"})
+
+var drainNotifyTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "drain_notify_total",
+	Help:      "下线前通知连接重连到其它网关的次数",
+}, []string{"result"})
@@ -0,0 +1,210 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/joeyscat/qim"
+)
+
+const (
+	DefaultPoolSize = 1
+	// MaxPoolSize bounds the connections to a service instance
+	MaxPoolSize = 16
+)
+
+var ErrPoolClosed = errors.New("client pool closed")
+
+// PoolChannelID returns the channel id of a pooled connection on the server side,
+// the first connection keeps the service id so that the server can push messages back.
+func PoolChannelID(serviceID string, index int) string {
+	if index == 0 {
+		return serviceID
+	}
+	return fmt.Sprintf("%s#%d", serviceID, index)
+}
+
+// Client is a connection, or a pool of connections, to a service instance
+type Client interface {
+	qim.Service
+	Send(payload []byte) error
+	Close()
+}
+
+// ClientPool holds several connections to a service instance,
+// the messages of a channel are always sent through the same connection if it is alive.
+type ClientPool struct {
+	sync.RWMutex
+	id     string
+	name   string
+	meta   atomic.Value // map[string]string
+	metaMu sync.Mutex
+	conns  []qim.Client
+	closed int32
+}
+
+func NewClientPool(service qim.Service, size int) *ClientPool {
+	if size < 1 {
+		size = 1
+	}
+	if size > MaxPoolSize {
+		size = MaxPoolSize
+	}
+	p := &ClientPool{
+		id:    service.ServiceID(),
+		name:  service.ServiceName(),
+		conns: make([]qim.Client, size),
+	}
+	p.meta.Store(maps.Clone(service.GetMeta()))
+	return p
+}
+
+// ServiceID implements Client
+func (p *ClientPool) ServiceID() string {
+	return p.id
+}
+
+// ServiceName implements Client
+func (p *ClientPool) ServiceName() string {
+	return p.name
+}
+
+// GetMeta implements Client, the meta returned is never written
+func (p *ClientPool) GetMeta() map[string]string {
+	return p.meta.Load().(map[string]string)
+}
+
+// UpdateMeta replaces the meta with a copy changed by fn, as the meta is read by
+// the selectors at any time
+func (p *ClientPool) UpdateMeta(fn func(meta map[string]string)) {
+	p.metaMu.Lock()
+	defer p.metaMu.Unlock()
+	meta := maps.Clone(p.GetMeta())
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+	fn(meta)
+	p.meta.Store(meta)
+}
+
+// Size returns the capacity of the pool
+func (p *ClientPool) Size() int {
+	return len(p.conns)
+}
+
+// Live returns the alive connections in the pool
+func (p *ClientPool) Live() int {
+	p.RLock()
+	defer p.RUnlock()
+	live := 0
+	for _, cli := range p.conns {
+		if cli != nil {
+			live++
+		}
+	}
+	return live
+}
+
+// Send implements Client
+func (p *ClientPool) Send(payload []byte) error {
+	return p.SendKey("", payload)
+}
+
+// SendKey sends the payload through the connection selected by the hash of the key,
+// or the next alive one if it is broken.
+func (p *ClientPool) SendKey(key string, payload []byte) error {
+	cli, err := p.pick(key)
+	if err != nil {
+		return err
+	}
+	return cli.Send(payload)
+}
+
+func (p *ClientPool) pick(key string) (qim.Client, error) {
+	if atomic.LoadInt32(&p.closed) == 1 {
+		return nil, ErrPoolClosed
+	}
+	p.RLock()
+	defer p.RUnlock()
+	size := len(p.conns)
+	start := 0
+	if key != "" {
+		start = HashCode(key) % size
+	}
+	for i := 0; i < size; i++ {
+		if cli := p.conns[(start+i)%size]; cli != nil {
+			return cli, nil
+		}
+	}
+	return nil, fmt.Errorf("no connection alive to %s", p.id)
+}
+
+func (p *ClientPool) conn(index int) (qim.Client, bool) {
+	p.RLock()
+	defer p.RUnlock()
+	cli := p.conns[index]
+	return cli, cli != nil
+}
+
+func (p *ClientPool) set(index int, cli qim.Client) bool {
+	p.Lock()
+	defer p.Unlock()
+	if atomic.LoadInt32(&p.closed) == 1 {
+		return false
+	}
+	p.conns[index] = cli
+	return true
+}
+
+// unset returns the alive connections left
+func (p *ClientPool) unset(index int, cli qim.Client) int {
+	p.Lock()
+	defer p.Unlock()
+	if p.conns[index] == cli {
+		p.conns[index] = nil
+	}
+	live := 0
+	for _, c := range p.conns {
+		if c != nil {
+			live++
+		}
+	}
+	return live
+}
+
+func (p *ClientPool) isClosed() bool {
+	return atomic.LoadInt32(&p.closed) == 1
+}
+
+// Close implements Client
+func (p *ClientPool) Close() {
+	if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	for i, cli := range p.conns {
+		if cli != nil {
+			cli.Close()
+			p.conns[i] = nil
+		}
+	}
+}
+
+// indexedDialer tells the server the index of the connection in the pool
+type indexedDialer struct {
+	qim.Dialer
+	index int
+}
+
+// DialAndHandshake implements qim.Dialer
+func (d *indexedDialer) DialAndHandshake(ctx qim.DialerContext) (net.Conn, error) {
+	ctx.Index = d.index
+	return d.Dialer.DialAndHandshake(ctx)
+}
+
+var _ Client = (*ClientPool)(nil)
@@ -0,0 +1,109 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	service := qim.NewMockService(ctrl)
+	service.EXPECT().ServiceID().AnyTimes().Return("chat1")
+	service.EXPECT().ServiceName().AnyTimes().Return("chat")
+	service.EXPECT().GetMeta().AnyTimes().Return(map[string]string{})
+
+	pool := NewClientPool(service, 3)
+	assert.Equal(t, 3, pool.Size())
+	assert.Error(t, pool.Send([]byte("hello")))
+
+	sent := make([]int, 3)
+	conns := make([]qim.Client, 3)
+	for i := range conns {
+		index := i
+		cli := qim.NewMockClient(ctrl)
+		cli.EXPECT().Send(gomock.Any()).AnyTimes().DoAndReturn(func(payload []byte) error {
+			sent[index]++
+			return nil
+		})
+		cli.EXPECT().Close().AnyTimes()
+		conns[i] = cli
+		pool.set(i, cli)
+	}
+	assert.Equal(t, 3, pool.Live())
+
+	// the same channel is always sent through the same connection
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, pool.SendKey("ch1", []byte("hello")))
+	}
+	index := HashCode("ch1") % 3
+	assert.Equal(t, 10, sent[index])
+
+	// spread by channels
+	for i := 0; i < 300; i++ {
+		assert.Nil(t, pool.SendKey(fmt.Sprintf("ch_%d", i), []byte("hello")))
+	}
+	for _, n := range sent {
+		assert.Greater(t, n, 50)
+	}
+
+	// the next alive connection is used if broken
+	assert.Equal(t, 2, pool.unset(index, conns[index]))
+	sent[(index+1)%3] = 0
+	assert.Nil(t, pool.SendKey("ch1", []byte("hello")))
+	assert.Equal(t, 1, sent[(index+1)%3])
+
+	pool.Close()
+	assert.Equal(t, ErrPoolClosed, pool.SendKey("ch1", []byte("hello")))
+	assert.False(t, pool.set(index, conns[index]))
+}
+
+func TestClientPool_UpdateMeta(t *testing.T) {
+	pool := NewClientPool(&naming.DefaultService{ID: "chat1", Meta: map[string]string{KeyServiceState: StateYoung}}, 1)
+	clients := NewClients(1)
+	clients.Add(pool)
+	before := pool.GetMeta()
+
+	// the selectors read the meta while it is refreshed by the subscription
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			_ = clients.Services(KeyServiceState, StateAdult)
+			_, _ = LoadOf(pool)
+			_ = weightOf(pool)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		pool.UpdateMeta(func(meta map[string]string) {
+			refreshMeta(meta, map[string]string{KeyLoadChannels: strconv.Itoa(i)})
+		})
+	}
+	pool.UpdateMeta(func(meta map[string]string) {
+		meta[KeyServiceState] = StateAdult
+	})
+	close(done)
+	wg.Wait()
+
+	assert.Equal(t, map[string]string{KeyServiceState: StateAdult, KeyLoadChannels: "99"}, pool.GetMeta())
+	assert.Equal(t, map[string]string{KeyServiceState: StateYoung}, before)
+}
+
+func TestPoolChannelID(t *testing.T) {
+	assert.Equal(t, "gateway1", PoolChannelID("gateway1", 0))
+	assert.Equal(t, "gateway1#2", PoolChannelID("gateway1", 2))
+}
@@ -0,0 +1,48 @@
+package container
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Reloader reloads a part of the config, it must validate the new config
+// and keep the current one if it is invalid.
+type Reloader func() error
+
+type reloader struct {
+	name string
+	fn   Reloader
+}
+
+// OnReload registers a reloader called on SIGHUP or by the admin api, in the order of registration
+func (c *Container) OnReload(name string, fn Reloader) {
+	c.Lock()
+	defer c.Unlock()
+	c.reloaders = append(c.reloaders, reloader{name: name, fn: fn})
+}
+
+// Reload calls all the reloaders, a failed one does not stop the others
+func (c *Container) Reload() error {
+	c.RLock()
+	reloaders := make([]reloader, len(c.reloaders))
+	copy(reloaders, c.reloaders)
+	c.RUnlock()
+
+	failed := make([]string, 0)
+	for _, r := range reloaders {
+		if err := r.fn(); err != nil {
+			reloadTotal.WithLabelValues(r.name, "error").Inc()
+			c.lg.Error("reload failed", zap.String("name", r.name), zap.Error(err))
+			failed = append(failed, fmt.Sprintf("%s: %v", r.name, err))
+			continue
+		}
+		reloadTotal.WithLabelValues(r.name, "ok").Inc()
+		c.lg.Info("reloaded", zap.String("name", r.name))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("reload failed: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
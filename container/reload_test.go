@@ -0,0 +1,33 @@
+package container
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestReload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	c := New(qim.NewMockServer(ctrl), zap.NewNop())
+	assert.Nil(t, c.Reload())
+
+	calls := make([]string, 0)
+	c.OnReload("route", func() error {
+		calls = append(calls, "route")
+		return errors.New("invalid route")
+	})
+	c.OnReload("config", func() error {
+		calls = append(calls, "config")
+		return nil
+	})
+
+	err := c.Reload()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "route: invalid route")
+	// a failed reloader does not stop the others
+	assert.Equal(t, []string{"route", "config"}, calls)
+}
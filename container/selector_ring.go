@@ -0,0 +1,182 @@
+package container
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/wire/pkt"
+)
+
+const (
+	// KeyServiceWeight is the weight of a service in meta, DefaultServiceWeight if absent
+	KeyServiceWeight     = "weight"
+	DefaultServiceWeight = 100
+	// DefaultVirtualNodes of a service with the default weight on the ring
+	DefaultVirtualNodes = 160
+	// maxRings bounds the cached rings of different sets of services
+	maxRings = 32
+)
+
+// RingSelector maps the channels onto a consistent hash ring of the services,
+// so that only about 1/N of the channels are moved when a service joins or leaves.
+// The virtual nodes of a service are proportional to its weight in meta.
+type RingSelector struct {
+	replicas int
+	last     atomic.Value // *ringCache
+
+	mu    sync.Mutex
+	rings map[string]*hashRing
+}
+
+// ringCache is the ring of the services in the last lookup
+type ringCache struct {
+	members []ringMember
+	ring    *hashRing
+}
+
+type ringMember struct {
+	id     string
+	weight int
+}
+
+func NewRingSelector(replicas int) *RingSelector {
+	if replicas <= 0 {
+		replicas = DefaultVirtualNodes
+	}
+	return &RingSelector{
+		replicas: replicas,
+		rings:    make(map[string]*hashRing),
+	}
+}
+
+// Lookup implements Selector
+func (s *RingSelector) Lookup(header *pkt.Header, srvs []qim.Service) string {
+	return s.LookupKey(header.ChannelId, srvs)
+}
+
+// LookupKey selects a service by the key, such as an account
+func (s *RingSelector) LookupKey(key string, srvs []qim.Service) string {
+	if len(srvs) == 0 {
+		return ""
+	}
+	return s.ring(srvs).get(key)
+}
+
+// ring returns the ring of the last lookup as long as the services are unchanged,
+// otherwise the cached ring of the services, or builds a new one
+func (s *RingSelector) ring(srvs []qim.Service) *hashRing {
+	if last, ok := s.last.Load().(*ringCache); ok && last.unchanged(srvs) {
+		return last.ring
+	}
+
+	sig := signature(srvs)
+	s.mu.Lock()
+	r, ok := s.rings[sig]
+	if !ok {
+		if len(s.rings) >= maxRings {
+			s.rings = make(map[string]*hashRing)
+		}
+		r = newHashRing(srvs, s.replicas)
+		s.rings[sig] = r
+	}
+	s.mu.Unlock()
+
+	members := make([]ringMember, len(srvs))
+	for i, srv := range srvs {
+		members[i] = ringMember{id: srv.ServiceID(), weight: weightOf(srv)}
+	}
+	s.last.Store(&ringCache{members: members, ring: r})
+	return r
+}
+
+// unchanged reports whether the services are the same as the ones of the cache, in the same order
+func (c *ringCache) unchanged(srvs []qim.Service) bool {
+	if len(c.members) != len(srvs) {
+		return false
+	}
+	for i, srv := range srvs {
+		if c.members[i].id != srv.ServiceID() || c.members[i].weight != weightOf(srv) {
+			return false
+		}
+	}
+	return true
+}
+
+// signature identifies a set of services with their weights
+func signature(srvs []qim.Service) string {
+	list := make([]string, len(srvs))
+	for i, srv := range srvs {
+		list[i] = srv.ServiceID() + "/" + strconv.Itoa(weightOf(srv))
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+func weightOf(srv qim.Service) int {
+	weight, err := strconv.Atoi(srv.GetMeta()[KeyServiceWeight])
+	if err != nil || weight <= 0 {
+		return DefaultServiceWeight
+	}
+	return weight
+}
+
+type hashRing struct {
+	points []uint64
+	owners map[uint64]string
+}
+
+func newHashRing(srvs []qim.Service, replicas int) *hashRing {
+	r := &hashRing{
+		owners: make(map[uint64]string),
+	}
+	for _, srv := range srvs {
+		id := srv.ServiceID()
+		vnodes := replicas * weightOf(srv) / DefaultServiceWeight
+		if vnodes < 1 {
+			vnodes = 1
+		}
+		for i := 0; i < vnodes; i++ {
+			point := ringHash(id + "#" + strconv.Itoa(i))
+			// keep the owner of a collision stable whatever the order of the services
+			if owner, ok := r.owners[point]; ok && owner < id {
+				continue
+			}
+			if _, ok := r.owners[point]; !ok {
+				r.points = append(r.points, point)
+			}
+			r.owners[point] = id
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// get returns the owner of the first point clockwise from the hash of the key
+func (r *hashRing) get(key string) string {
+	hash := ringHash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// ringHash is fnv-1a with the finalizer of murmur3 to spread the similar keys
+func ringHash(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+var _ Selector = (*RingSelector)(nil)
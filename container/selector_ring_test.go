@@ -0,0 +1,130 @@
+package container
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+)
+
+const ringTestKeys = 100000
+
+func ringServices(n int) []qim.Service {
+	srvs := make([]qim.Service, n)
+	for i := range srvs {
+		srvs[i] = &naming.DefaultService{ID: fmt.Sprintf("chat_%d", i), Meta: map[string]string{}}
+	}
+	return srvs
+}
+
+// assignments returns the service selected by each key
+func assignments(s Selector, srvs []qim.Service) []string {
+	res := make([]string, ringTestKeys)
+	for i := range res {
+		res[i] = s.Lookup(&pkt.Header{ChannelId: fmt.Sprintf("channel_%d", i)}, srvs)
+	}
+	return res
+}
+
+func moved(before, after []string) int {
+	count := 0
+	for i := range before {
+		if before[i] != after[i] {
+			count++
+		}
+	}
+	return count
+}
+
+func TestRingSelector_Add(t *testing.T) {
+	srvs := ringServices(11)
+	s := NewRingSelector(DefaultVirtualNodes)
+
+	before := assignments(s, srvs[:10])
+	after := assignments(s, srvs)
+
+	ratio := float64(moved(before, after)) / ringTestKeys
+	t.Logf("ring moved %.2f%% of keys when the 11th service joins, 1/N is %.2f%%", ratio*100, 100.0/11)
+	assert.InDelta(t, 1.0/11, ratio, 0.03)
+	// only the keys taken by the new service are moved
+	for i := range before {
+		if before[i] != after[i] {
+			assert.Equal(t, "chat_10", after[i])
+		}
+	}
+
+	hashBefore := assignments(&HashSelector{}, srvs[:10])
+	hashAfter := assignments(&HashSelector{}, srvs)
+	hashRatio := float64(moved(hashBefore, hashAfter)) / ringTestKeys
+	t.Logf("modulo hash moved %.2f%% of keys", hashRatio*100)
+	assert.Greater(t, hashRatio, 0.8)
+}
+
+func TestRingSelector_Remove(t *testing.T) {
+	srvs := ringServices(10)
+	s := NewRingSelector(DefaultVirtualNodes)
+
+	before := assignments(s, srvs)
+	left := without(srvs, "chat_3")
+	after := assignments(s, left)
+
+	ratio := float64(moved(before, after)) / ringTestKeys
+	t.Logf("ring moved %.2f%% of keys when a service leaves, 1/N is %.2f%%", ratio*100, 100.0/10)
+	assert.InDelta(t, 1.0/10, ratio, 0.03)
+	// only the keys of the removed service are moved
+	for i := range before {
+		if before[i] != after[i] {
+			assert.Equal(t, "chat_3", before[i])
+		}
+	}
+}
+
+func TestRingSelector_Weight(t *testing.T) {
+	srvs := ringServices(4)
+	srvs[0].(*naming.DefaultService).Meta[KeyServiceWeight] = "200"
+	s := NewRingSelector(DefaultVirtualNodes)
+
+	hits := make(map[string]int)
+	for _, id := range assignments(s, srvs) {
+		hits[id]++
+	}
+	t.Log(hits)
+	// 200 of the total weight 500
+	assert.InDelta(t, 0.4, float64(hits["chat_0"])/ringTestKeys, 0.05)
+	for _, srv := range srvs[1:] {
+		assert.InDelta(t, 0.2, float64(hits[srv.ServiceID()])/ringTestKeys, 0.05)
+	}
+}
+
+func TestRingSelector_Order(t *testing.T) {
+	srvs := ringServices(5)
+	reversed := make([]qim.Service, len(srvs))
+	for i, srv := range srvs {
+		reversed[len(srvs)-1-i] = srv
+	}
+	s := NewRingSelector(0)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("account_%d", i)
+		assert.Equal(t, s.LookupKey(key, srvs), s.LookupKey(key, reversed))
+	}
+	assert.Equal(t, "", s.LookupKey("account", nil))
+}
+
+func TestRingSelector_Cache(t *testing.T) {
+	srvs := ringServices(3)
+	s := NewRingSelector(DefaultVirtualNodes)
+
+	r := s.ring(srvs)
+	assert.Same(t, r, s.ring(srvs))
+	// the same services in another order share the ring
+	assert.Same(t, r, s.ring([]qim.Service{srvs[2], srvs[0], srvs[1]}))
+
+	srvs[0].(*naming.DefaultService).Meta[KeyServiceWeight] = "200"
+	weighted := s.ring(srvs)
+	assert.NotSame(t, r, weighted)
+	assert.Same(t, weighted, s.ring(srvs))
+	assert.NotSame(t, weighted, s.ring(srvs[:2]))
+}
@@ -0,0 +1,59 @@
+package container
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/wire/pkt"
+)
+
+// SlowStartSelector ramps up the traffic of a newly grown up service linearly in the window.
+// A channel is allowed to select a service in ramp-up if its hash with the service falls
+// in the ratio of the elapsed time, so the channels stay on the same service.
+type SlowStartSelector struct {
+	Selector
+	window time.Duration
+	now    func() time.Time
+}
+
+func NewSlowStartSelector(selector Selector, window time.Duration) *SlowStartSelector {
+	return &SlowStartSelector{
+		Selector: selector,
+		window:   window,
+		now:      time.Now,
+	}
+}
+
+// Lookup implements Selector
+func (s *SlowStartSelector) Lookup(header *pkt.Header, srvs []qim.Service) string {
+	if s.window <= 0 {
+		return s.Selector.Lookup(header, srvs)
+	}
+	now := s.now()
+	ready := make([]qim.Service, 0, len(srvs))
+	for _, srv := range srvs {
+		ratio := s.ratio(srv, now)
+		if ratio >= 1 || float64(HashCode(header.ChannelId+srv.ServiceID())%100) < ratio*100 {
+			ready = append(ready, srv)
+		}
+	}
+	if len(ready) == 0 {
+		ready = srvs
+	}
+	return s.Selector.Lookup(header, ready)
+}
+
+func (s *SlowStartSelector) ratio(srv qim.Service, now time.Time) float64 {
+	val, ok := srv.GetMeta()[KeyServiceAdultAt]
+	if !ok {
+		return 1
+	}
+	nano, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 1
+	}
+	return float64(now.Sub(time.Unix(0, nano))) / float64(s.window)
+}
+
+var _ Selector = (*SlowStartSelector)(nil)
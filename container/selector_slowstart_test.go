@@ -0,0 +1,53 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowStartSelector(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	now := time.Now()
+
+	old := qim.NewMockService(ctrl)
+	old.EXPECT().ServiceID().AnyTimes().Return("old")
+	old.EXPECT().GetMeta().AnyTimes().Return(map[string]string{})
+	young := qim.NewMockService(ctrl)
+	young.EXPECT().ServiceID().AnyTimes().Return("young")
+	young.EXPECT().GetMeta().AnyTimes().Return(map[string]string{
+		KeyServiceAdultAt: strconv.FormatInt(now.UnixNano(), 10),
+	})
+	srvs := []qim.Service{old, young}
+
+	s := NewSlowStartSelector(&HashSelector{}, time.Minute)
+	count := func() int {
+		hits := 0
+		for i := 0; i < 1000; i++ {
+			header := &pkt.Header{ChannelId: fmt.Sprintf("channel_%d", i)}
+			if s.Lookup(header, srvs) == "young" {
+				hits++
+			}
+		}
+		return hits
+	}
+
+	s.now = func() time.Time { return now }
+	assert.Equal(t, 0, count())
+
+	s.now = func() time.Time { return now.Add(time.Second * 30) }
+	half := count()
+	assert.Greater(t, half, 100)
+	assert.Less(t, half, 400)
+
+	s.now = func() time.Time { return now.Add(time.Minute) }
+	full := count()
+	assert.Greater(t, full, 400)
+	assert.Less(t, full, 600)
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package container
+
+import (
+	"os"
+	"syscall"
+)
+
+// drainSignals trigger the drain of the server
+var drainSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package container
+
+import "os"
+
+// drainSignals is empty on windows, the drain is triggered by the admin api only
+var drainSignals = []os.Signal{}
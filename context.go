@@ -1,11 +1,15 @@
 package qim
 
 import (
+	"context"
 	"sync"
 
 	"github.com/joeyscat/qim/logger"
+	"github.com/joeyscat/qim/tracing"
 	"github.com/joeyscat/qim/wire"
 	"github.com/joeyscat/qim/wire/pkt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -27,8 +31,15 @@ type Context interface {
 	Header() *pkt.Header
 	ReadBody(value proto.Message) error
 	Session() Session
+	// Context returns the context.Context of the request, it carries the trace span
+	Context() context.Context
+	SetContext(ctx context.Context)
 	RespWithError(status pkt.Status, err error) error
 	Resp(status pkt.Status, body proto.Message) error
+	// Status returns the status of the response and whether the response has been sent
+	Status() (pkt.Status, bool)
+	// Response returns the response packet, it is nil if no response has been sent
+	Response() *pkt.LogicPkt
 	Dispatch(body proto.Message, recvs ...*Location) error
 	Next()
 }
@@ -47,6 +58,8 @@ type ContextImpl struct {
 	index    int
 	request  *pkt.LogicPkt
 	session  Session
+	ctx      context.Context
+	response *pkt.LogicPkt
 }
 
 func BuildContext() Context {
@@ -62,6 +75,7 @@ func (c *ContextImpl) Dispatch(body protoreflect.ProtoMessage, recvs ...*Locatio
 	packet := pkt.NewFrom(&c.request.Header)
 	packet.Flag = pkt.Flag_Push
 	packet.WriteBody(body)
+	tracing.Inject(c.ctx, &packet.Header)
 
 	logger.L.Debug("<-- Dispatch", zap.Int("to.len", len(recvs)), zap.String("header", c.request.Header.String()))
 
@@ -76,15 +90,16 @@ func (c *ContextImpl) Dispatch(body protoreflect.ProtoMessage, recvs ...*Locatio
 		}
 		group[recv.GateID] = append(group[recv.GateID], recv.ChannelID)
 	}
+	// the receivers on the other gateways are pushed even if one of them failed
+	var err error
 	for gateway, ids := range group {
-		err := c.Push(gateway, ids, packet)
-		if err != nil {
-			logger.L.Error("Push error", zap.Error(err))
+		if e := c.Push(gateway, ids, packet); e != nil {
+			logger.L.Error("Push error", zap.Error(e))
+			err = e
 		}
-		return err
 	}
 
-	return nil
+	return err
 }
 
 // Header implements Context
@@ -118,6 +133,9 @@ func (c *ContextImpl) Resp(status pkt.Status, body protoreflect.ProtoMessage) er
 	packet.Status = status
 	packet.WriteBody(body)
 	packet.Flag = pkt.Flag_Response
+	c.response = packet
+	tracing.Inject(c.ctx, &packet.Header)
+	trace.SpanFromContext(c.ctx).SetAttributes(attribute.String("qim.status", status.String()))
 	logger.L.Debug("<-- Resp", zap.String("toAccount", c.session.GetAccount()),
 		zap.String("header", c.request.Header.String()),
 		zap.String("status", status.String()),
@@ -136,6 +154,29 @@ func (c *ContextImpl) RespWithError(status pkt.Status, err error) error {
 	return c.Resp(status, &pkt.ErrorResp{Message: err.Error()})
 }
 
+// Context implements Context
+func (c *ContextImpl) Context() context.Context {
+	return c.ctx
+}
+
+// SetContext implements Context
+func (c *ContextImpl) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// Status implements Context
+func (c *ContextImpl) Status() (pkt.Status, bool) {
+	if c.response == nil {
+		return pkt.Status_Success, false
+	}
+	return c.response.Status, true
+}
+
+// Response implements Context
+func (c *ContextImpl) Response() *pkt.LogicPkt {
+	return c.response
+}
+
 // Session implements Context
 func (c *ContextImpl) Session() Session {
 	if c.session == nil {
@@ -155,4 +196,6 @@ func (c *ContextImpl) reset() {
 	c.index = 0
 	c.handlers = nil
 	c.session = nil
+	c.ctx = context.Background()
+	c.response = nil
 }
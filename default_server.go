@@ -53,9 +53,15 @@ type DefaultServer struct {
 	Acceptor
 	MessageListener
 	StateListener
-	once    sync.Once
-	options *ServerOptions
-	quit    int32
+	mu       sync.Mutex
+	once     sync.Once
+	options  *ServerOptions
+	quit     int32
+	draining int32
+	messages uint64
+	listener net.Listener
+	gpool    *ants.Pool
+	done     chan struct{}
 
 	lg *zap.Logger
 }
@@ -69,6 +75,19 @@ func (s *DefaultServer) Push(channelID string, payload []byte) error {
 	return ch.Push(payload)
 }
 
+// Channels returns the channels of the server
+func (s *DefaultServer) Channels() []Channel {
+	if s.ChannelMap == nil {
+		return nil
+	}
+	return s.ChannelMap.All()
+}
+
+// Messages returns the messages received by the server
+func (s *DefaultServer) Messages() uint64 {
+	return atomic.LoadUint64(&s.messages)
+}
+
 // SetAcceptor implements Server
 func (s *DefaultServer) SetAcceptor(acceptor Acceptor) {
 	s.Acceptor = acceptor
@@ -94,10 +113,30 @@ func (s *DefaultServer) SetStateListener(stateListener StateListener) {
 	s.StateListener = stateListener
 }
 
+// Drain stops accepting new connections, the channels accepted are kept
+func (s *DefaultServer) Drain() error {
+	if !atomic.CompareAndSwapInt32(&s.draining, 0, 1) {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
 // Shutdown implements Server
 func (s *DefaultServer) Shutdown(ctx context.Context) error {
 	s.once.Do(func() {
 		defer func() {
+			// the messages of the channels are handled in the pool until the server is shut down
+			s.mu.Lock()
+			if s.gpool != nil {
+				s.gpool.Release()
+			}
+			s.mu.Unlock()
+			close(s.done)
 			s.lg.Info("shutdown")
 		}()
 
@@ -137,11 +176,11 @@ func (s *DefaultServer) Start() error {
 	if err != nil {
 		return err
 	}
-
 	mgpool, _ := ants.NewPool(s.options.MessageGPool, ants.WithPreAlloc(true))
-	defer func() {
-		mgpool.Release()
-	}()
+	s.mu.Lock()
+	s.listener = lst
+	s.gpool = mgpool
+	s.mu.Unlock()
 
 	log := s.lg.With(zap.String("listen", s.listen), zap.String("func", "Start"))
 	log.Info("started")
@@ -152,6 +191,12 @@ func (s *DefaultServer) Start() error {
 			if rawconn != nil {
 				rawconn.Close()
 			}
+			if atomic.LoadInt32(&s.draining) == 1 {
+				// the channels accepted are served until the server is shut down
+				log.Info("stop accepting")
+				<-s.done
+				break
+			}
 			log.Warn(err.Error())
 			continue
 		}
@@ -209,7 +254,7 @@ func (s *DefaultServer) connHandler(rawconn net.Conn, gpool *ants.Pool) {
 	s.lg.Info("accept channel", zap.String("channelID", channel.ID()),
 		zap.String("remoteAddr", channel.RemoteAddr().String()))
 
-	err = channel.Readloop(s.MessageListener)
+	err = channel.Readloop(&countListener{MessageListener: s.MessageListener, count: &s.messages})
 	if err != nil {
 		// TODO Info or Warn?
 		s.lg.Info(err.Error())
@@ -221,6 +266,18 @@ func (s *DefaultServer) connHandler(rawconn net.Conn, gpool *ants.Pool) {
 
 var _ Server = (*DefaultServer)(nil)
 
+// countListener counts the messages received by the server
+type countListener struct {
+	MessageListener
+	count *uint64
+}
+
+// Receive implements MessageListener
+func (l *countListener) Receive(ag Agent, payload []byte) {
+	atomic.AddUint64(l.count, 1)
+	l.MessageListener.Receive(ag, payload)
+}
+
 func NewServer(
 	listen string,
 	service ServiceRegistration,
@@ -243,6 +300,7 @@ func NewServer(
 		options:             defaultOpts,
 		Upgrader:            upgrader,
 		quit:                0,
+		done:                make(chan struct{}),
 	}
 	// TODO
 	s.lg = logger.L.With(zap.String("module", upgrader.Name()),
@@ -0,0 +1,56 @@
+package qim
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim/logger"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type testUpgrader struct{}
+
+func (testUpgrader) Name() string { return "test" }
+
+func (testUpgrader) Upgrade(rawconn net.Conn, rd *bufio.Reader, wr *bufio.Writer) (Conn, error) {
+	return nil, net.ErrClosed
+}
+
+func TestDefaultServer_Drain(t *testing.T) {
+	logger.L = zap.NewNop()
+	ctrl := gomock.NewController(t)
+
+	service := NewMockServiceRegistration(ctrl)
+	service.EXPECT().ServiceID().AnyTimes().Return("gateway1")
+	listener := NewMockStateListener(ctrl)
+
+	s := NewServer("127.0.0.1:0", service, testUpgrader{})
+	s.SetStateListener(listener)
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.Start()
+	}()
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.gpool != nil
+	}, time.Second, time.Millisecond*10)
+
+	// the channels accepted are still served while draining
+	assert.Nil(t, s.Drain())
+	select {
+	case <-stopped:
+		t.Fatal("the server is stopped by the drain")
+	case <-time.After(time.Millisecond * 100):
+	}
+	assert.False(t, s.gpool.IsClosed())
+
+	assert.Nil(t, s.Shutdown(context.Background()))
+	assert.Nil(t, <-stopped)
+	assert.True(t, s.gpool.IsClosed())
+}
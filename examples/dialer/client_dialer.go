@@ -18,6 +18,8 @@ import (
 
 type ClientDialer struct {
 	AppSecret string
+	// Device of the login, the default device is used if it is empty
+	Device string
 }
 
 var _ qim.Dialer = (*ClientDialer)(nil)
@@ -35,6 +37,7 @@ func (d *ClientDialer) DialAndHandshake(ctx qim.DialerContext) (net.Conn, error)
 	tk, err := token.Generate(d.AppSecret, &token.Token{
 		Account: ctx.ID,
 		App:     "qim",
+		Device:  d.Device,
 		Exp:     time.Now().AddDate(0, 0, 1).Unix(),
 	})
 	if err != nil {
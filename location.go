@@ -10,6 +10,8 @@ import (
 type Location struct {
 	ChannelID string
 	GateID    string
+	// Device of the session, empty is the default device
+	Device string
 }
 
 func (loc *Location) Bytes() []byte {
@@ -19,6 +21,7 @@ func (loc *Location) Bytes() []byte {
 	buf := new(bytes.Buffer)
 	_ = endian.WriteShortBytes(buf, []byte(loc.ChannelID))
 	_ = endian.WriteShortBytes(buf, []byte(loc.GateID))
+	_ = endian.WriteShortBytes(buf, []byte(loc.Device))
 	return buf.Bytes()
 }
 
@@ -32,5 +35,14 @@ func (loc *Location) Unmarshal(data []byte) (err error) {
 		return
 	}
 	loc.GateID, err = endian.ReadShortString(buf)
+	if err != nil {
+		return
+	}
+	// the locations saved by the old version have no device
+	if buf.Len() == 0 {
+		loc.Device = ""
+		return
+	}
+	loc.Device, err = endian.ReadShortString(buf)
 	return
 }
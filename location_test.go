@@ -0,0 +1,26 @@
+package qim
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/joeyscat/qim/wire/endian"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocation_Unmarshal(t *testing.T) {
+	loc := &Location{ChannelID: "channel1", GateID: "gateway1", Device: "ios"}
+	var got Location
+	assert.Nil(t, got.Unmarshal(loc.Bytes()))
+	assert.Equal(t, *loc, got)
+
+	// saved by the old version without device
+	buf := new(bytes.Buffer)
+	_ = endian.WriteShortBytes(buf, []byte("channel1"))
+	_ = endian.WriteShortBytes(buf, []byte("gateway1"))
+	got = Location{Device: "android"}
+	assert.Nil(t, got.Unmarshal(buf.Bytes()))
+	assert.Equal(t, Location{ChannelID: "channel1", GateID: "gateway1"}, got)
+
+	assert.NotNil(t, got.Unmarshal(nil))
+}
@@ -4,10 +4,13 @@ import (
 	"fmt"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 var (
 	L *zap.Logger
+	// level of L, it can be changed at runtime
+	level = zap.NewAtomicLevel()
 )
 
 type Settings struct {
@@ -38,18 +41,30 @@ func Init(settings Settings) error {
 		settings.RollingDays = 7
 	}
 
-	level := new(zap.AtomicLevel)
 	err := level.UnmarshalText([]byte(settings.Level))
 	if err != nil {
 		return err
 	}
 
+	var config zap.Config
 	if settings.Env == "dev" {
-		L, err = zap.NewDevelopment()
+		config = zap.NewDevelopmentConfig()
 	} else if settings.Env == "prod" {
-		L, err = zap.NewProduction()
+		config = zap.NewProductionConfig()
 	} else {
 		return fmt.Errorf("unsupported env: %s", settings.Env)
 	}
+	config.Level = level
+	L, err = config.Build()
 	return err
 }
+
+// SetLevel changes the level of L, the current level is kept if the text is invalid
+func SetLevel(text string) error {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(text)); err != nil {
+		return err
+	}
+	level.SetLevel(l)
+	return nil
+}
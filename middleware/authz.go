@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/logger"
+	"github.com/joeyscat/qim/wire/pkt"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+var ErrForbidden = errors.New("forbidden")
+
+// Policy returns an error if the caller is not allowed to do the request
+type Policy func(ctx qim.Context) error
+
+// Policies maps a command, or a group of commands such as chat.group.*, to its policies.
+// A request is allowed only if it passes all the policies matching its command.
+type Policies map[string][]Policy
+
+// Authorize rejects the requests denied by the policies with Status_Forbidden
+func Authorize(policies Policies) qim.HandlerFunc {
+	return func(ctx qim.Context) {
+		command := ctx.Header().GetCommand()
+		for pattern, list := range policies {
+			if !matchCommand(pattern, command) {
+				continue
+			}
+			for _, policy := range list {
+				err := policy(ctx)
+				if err == nil {
+					continue
+				}
+				forbiddenTotal.WithLabelValues(command).Inc()
+				logger.L.Info("request forbidden", zap.Error(err),
+					zap.String("command", command),
+					zap.String("account", ctx.Session().GetAccount()),
+					zap.String("channelID", ctx.Header().GetChannelId()))
+				_ = ctx.RespWithError(pkt.Status_Forbidden, err)
+				return
+			}
+		}
+		ctx.Next()
+	}
+}
+
+func matchCommand(pattern, command string) bool {
+	if pattern == AnyCommand || pattern == command {
+		return true
+	}
+	if strings.HasSuffix(pattern, ".*") {
+		return strings.HasPrefix(command, pattern[:len(pattern)-1])
+	}
+	return false
+}
+
+// Authenticated requires the caller to be logged in
+func Authenticated(ctx qim.Context) error {
+	if ctx.Session().GetAccount() == "" {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Body returns a policy that checks the session against the decoded body of the request
+func Body[T any, PT interface {
+	*T
+	proto.Message
+}](check func(session qim.Session, body PT) error) Policy {
+	return func(ctx qim.Context) error {
+		body := PT(new(T))
+		if err := ctx.ReadBody(body); err != nil {
+			return err
+		}
+		return check(ctx.Session(), body)
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/logger"
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestAuthorize(t *testing.T) {
+	logger.L = zap.NewNop()
+	ctrl := gomock.NewController(t)
+
+	var status pkt.Status
+	dispatcher := qim.NewMockDispatcher(ctrl)
+	dispatcher.EXPECT().Push(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().
+		DoAndReturn(func(gateway string, channels []string, p *pkt.LogicPkt) error {
+			status = p.Status
+			return nil
+		})
+	storage := qim.NewMockSessionStorage(ctrl)
+
+	r := qim.NewRouter()
+	r.Use(Authorize(Policies{
+		"chat.group.*": {Authenticated},
+		wire.CommandGroupJoin: {Body(func(session qim.Session, req *pkt.GroupJoinReq) error {
+			if req.GetAccount() != session.GetAccount() {
+				return errors.New("not self")
+			}
+			return nil
+		})},
+	}))
+	ok := func(ctx qim.Context) {
+		_ = ctx.Resp(pkt.Status_Success, nil)
+	}
+	r.Handle(wire.CommandGroupJoin, ok)
+	r.Handle(wire.CommandGroupDetail, ok)
+	r.Handle(wire.CommandChatTalkAck, ok)
+
+	serve := func(command, account string, body *pkt.GroupJoinReq) pkt.Status {
+		packet := pkt.New(command, pkt.WithChannel("ch1"))
+		packet.WriteBody(body)
+		session := &pkt.Session{ChannelId: "ch1", GateId: "gate1", Account: account}
+		_ = r.Serve(packet, dispatcher, storage, session)
+		return status
+	}
+
+	assert.Equal(t, pkt.Status_Success, serve(wire.CommandGroupJoin, "u1", &pkt.GroupJoinReq{Account: "u1", GroupId: "g1"}))
+	assert.Equal(t, pkt.Status_Forbidden, serve(wire.CommandGroupJoin, "u1", &pkt.GroupJoinReq{Account: "u2", GroupId: "g1"}))
+	assert.Equal(t, pkt.Status_Forbidden, serve(wire.CommandGroupDetail, "", nil))
+	assert.Equal(t, pkt.Status_Success, serve(wire.CommandGroupDetail, "u1", nil))
+	assert.Equal(t, pkt.Status_Success, serve(wire.CommandChatTalkAck, "", nil))
+}
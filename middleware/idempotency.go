@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/logger"
+	"github.com/joeyscat/qim/wire/pkt"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const DefaultIdempotencyWindow = time.Minute * 5
+
+// IdempotencyStore keeps the first response of a request for a window
+type IdempotencyStore interface {
+	// Reserve marks the key as in flight. It returns the cached response
+	// if the request has been handled, or reserved=false if it is in flight.
+	Reserve(key string, ttl time.Duration) (cached []byte, reserved bool, err error)
+	// Complete saves the response of the key
+	Complete(key string, response []byte, ttl time.Duration) error
+	// Release removes the key so that the request can be retried
+	Release(key string) error
+}
+
+// IdempotencyKeyFunc returns the key of the request, the request is not deduplicated if it is empty
+type IdempotencyKeyFunc func(ctx qim.Context) string
+
+type IdempotencyOptions struct {
+	Window  time.Duration
+	Store   IdempotencyStore
+	KeyFunc IdempotencyKeyFunc
+}
+
+// Idempotency handles a request only once within the window and replays
+// the first successful response to the retransmissions of the request.
+func Idempotency(opts IdempotencyOptions) qim.HandlerFunc {
+	if opts.Window <= 0 {
+		opts.Window = DefaultIdempotencyWindow
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore()
+	}
+	if opts.KeyFunc == nil {
+		opts.KeyFunc = SequenceKey
+	}
+
+	return func(ctx qim.Context) {
+		key := opts.KeyFunc(ctx)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+		session := ctx.Session()
+		key = fmt.Sprintf("%s:%s:%s:%s", ctx.Header().GetCommand(), session.GetApp(), session.GetAccount(), key)
+		log := logger.L.With(zap.String("key", key))
+
+		cached, reserved, err := opts.Store.Reserve(key, opts.Window)
+		if err != nil {
+			log.Warn("idempotency store error", zap.Error(err))
+			ctx.Next()
+			return
+		}
+		if cached != nil {
+			duplicatedRequestTotal.WithLabelValues(ctx.Header().GetCommand()).Inc()
+			if err = replay(ctx, cached); err != nil {
+				log.Warn("replay response error", zap.Error(err))
+			}
+			return
+		}
+		if !reserved {
+			// the first request is still in flight, its response will be sent to the client
+			duplicatedRequestTotal.WithLabelValues(ctx.Header().GetCommand()).Inc()
+			log.Debug("drop a duplicated request in flight")
+			return
+		}
+
+		completed := false
+		defer func() {
+			if !completed {
+				_ = opts.Store.Release(key)
+			}
+		}()
+
+		ctx.Next()
+
+		resp := ctx.Response()
+		if resp == nil || resp.Status != pkt.Status_Success {
+			return
+		}
+		cache := &pkt.LogicPkt{Body: resp.Body}
+		cache.Status = resp.Status
+		if err = opts.Store.Complete(key, pkt.Marshal(cache), opts.Window); err != nil {
+			log.Warn("idempotency store error", zap.Error(err))
+			return
+		}
+		completed = true
+	}
+}
+
+// replay sends the cached response through ctx.Resp, so that it is seen by the middlewares
+// before, such as the status recorded by Metrics.
+func replay(ctx qim.Context, cached []byte) error {
+	cache, err := pkt.MustReadLogicPkt(bytes.NewBuffer(cached))
+	if err != nil {
+		return err
+	}
+	return ctx.Resp(cache.Status, rawBody(cache.Body))
+}
+
+// rawBody is a message marshaled to body, which is kept as its unknown fields
+func rawBody(body []byte) proto.Message {
+	msg := &emptypb.Empty{}
+	msg.ProtoReflect().SetUnknown(body)
+	return msg
+}
+
+// SequenceKey identifies a request by its channel and sequence
+func SequenceKey(ctx qim.Context) string {
+	return fmt.Sprintf("%s:%d", ctx.Header().GetChannelId(), ctx.Header().GetSequence())
+}
+
+// MessageKey identifies a MessageReq by the idempotency key generated by the client,
+// the channel and sequence is used if the key is absent.
+func MessageKey(ctx qim.Context) string {
+	var req pkt.MessageReq
+	if err := ctx.ReadBody(&req); err == nil && req.GetIdempotencyKey() != "" {
+		return req.GetIdempotencyKey()
+	}
+	return SequenceKey(ctx)
+}
+
+// MemoryIdempotencyStore is a IdempotencyStore for a single server
+type MemoryIdempotencyStore struct {
+	sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+type idempotencyEntry struct {
+	response []byte
+	expireAt time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		entries:   make(map[string]*idempotencyEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Reserve implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Reserve(key string, ttl time.Duration) ([]byte, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	s.sweep(now, ttl)
+
+	entry, ok := s.entries[key]
+	if ok && now.Before(entry.expireAt) {
+		return entry.response, false, nil
+	}
+	s.entries[key] = &idempotencyEntry{expireAt: now.Add(ttl)}
+	return nil, true, nil
+}
+
+// Complete implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Complete(key string, response []byte, ttl time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.entries[key] = &idempotencyEntry{
+		response: response,
+		expireAt: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+// Release implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Release(key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) sweep(now time.Time, interval time.Duration) {
+	if now.Sub(s.lastSweep) < interval {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if now.After(entry.expireAt) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+var _ IdempotencyStore = (*MemoryIdempotencyStore)(nil)
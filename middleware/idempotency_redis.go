@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// reserveAttempts is the times Reserve tries while the key is removed between SETNX and GET
+const reserveAttempts = 3
+
+var ErrReserveContended = errors.New("idempotency key is removed repeatedly while reserving")
+
+// RedisIdempotencyStore shares the responses between servers through redis,
+// an empty value means the request is in flight.
+type RedisIdempotencyStore struct {
+	cli *redis.Client
+}
+
+func NewRedisIdempotencyStore(cli *redis.Client) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{
+		cli: cli,
+	}
+}
+
+// Reserve implements IdempotencyStore
+func (s *RedisIdempotencyStore) Reserve(key string, ttl time.Duration) ([]byte, bool, error) {
+	for i := 0; i < reserveAttempts; i++ {
+		ok, err := s.cli.SetNX(s.cli.Context(), KeyIdempotency(key), "", ttl).Result()
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return nil, true, nil
+		}
+
+		bts, err := s.cli.Get(s.cli.Context(), KeyIdempotency(key)).Bytes()
+		if err == redis.Nil {
+			// expired or released just now
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if len(bts) == 0 {
+			return nil, false, nil
+		}
+		return bts, false, nil
+	}
+	return nil, false, ErrReserveContended
+}
+
+// Complete implements IdempotencyStore
+func (s *RedisIdempotencyStore) Complete(key string, response []byte, ttl time.Duration) error {
+	return s.cli.Set(s.cli.Context(), KeyIdempotency(key), response, ttl).Err()
+}
+
+// Release implements IdempotencyStore
+func (s *RedisIdempotencyStore) Release(key string) error {
+	return s.cli.Del(s.cli.Context(), KeyIdempotency(key)).Err()
+}
+
+func KeyIdempotency(key string) string {
+	return fmt.Sprintf("idempotency:%s", key)
+}
+
+var _ IdempotencyStore = (*RedisIdempotencyStore)(nil)
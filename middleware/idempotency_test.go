@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/logger"
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestIdempotency(t *testing.T) {
+	logger.L = zap.NewNop()
+	ctrl := gomock.NewController(t)
+
+	responses := make([]*pkt.LogicPkt, 0)
+	dispatcher := qim.NewMockDispatcher(ctrl)
+	dispatcher.EXPECT().Push(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().
+		DoAndReturn(func(gateway string, channels []string, p *pkt.LogicPkt) error {
+			responses = append(responses, p)
+			return nil
+		})
+	storage := qim.NewMockSessionStorage(ctrl)
+
+	handled := 0
+	failed := true
+	statuses := make([]pkt.Status, 0)
+	r := qim.NewRouter()
+	r.Use(func(ctx qim.Context) {
+		ctx.Next()
+		status, _ := ctx.Status()
+		statuses = append(statuses, status)
+	})
+	r.Handle(wire.CommandChatUserTalk, Idempotency(IdempotencyOptions{KeyFunc: MessageKey}), func(ctx qim.Context) {
+		handled++
+		if failed {
+			_ = ctx.Resp(pkt.Status_SystemException, &pkt.ErrorResp{Message: "SystemException"})
+			return
+		}
+		_ = ctx.Resp(pkt.Status_Success, &pkt.MessageResp{MessageId: int64(handled)})
+	})
+
+	session := &pkt.Session{ChannelId: "ch1", GateId: "gate1", Account: "test1", App: "qim"}
+	talk := func(seq uint32, key string) {
+		packet := pkt.New(wire.CommandChatUserTalk, pkt.WithChannel("ch1"), pkt.WithSeq(seq))
+		packet.WriteBody(&pkt.MessageReq{Type: 1, Body: "hello", IdempotencyKey: key})
+		_ = r.Serve(packet, dispatcher, storage, session)
+	}
+
+	// a failed request can be retried
+	talk(1, "m1")
+	failed = false
+	talk(2, "m1")
+	assert.Equal(t, 2, handled)
+
+	// retransmissions are not handled again
+	talk(3, "m1")
+	talk(4, "m1")
+	assert.Equal(t, 2, handled)
+	assert.Equal(t, 4, len(responses))
+	for _, resp := range responses[1:] {
+		var body pkt.MessageResp
+		assert.Nil(t, resp.ReadBody(&body))
+		assert.Equal(t, pkt.Status_Success, resp.Status)
+		assert.Equal(t, int64(2), body.MessageId)
+	}
+	assert.Equal(t, uint32(4), responses[3].Sequence)
+	// the replays are responded through the context
+	assert.Equal(t, []pkt.Status{pkt.Status_SystemException, pkt.Status_Success, pkt.Status_Success, pkt.Status_Success}, statuses)
+
+	// a new message
+	talk(5, "m2")
+	assert.Equal(t, 3, handled)
+
+	// fallback to the channel and sequence
+	talk(6, "")
+	talk(6, "")
+	assert.Equal(t, 4, handled)
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	s := NewMemoryIdempotencyStore()
+
+	cached, reserved, err := s.Reserve("k1", DefaultIdempotencyWindow)
+	assert.Nil(t, err)
+	assert.Nil(t, cached)
+	assert.True(t, reserved)
+
+	// in flight
+	cached, reserved, _ = s.Reserve("k1", DefaultIdempotencyWindow)
+	assert.Nil(t, cached)
+	assert.False(t, reserved)
+
+	_ = s.Complete("k1", []byte("resp"), DefaultIdempotencyWindow)
+	cached, reserved, _ = s.Reserve("k1", DefaultIdempotencyWindow)
+	assert.Equal(t, []byte("resp"), cached)
+	assert.False(t, reserved)
+
+	_ = s.Release("k1")
+	_, reserved, _ = s.Reserve("k1", DefaultIdempotencyWindow)
+	assert.True(t, reserved)
+}
+
+func TestRedisIdempotencyStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer cli.Close()
+	s := NewRedisIdempotencyStore(cli)
+
+	cached, reserved, err := s.Reserve("k1", DefaultIdempotencyWindow)
+	assert.Nil(t, err)
+	assert.Nil(t, cached)
+	assert.True(t, reserved)
+
+	// in flight
+	cached, reserved, err = s.Reserve("k1", DefaultIdempotencyWindow)
+	assert.Nil(t, err)
+	assert.Nil(t, cached)
+	assert.False(t, reserved)
+
+	assert.Nil(t, s.Complete("k1", []byte("resp"), DefaultIdempotencyWindow))
+	cached, reserved, _ = s.Reserve("k1", DefaultIdempotencyWindow)
+	assert.Equal(t, []byte("resp"), cached)
+	assert.False(t, reserved)
+
+	mr.FastForward(DefaultIdempotencyWindow)
+	_, reserved, _ = s.Reserve("k1", DefaultIdempotencyWindow)
+	assert.True(t, reserved)
+	assert.Nil(t, s.Release("k1"))
+	assert.False(t, mr.Exists(KeyIdempotency("k1")))
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "rate_limited_total",
+	Help:      "被限流拒绝的请求数",
+}, []string{"command"})
+
+var duplicatedRequestTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "duplicated_request_total",
+	Help:      "被去重的重复请求数",
+}, []string{"command"})
+
+var forbiddenTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "forbidden_total",
+	Help:      "未通过鉴权的请求数",
+}, []string{"command"})
+
+var handlerDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "qim",
+	Name:      "handler_duration_seconds",
+	Help:      "指令处理耗时",
+	Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+}, []string{"command"})
+
+var handlerResponseTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "handler_response_total",
+	Help:      "指令处理的响应数",
+}, []string{"command", "status"})
+
+// StatusNone is the status label of requests without response
+const StatusNone = "None"
+
+// Metrics records the latency and the response status of command handlers.
+// It should be used before Recover so that panics are counted as SystemException.
+func Metrics() qim.HandlerFunc {
+	return func(ctx qim.Context) {
+		command := ctx.Header().GetCommand()
+		start := time.Now()
+		defer func() {
+			handlerDurationSeconds.WithLabelValues(command).Observe(time.Since(start).Seconds())
+
+			status := StatusNone
+			if s, ok := ctx.Status(); ok {
+				status = s.String()
+			}
+			handlerResponseTotal.WithLabelValues(command, status).Inc()
+		}()
+
+		ctx.Next()
+	}
+}
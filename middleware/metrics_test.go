@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/logger"
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestMetrics(t *testing.T) {
+	logger.L = zap.NewNop()
+	ctrl := gomock.NewController(t)
+
+	dispatcher := qim.NewMockDispatcher(ctrl)
+	dispatcher.EXPECT().Push(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
+	storage := qim.NewMockSessionStorage(ctrl)
+
+	r := qim.NewRouter()
+	r.Use(Metrics(), Recover())
+	r.Handle(wire.CommandGroupCreate, func(ctx qim.Context) {
+		_ = ctx.Resp(pkt.Status_Success, nil)
+	})
+	r.Handle(wire.CommandGroupJoin, func(ctx qim.Context) {
+		panic("oops")
+	})
+	r.Handle(wire.CommandGroupQuit, func(ctx qim.Context) {
+	})
+
+	session := &pkt.Session{ChannelId: "ch1", GateId: "gate1", Account: "test1", App: "qim"}
+	for _, command := range []string{wire.CommandGroupCreate, wire.CommandGroupJoin, wire.CommandGroupQuit} {
+		_ = r.Serve(pkt.New(command, pkt.WithChannel("ch1")), dispatcher, storage, session)
+	}
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		handlerResponseTotal.WithLabelValues(wire.CommandGroupCreate, pkt.Status_Success.String())))
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		handlerResponseTotal.WithLabelValues(wire.CommandGroupJoin, pkt.Status_SystemException.String())))
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		handlerResponseTotal.WithLabelValues(wire.CommandGroupQuit, StatusNone)))
+	assert.Equal(t, 3, testutil.CollectAndCount(handlerDurationSeconds))
+}
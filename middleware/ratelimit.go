@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/logger"
+	"github.com/joeyscat/qim/wire/pkt"
+	"go.uber.org/zap"
+)
+
+const (
+	RateLimitByAccount = "account"
+	RateLimitByApp     = "app"
+)
+
+// AnyCommand is the command of a rule that applies to all commands
+// without a dedicated rule
+const AnyCommand = "*"
+
+// RateLimitRule allows Rate requests per second with bursts of up to Burst requests.
+type RateLimitRule struct {
+	Command string
+	Rate    float64
+	Burst   int
+}
+
+// Limiter decides whether a request identified by key is allowed under the rule
+type Limiter interface {
+	Allow(key string, rule RateLimitRule) (bool, error)
+}
+
+type RateLimitOptions struct {
+	// By is the dimension of the limit, option is account or app
+	By      string
+	Rules   []RateLimitRule
+	Limiter Limiter
+}
+
+// RateLimit rejects requests exceeding the rule of its command with Status_TooManyRequests.
+// A request passes through if the limiter is unavailable.
+func RateLimit(opts RateLimitOptions) qim.HandlerFunc {
+	return NewRateLimits(opts).Handle
+}
+
+// RateLimits is the rate limit middleware whose rules can be updated at runtime
+type RateLimits struct {
+	by      string
+	limiter Limiter
+	rules   atomic.Value // map[string]RateLimitRule
+}
+
+func NewRateLimits(opts RateLimitOptions) *RateLimits {
+	if opts.By == "" {
+		opts.By = RateLimitByAccount
+	}
+	if opts.Limiter == nil {
+		opts.Limiter = NewLocalLimiter()
+	}
+	r := &RateLimits{
+		by:      opts.By,
+		limiter: opts.Limiter,
+	}
+	r.rules.Store(buildRules(opts.Rules))
+	return r
+}
+
+// Update replaces the rules if they are valid
+func (r *RateLimits) Update(rules []RateLimitRule) error {
+	if err := ValidateRateLimitRules(rules); err != nil {
+		return err
+	}
+	r.rules.Store(buildRules(rules))
+	return nil
+}
+
+// ValidateRateLimitRules checks the rules before they are applied
+func ValidateRateLimitRules(rules []RateLimitRule) error {
+	commands := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		if rule.Command == "" {
+			return errors.New("command of rate limit rule is empty")
+		}
+		if rule.Rate < 0 || rule.Burst < 0 {
+			return fmt.Errorf("rate and burst of %s must not be negative", rule.Command)
+		}
+		if _, ok := commands[rule.Command]; ok {
+			return fmt.Errorf("rate limit rule of %s is repeated", rule.Command)
+		}
+		commands[rule.Command] = struct{}{}
+	}
+	return nil
+}
+
+// Rules returns the rules in use, sorted by command
+func (r *RateLimits) Rules() []RateLimitRule {
+	rules := r.rules.Load().(map[string]RateLimitRule)
+	list := make([]RateLimitRule, 0, len(rules))
+	for _, rule := range rules {
+		list = append(list, rule)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Command < list[j].Command })
+	return list
+}
+
+func buildRules(list []RateLimitRule) map[string]RateLimitRule {
+	rules := make(map[string]RateLimitRule, len(list))
+	for _, rule := range list {
+		if rule.Burst <= 0 {
+			rule.Burst = int(rule.Rate) + 1
+		}
+		rules[rule.Command] = rule
+	}
+	return rules
+}
+
+// Handle is the qim.HandlerFunc of the middleware
+func (r *RateLimits) Handle(ctx qim.Context) {
+	rules := r.rules.Load().(map[string]RateLimitRule)
+	command := ctx.Header().GetCommand()
+	rule, ok := rules[command]
+	if !ok {
+		rule, ok = rules[AnyCommand]
+	}
+	if !ok || rule.Rate <= 0 {
+		ctx.Next()
+		return
+	}
+
+	key := rateLimitKey(ctx, r.by, command)
+	allowed, err := r.limiter.Allow(key, rule)
+	if err != nil {
+		logger.L.Warn("rate limiter error", zap.Error(err), zap.String("key", key))
+		ctx.Next()
+		return
+	}
+	if !allowed {
+		rateLimitedTotal.WithLabelValues(command).Inc()
+		_ = ctx.Resp(pkt.Status_TooManyRequests, &pkt.ErrorResp{Message: "TooManyRequests"})
+		return
+	}
+	ctx.Next()
+}
+
+func rateLimitKey(ctx qim.Context, by, command string) string {
+	session := ctx.Session()
+	if by == RateLimitByApp {
+		return fmt.Sprintf("%s:%s", command, session.GetApp())
+	}
+	account := session.GetAccount()
+	if account == "" {
+		account = session.GetChannelId()
+	}
+	return fmt.Sprintf("%s:%s:%s", command, session.GetApp(), account)
+}
+
+// LocalLimiter keeps a token bucket per key in memory
+type LocalLimiter struct {
+	sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+const bucketIdleTimeout = time.Minute
+
+func NewLocalLimiter() *LocalLimiter {
+	return &LocalLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow implements Limiter
+func (l *LocalLimiter) Allow(key string, rule RateLimitRule) (bool, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * rule.Rate
+	if b.tokens > float64(rule.Burst) {
+		b.tokens = float64(rule.Burst)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, nil
+	}
+	b.tokens--
+	return true, nil
+}
+
+// sweep removes buckets that have not been used for a while
+func (l *LocalLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketIdleTimeout {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+var _ Limiter = (*LocalLimiter)(nil)
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// token bucket stored in a hash of {tokens, ts}
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil then
+  tokens = burst
+  ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("PEXPIRE", KEYS[1], ttl)
+return allowed
+`)
+
+// RedisLimiter shares token buckets between servers through redis
+type RedisLimiter struct {
+	cli *redis.Client
+}
+
+func NewRedisLimiter(cli *redis.Client) *RedisLimiter {
+	return &RedisLimiter{
+		cli: cli,
+	}
+}
+
+// Allow implements Limiter
+func (l *RedisLimiter) Allow(key string, rule RateLimitRule) (bool, error) {
+	// keep the bucket until it would have been refilled
+	ttl := time.Duration(float64(rule.Burst)/rule.Rate*float64(time.Second)) + time.Second
+	res, err := tokenBucketScript.Run(l.cli.Context(), l.cli, []string{KeyRateLimit(key)},
+		rule.Rate, rule.Burst, time.Now().UnixMilli(), ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
+
+func KeyRateLimit(key string) string {
+	return fmt.Sprintf("ratelimit:%s", key)
+}
+
+var _ Limiter = (*RedisLimiter)(nil)
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/logger"
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestLocalLimiter_Allow(t *testing.T) {
+	now := time.Now()
+	l := NewLocalLimiter()
+	l.now = func() time.Time { return now }
+
+	rule := RateLimitRule{Rate: 2, Burst: 3}
+	for i := 0; i < 3; i++ {
+		ok, err := l.Allow("k1", rule)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	ok, _ := l.Allow("k1", rule)
+	assert.False(t, ok)
+
+	// the other key has its own bucket
+	ok, _ = l.Allow("k2", rule)
+	assert.True(t, ok)
+
+	// refill 1 token after 500ms
+	now = now.Add(time.Millisecond * 500)
+	ok, _ = l.Allow("k1", rule)
+	assert.True(t, ok)
+	ok, _ = l.Allow("k1", rule)
+	assert.False(t, ok)
+
+	// idle buckets are removed
+	now = now.Add(bucketIdleTimeout * 2)
+	_, _ = l.Allow("k3", rule)
+	assert.Equal(t, 1, len(l.buckets))
+}
+
+func TestRateLimit(t *testing.T) {
+	logger.L = zap.NewNop()
+	ctrl := gomock.NewController(t)
+
+	statuses := make([]pkt.Status, 0)
+	dispatcher := qim.NewMockDispatcher(ctrl)
+	dispatcher.EXPECT().Push(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().
+		DoAndReturn(func(gateway string, channels []string, p *pkt.LogicPkt) error {
+			statuses = append(statuses, p.Status)
+			return nil
+		})
+	storage := qim.NewMockSessionStorage(ctrl)
+
+	r := qim.NewRouter()
+	r.Use(RateLimit(RateLimitOptions{
+		Rules: []RateLimitRule{{Command: wire.CommandChatUserTalk, Rate: 1, Burst: 2}},
+	}))
+	r.Handle(wire.CommandChatUserTalk, func(ctx qim.Context) {
+		_ = ctx.Resp(pkt.Status_Success, nil)
+	})
+	r.Handle(wire.CommandChatTalkAck, func(ctx qim.Context) {
+		_ = ctx.Resp(pkt.Status_Success, nil)
+	})
+
+	session := &pkt.Session{ChannelId: "ch1", GateId: "gate1", Account: "test1", App: "qim"}
+	for i := 0; i < 3; i++ {
+		packet := pkt.New(wire.CommandChatUserTalk, pkt.WithChannel("ch1"))
+		err := r.Serve(packet, dispatcher, storage, session)
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		packet := pkt.New(wire.CommandChatTalkAck, pkt.WithChannel("ch1"))
+		_ = r.Serve(packet, dispatcher, storage, session)
+	}
+
+	assert.Equal(t, []pkt.Status{
+		pkt.Status_Success, pkt.Status_Success, pkt.Status_TooManyRequests,
+		pkt.Status_Success, pkt.Status_Success, pkt.Status_Success,
+	}, statuses)
+}
+
+func TestRateLimits_Update(t *testing.T) {
+	r := NewRateLimits(RateLimitOptions{
+		Rules: []RateLimitRule{{Command: wire.CommandChatUserTalk, Rate: 1}},
+	})
+
+	assert.Error(t, r.Update([]RateLimitRule{{Rate: 1}}))
+	assert.Error(t, r.Update([]RateLimitRule{{Command: wire.CommandChatUserTalk, Rate: -1}}))
+	assert.Error(t, r.Update([]RateLimitRule{
+		{Command: wire.CommandChatUserTalk, Rate: 1},
+		{Command: wire.CommandChatUserTalk, Rate: 2},
+	}))
+	// the invalid rules are not applied
+	rules := r.rules.Load().(map[string]RateLimitRule)
+	assert.Equal(t, 2, rules[wire.CommandChatUserTalk].Burst)
+
+	assert.Nil(t, r.Update([]RateLimitRule{{Command: AnyCommand, Rate: 5, Burst: 10}}))
+	rules = r.rules.Load().(map[string]RateLimitRule)
+	assert.Equal(t, 1, len(rules))
+	assert.Equal(t, 10, rules[AnyCommand].Burst)
+}
@@ -32,5 +32,7 @@ func Recover() qim.HandlerFunc {
 				_ = ctx.Resp(pkt.Status_SystemException, &pkt.ErrorResp{Message: "SystemException"})
 			}
 		}()
+
+		ctx.Next()
 	}
 }
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing continues the trace carried in the packet header and
+// starts a span for the command handler.
+func Tracing() qim.HandlerFunc {
+	return func(ctx qim.Context) {
+		header := ctx.Header()
+		parent := tracing.Extract(ctx.Context(), header)
+
+		spanCtx, span := tracing.Tracer().Start(parent, header.GetCommand(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("qim.command", header.GetCommand()),
+				attribute.String("qim.channel_id", header.GetChannelId()),
+				attribute.Int64("qim.sequence", int64(header.GetSequence())),
+				attribute.String("qim.account", ctx.Session().GetAccount()),
+			))
+		defer span.End()
+
+		ctx.SetContext(spanCtx)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,98 @@
+// Package backend creates the naming.Naming selected by the config of a service
+package backend
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/joeyscat/qim/naming"
+	"github.com/joeyscat/qim/naming/consul"
+	"github.com/joeyscat/qim/naming/dns"
+	"github.com/joeyscat/qim/naming/etcd"
+	"github.com/joeyscat/qim/naming/file"
+	"github.com/joeyscat/qim/naming/memory"
+	"go.uber.org/zap"
+)
+
+const (
+	BackendEtcd   = "etcd"
+	BackendConsul = "consul"
+	BackendFile   = "file"
+	BackendMemory = "memory"
+	BackendDNS    = "dns"
+	BackendK8s    = "k8s"
+)
+
+type Settings struct {
+	// Backend option is etcd, consul, file, memory, dns or k8s, etcd is used if it is empty
+	Backend string
+	// EtcdEndpoints is separated by comma, such as localhost:2379,localhost:2380
+	EtcdEndpoints string
+	ConsulAddress string
+	// File of the services, YAML or JSON
+	File string
+	// DNSDomain of the SRV records, such as qim.local
+	DNSDomain string
+	// K8sNamespace of the services, the pod is in the cluster
+	K8sNamespace string
+	// SingleProcess is set if all the services run in this process, the memory backend
+	// is rejected otherwise as the services in the other processes are never found
+	SingleProcess bool
+}
+
+var (
+	memoryOnce   sync.Once
+	memoryNaming naming.Naming
+)
+
+// Factory creates the naming of a backend registered
+type Factory func(settings Settings, lg *zap.Logger) (naming.Naming, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a backend out of this module available to New. The kubernetes naming is in
+// the module github.com/joeyscat/qim/naming/k8s, so that its dependencies are only required
+// by the programs importing it, and it registers BackendK8s on init.
+func Register(backend string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[backend] = factory
+}
+
+// New creates the naming of settings.Backend. The memory backend is only shared
+// by the services running in the same process, see Settings.SingleProcess.
+func New(settings Settings, lg *zap.Logger) (naming.Naming, error) {
+	switch settings.Backend {
+	case "", BackendEtcd:
+		return etcd.NewNaming(strings.Split(settings.EtcdEndpoints, ","), lg)
+	case BackendConsul:
+		return consul.NewNaming(settings.ConsulAddress, lg)
+	case BackendFile:
+		return file.NewNaming(settings.File, lg)
+	case BackendMemory:
+		if !settings.SingleProcess {
+			return nil, fmt.Errorf("naming backend %s is only for the services in a single process", BackendMemory)
+		}
+		memoryOnce.Do(func() {
+			memoryNaming = memory.NewNaming()
+		})
+		return memoryNaming, nil
+	case BackendDNS:
+		return dns.NewNaming(settings.DNSDomain, lg)
+	default:
+		factoriesMu.RLock()
+		factory, ok := factories[settings.Backend]
+		factoriesMu.RUnlock()
+		if ok {
+			return factory(settings, lg)
+		}
+		if settings.Backend == BackendK8s {
+			return nil, fmt.Errorf("naming backend %s is not registered, import github.com/joeyscat/qim/naming/k8s", BackendK8s)
+		}
+		return nil, fmt.Errorf("unsupported naming backend: %s", settings.Backend)
+	}
+}
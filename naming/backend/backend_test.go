@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joeyscat/qim/naming"
+	"github.com/joeyscat/qim/naming/memory"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestNew(t *testing.T) {
+	lg := zap.NewNop()
+
+	// the services of the other processes are not found in memory
+	_, err := New(Settings{Backend: BackendMemory}, lg)
+	assert.NotNil(t, err)
+
+	n1, err := New(Settings{Backend: BackendMemory, SingleProcess: true}, lg)
+	assert.Nil(t, err)
+	n2, err := New(Settings{Backend: BackendMemory, SingleProcess: true}, lg)
+	assert.Nil(t, err)
+	// the services in the same process share the memory naming
+	assert.Nil(t, n1.Register(naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)))
+	ss, err := n2.Find("hello")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ss))
+
+	path := filepath.Join(t.TempDir(), "naming.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte("services:\n  - {id: s1, name: hello}\n"), 0644))
+	n, err := New(Settings{Backend: BackendFile, File: path}, lg)
+	assert.Nil(t, err)
+	ss, err = n.Find("hello")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ss))
+
+	_, err = New(Settings{Backend: BackendFile, File: filepath.Join(t.TempDir(), "none.yaml")}, lg)
+	assert.NotNil(t, err)
+
+	_, err = New(Settings{Backend: "zookeeper"}, lg)
+	assert.NotNil(t, err)
+	_, err = New(Settings{Backend: BackendK8s}, lg)
+	assert.NotNil(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	var namespace string
+	Register("registered", func(settings Settings, lg *zap.Logger) (naming.Naming, error) {
+		namespace = settings.K8sNamespace
+		return memory.NewNaming(), nil
+	})
+	n, err := New(Settings{Backend: "registered", K8sNamespace: "qim"}, zap.NewNop())
+	assert.Nil(t, err)
+	assert.NotNil(t, n)
+	assert.Equal(t, "qim", namespace)
+}
@@ -0,0 +1,423 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"go.uber.org/zap"
+)
+
+const (
+	// MetaProtocol and MetaNamespace keep the fields of naming.DefaultService without a place in consul
+	MetaProtocol  = "qim_protocol"
+	MetaNamespace = "qim_namespace"
+
+	DefaultTTL             = time.Second * 10
+	DefaultDeregisterAfter = time.Minute
+	DefaultWaitTime        = time.Minute * 5
+	DefaultMinBackoff      = time.Millisecond * 500
+	DefaultMaxBackoff      = time.Second * 30
+
+	retryInterval = time.Second
+)
+
+type CheckType string
+
+const (
+	// CheckTTL is passed by the service itself, it fails if the process is gone
+	CheckTTL CheckType = "ttl"
+	// CheckTCP is passed if the consul agent can connect to the address of the service
+	CheckTCP CheckType = "tcp"
+)
+
+type Options struct {
+	Token string
+	Check CheckType
+	// TTL of CheckTTL, or the interval of CheckTCP
+	TTL time.Duration
+	// DeregisterAfter removes the service after its check is critical for a while
+	DeregisterAfter time.Duration
+	// WaitTime of the blocking queries of Subscribe
+	WaitTime time.Duration
+	// MinBackoff and MaxBackoff bound the interval of registering again after the check is lost
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+type Option func(*Options)
+
+func WithToken(token string) Option {
+	return func(opts *Options) {
+		opts.Token = token
+	}
+}
+
+// WithCheck sets the health check of the services registered
+func WithCheck(check CheckType, ttl time.Duration) Option {
+	return func(opts *Options) {
+		opts.Check = check
+		opts.TTL = ttl
+	}
+}
+
+func WithDeregisterAfter(val time.Duration) Option {
+	return func(opts *Options) {
+		opts.DeregisterAfter = val
+	}
+}
+
+func WithWaitTime(val time.Duration) Option {
+	return func(opts *Options) {
+		opts.WaitTime = val
+	}
+}
+
+func WithBackoff(min, max time.Duration) Option {
+	return func(opts *Options) {
+		opts.MinBackoff = min
+		opts.MaxBackoff = max
+	}
+}
+
+type consulNaming struct {
+	cli     *api.Client
+	options *Options
+	mu      *sync.RWMutex
+	// key: serviceID, value: service
+	registry map[string]qim.ServiceRegistration
+	// key: serviceID, value: cancelFunc of the ttl keepalive
+	keepaliveCancelFunc map[string]context.CancelFunc
+	// key: serviceName, value: cancelFunc for watch
+	watchCancelFunc map[string]context.CancelFunc
+	lg              *zap.Logger
+}
+
+func NewNaming(address string, lg *zap.Logger, opts ...Option) (naming.Naming, error) {
+	options := &Options{
+		Check:           CheckTTL,
+		TTL:             DefaultTTL,
+		DeregisterAfter: DefaultDeregisterAfter,
+		WaitTime:        DefaultWaitTime,
+		MinBackoff:      DefaultMinBackoff,
+		MaxBackoff:      DefaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	config := api.DefaultConfig()
+	config.Address = address
+	config.Token = options.Token
+	cli, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &consulNaming{
+		cli:                 cli,
+		options:             options,
+		mu:                  &sync.RWMutex{},
+		registry:            make(map[string]qim.ServiceRegistration),
+		keepaliveCancelFunc: make(map[string]context.CancelFunc),
+		watchCancelFunc:     make(map[string]context.CancelFunc),
+		lg:                  lg,
+	}
+	return c, nil
+}
+
+var _ naming.Naming = (*consulNaming)(nil)
+
+// Find implements naming.Naming, only the services passing their checks are returned
+func (c *consulNaming) Find(serviceName string, selectors ...naming.Selector) ([]qim.ServiceRegistration, error) {
+	services, _, err := c.find(context.Background(), serviceName, selectors, 0)
+	return services, err
+}
+
+// find filters the tags by consul, and the meta by the selectors
+func (c *consulNaming) find(ctx context.Context, serviceName string, selectors []naming.Selector, index uint64) ([]qim.ServiceRegistration, uint64, error) {
+	q := (&api.QueryOptions{WaitIndex: index, WaitTime: c.options.WaitTime}).WithContext(ctx)
+	entries, meta, err := c.cli.Health().ServiceMultipleTags(serviceName, naming.SelectedTags(selectors...), true, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	services := make([]qim.ServiceRegistration, 0, len(entries))
+	for _, entry := range entries {
+		if s := fromAgentService(entry.Service); naming.MatchSelectors(s, selectors...) {
+			services = append(services, s)
+		}
+	}
+	return services, meta.LastIndex, nil
+}
+
+// Register implements naming.Naming
+func (c *consulNaming) Register(service qim.ServiceRegistration) error {
+	c.lg.Info("register service", zap.String("service", service.String()))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.registry[service.ServiceID()]; ok {
+		return fmt.Errorf("service already registered: %s", service.ServiceID())
+	}
+
+	if err := c.register(service); err != nil {
+		return err
+	}
+	if c.options.Check == CheckTTL {
+		ctx, cancel := context.WithCancel(context.Background())
+		c.keepaliveCancelFunc[service.ServiceID()] = cancel
+		go c.keepalive(ctx, service.ServiceID())
+	}
+
+	c.registry[service.ServiceID()] = service
+	return nil
+}
+
+// register the service with its check in the agent
+func (c *consulNaming) register(service qim.ServiceRegistration) error {
+	reg := toRegistration(service)
+	reg.Check = c.check(service)
+	if err := c.cli.Agent().ServiceRegister(reg); err != nil {
+		return err
+	}
+	if c.options.Check == CheckTTL {
+		// pass the check at once, or the service is not found until the first keepalive
+		return c.cli.Agent().UpdateTTL(checkIDOf(service.ServiceID()), "", api.HealthPassing)
+	}
+	return nil
+}
+
+// Update implements naming.Naming, the service is registered again with its check
+func (c *consulNaming) Update(service qim.ServiceRegistration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.registry[service.ServiceID()]; !ok {
+		return fmt.Errorf("service not registered: %s", service.ServiceID())
+	}
+	reg := toRegistration(service)
+	reg.Check = c.check(service)
+	if err := c.cli.Agent().ServiceRegister(reg); err != nil {
+		return err
+	}
+	c.registry[service.ServiceID()] = service
+	return nil
+}
+
+// Deregister implements naming.Naming
+func (c *consulNaming) Deregister(serviceID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.registry[serviceID]; !ok {
+		return errors.New("ServiceID  Not  Found")
+	}
+	delete(c.registry, serviceID)
+	if cancel, ok := c.keepaliveCancelFunc[serviceID]; ok {
+		cancel()
+		delete(c.keepaliveCancelFunc, serviceID)
+	}
+	return c.cli.Agent().ServiceDeregister(serviceID)
+}
+
+// Subscribe implements naming.Naming, the changes after it are watched by blocking queries
+func (c *consulNaming) Subscribe(serviceName string, callback func(services []qim.ServiceRegistration), selectors ...naming.Selector) error {
+	_, index, err := c.find(context.Background(), serviceName, selectors, 0)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if cancel, ok := c.watchCancelFunc[serviceName]; ok {
+		cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.watchCancelFunc[serviceName] = cancel
+	c.mu.Unlock()
+
+	go c.watch(ctx, serviceName, selectors, index, callback)
+	return nil
+}
+
+func (c *consulNaming) watch(ctx context.Context, serviceName string, selectors []naming.Selector, index uint64, callback func([]qim.ServiceRegistration)) {
+	log := c.lg.With(zap.String("func", "watch"), zap.String("serviceName", serviceName))
+	for {
+		services, lastIndex, err := c.find(ctx, serviceName, selectors, index)
+		if ctx.Err() != nil {
+			log.Info("subscribe over")
+			return
+		}
+		if err != nil {
+			log.Warn("blocking query failed", zap.Error(err))
+			select {
+			case <-time.After(retryInterval):
+				continue
+			case <-ctx.Done():
+				log.Info("subscribe over")
+				return
+			}
+		}
+		switch {
+		case lastIndex < index:
+			// the index went backwards, such as the consul servers are restored, start over
+			index = 0
+			continue
+		case lastIndex == index:
+			// the wait time passed without any change
+			continue
+		}
+		index = lastIndex
+		callback(services)
+	}
+}
+
+// Unsubscribe implements naming.Naming
+func (c *consulNaming) Unsubscribe(serviceName string) error {
+	c.mu.Lock()
+	cancel, ok := c.watchCancelFunc[serviceName]
+	delete(c.watchCancelFunc, serviceName)
+	c.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return nil
+}
+
+// keepalive passes the ttl check every ttl/2, the service is registered again if the agent has lost
+// its check, such as the agent restarted without its state or removed the service after DeregisterAfter
+func (c *consulNaming) keepalive(ctx context.Context, serviceID string) {
+	log := c.lg.With(zap.String("func", "keepalive"), zap.String("serviceID", serviceID))
+	checkID := checkIDOf(serviceID)
+	ticker := time.NewTicker(c.options.TTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		err := c.cli.Agent().UpdateTTL(checkID, "", api.HealthPassing)
+		if err == nil {
+			continue
+		}
+		if !isCheckNotFound(err) {
+			log.Warn("update ttl failed", zap.Error(err))
+			continue
+		}
+
+		log.Warn("check lost, register again", zap.Error(err))
+		if !c.reregister(ctx, serviceID) {
+			return
+		}
+	}
+}
+
+// reregister registers the service with backoff until it succeeds, the service is deregistered
+// or ctx is done, false is returned in the latter cases.
+func (c *consulNaming) reregister(ctx context.Context, serviceID string) bool {
+	log := c.lg.With(zap.String("func", "reregister"), zap.String("serviceID", serviceID))
+	backoff := c.options.MinBackoff
+	for {
+		// the latest meta is registered, and a deregister in the meantime is waited for
+		c.mu.Lock()
+		service, ok := c.registry[serviceID]
+		if !ok || ctx.Err() != nil {
+			c.mu.Unlock()
+			return false
+		}
+		err := c.register(service)
+		c.mu.Unlock()
+		if err == nil {
+			log.Info("registered again")
+			return true
+		}
+
+		log.Warn("register again failed", zap.Duration("backoff", backoff), zap.Error(err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return false
+		}
+		backoff *= 2
+		if backoff > c.options.MaxBackoff {
+			backoff = c.options.MaxBackoff
+		}
+	}
+}
+
+// isCheckNotFound reports whether the agent does not know the check, the older agents
+// respond to it with 500 and "Unknown check" rather than 404
+func isCheckNotFound(err error) bool {
+	var statusErr api.StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.Code == http.StatusNotFound || strings.Contains(statusErr.Body, "Unknown check")
+}
+
+func (c *consulNaming) check(service qim.ServiceRegistration) *api.AgentServiceCheck {
+	check := &api.AgentServiceCheck{
+		CheckID:                        checkIDOf(service.ServiceID()),
+		DeregisterCriticalServiceAfter: c.options.DeregisterAfter.String(),
+	}
+	switch c.options.Check {
+	case CheckTCP:
+		check.TCP = fmt.Sprintf("%s:%d", service.PublicAddress(), service.PublicPort())
+		check.Interval = c.options.TTL.String()
+	default:
+		check.TTL = c.options.TTL.String()
+	}
+	return check
+}
+
+func checkIDOf(serviceID string) string {
+	return "service:" + serviceID
+}
+
+func toRegistration(service qim.ServiceRegistration) *api.AgentServiceRegistration {
+	meta := make(map[string]string, len(service.GetMeta())+2)
+	for k, v := range service.GetMeta() {
+		meta[k] = v
+	}
+	if service.GetProtocol() != "" {
+		meta[MetaProtocol] = service.GetProtocol()
+	}
+	if service.GetNamespace() != "" {
+		meta[MetaNamespace] = service.GetNamespace()
+	}
+	return &api.AgentServiceRegistration{
+		ID:      service.ServiceID(),
+		Name:    service.ServiceName(),
+		Address: service.PublicAddress(),
+		Port:    int(service.PublicPort()),
+		Tags:    service.GetTags(),
+		Meta:    meta,
+	}
+}
+
+func fromAgentService(s *api.AgentService) *naming.DefaultService {
+	meta := make(map[string]string, len(s.Meta))
+	for k, v := range s.Meta {
+		meta[k] = v
+	}
+	protocol := meta[MetaProtocol]
+	namespace := meta[MetaNamespace]
+	delete(meta, MetaProtocol)
+	delete(meta, MetaNamespace)
+
+	return &naming.DefaultService{
+		ID:        s.ID,
+		Name:      s.Service,
+		Address:   s.Address,
+		Port:      uint16(s.Port),
+		Protocol:  protocol,
+		Namespace: namespace,
+		Tags:      s.Tags,
+		Meta:      meta,
+	}
+}
@@ -0,0 +1,406 @@
+package consul
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeConsul serves the part of the consul http api used by consulNaming
+type fakeConsul struct {
+	sync.Mutex
+	index    uint64
+	changed  chan struct{}
+	services map[string]*api.AgentServiceRegistration
+	// key: checkID, value: status
+	checks  map[string]string
+	updates int
+	// registrations are failed while it is positive
+	failures int
+	// registrations tried
+	registers int
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		index:    1,
+		changed:  make(chan struct{}),
+		services: make(map[string]*api.AgentServiceRegistration),
+		checks:   make(map[string]string),
+	}
+}
+
+// bump must be called with the lock held
+func (f *fakeConsul) bump() {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/v1/agent/service/register":
+		var reg api.AgentServiceRegistration
+		if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.Lock()
+		f.registers++
+		if f.failures > 0 {
+			f.failures--
+			f.Unlock()
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.services[reg.ID] = &reg
+		if _, ok := f.checks[reg.Check.CheckID]; !ok {
+			f.checks[reg.Check.CheckID] = api.HealthCritical
+		}
+		f.bump()
+		f.Unlock()
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/")
+		f.Lock()
+		delete(f.services, id)
+		delete(f.checks, checkIDOf(id))
+		f.bump()
+		f.Unlock()
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/update/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/agent/check/update/")
+		var update struct{ Status string }
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.Lock()
+		defer f.Unlock()
+		if _, ok := f.checks[id]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.updates++
+		if f.checks[id] != update.Status {
+			f.checks[id] = update.Status
+			f.bump()
+		}
+	case strings.HasPrefix(r.URL.Path, "/v1/health/service/"):
+		f.health(w, r)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeConsul) health(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/v1/health/service/")
+	query := r.URL.Query()
+	index, _ := strconv.ParseUint(query.Get("index"), 10, 64)
+
+	f.Lock()
+	if index > 0 && index == f.index {
+		changed := f.changed
+		f.Unlock()
+		select {
+		case <-changed:
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+			return
+		}
+		f.Lock()
+	}
+	defer f.Unlock()
+
+	entries := make([]*api.ServiceEntry, 0)
+	for _, reg := range f.services {
+		if reg.Name != name {
+			continue
+		}
+		if query.Get("passing") == "1" && f.checks[reg.Check.CheckID] != api.HealthPassing {
+			continue
+		}
+		if !hasTags(reg.Tags, query["tag"]) {
+			continue
+		}
+		entries = append(entries, &api.ServiceEntry{
+			Service: &api.AgentService{
+				ID:      reg.ID,
+				Service: reg.Name,
+				Address: reg.Address,
+				Port:    reg.Port,
+				Tags:    reg.Tags,
+				Meta:    reg.Meta,
+			},
+		})
+	}
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+func hasTags(tags []string, want []string) bool {
+	for _, t := range want {
+		found := false
+		for _, tag := range tags {
+			if tag == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func newTestNaming(t *testing.T, opts ...Option) (naming.Naming, *fakeConsul) {
+	fake := newFakeConsul()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	n, err := NewNaming(strings.TrimPrefix(srv.URL, "http://"), zap.NewNop(), opts...)
+	assert.Nil(t, err)
+	return n, fake
+}
+
+func Test_consulNaming_Register(t *testing.T) {
+	n, _ := newTestNaming(t)
+
+	s1 := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+	s2 := naming.NewEntry("s2", "hello", "tcp", "127.0.0.1", 8002)
+	s1Dup := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+
+	ss, err := n.Find("hello")
+	assert.Nil(t, err)
+	assert.Empty(t, ss)
+
+	err = n.Register(s1)
+	assert.Nil(t, err)
+	err = n.Register(s1Dup)
+	assert.NotNil(t, err)
+	err = n.Register(s2)
+	assert.Nil(t, err)
+
+	ss, err = n.Find("hello")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ss))
+
+	err = n.Deregister(s2.ServiceID())
+	assert.Nil(t, err)
+	err = n.Deregister(s2.ServiceID())
+	assert.NotNil(t, err)
+
+	ss, err = n.Find("hello")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ss))
+	assert.Equal(t, "s1", ss[0].ServiceID())
+}
+
+func Test_consulNaming_Mapping(t *testing.T) {
+	n, _ := newTestNaming(t)
+
+	s1 := &naming.DefaultService{
+		ID:        "s1",
+		Name:      "chat",
+		Address:   "10.0.0.1",
+		Port:      8005,
+		Protocol:  "ws",
+		Namespace: "qim",
+		Tags:      []string{"IDC:SH_ALI", "dev"},
+		Meta:      map[string]string{"domain": "ws://10.0.0.1:8005"},
+	}
+	err := n.Register(s1)
+	assert.Nil(t, err)
+
+	ss, err := n.Find("chat")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ss))
+	assert.Equal(t, s1, ss[0])
+}
+
+func Test_consulNaming_FindTags(t *testing.T) {
+	n, _ := newTestNaming(t)
+
+	s1 := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+	s1.Tags = []string{"a", "b"}
+	s2 := naming.NewEntry("s2", "hello", "tcp", "127.0.0.1", 8002)
+	s2.Tags = []string{"a"}
+	assert.Nil(t, n.Register(s1))
+	assert.Nil(t, n.Register(s2))
+
+	ss, err := n.Find("hello", naming.Tags("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ss))
+
+	ss, err = n.Find("hello", naming.Tags("a", "b"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ss))
+	assert.Equal(t, "s1", ss[0].ServiceID())
+
+	ss, err = n.Find("hello", naming.Tags("c"))
+	assert.Nil(t, err)
+	assert.Empty(t, ss)
+}
+
+func Test_consulNaming_TTL(t *testing.T) {
+	n, fake := newTestNaming(t, WithCheck(CheckTTL, time.Millisecond*100))
+
+	s1 := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+	assert.Nil(t, n.Register(s1))
+
+	time.Sleep(time.Millisecond * 300)
+	fake.Lock()
+	updates := fake.updates
+	fake.Unlock()
+	// the first update on register, then every ttl/2
+	assert.GreaterOrEqual(t, updates, 3)
+
+	assert.Nil(t, n.Deregister(s1.ServiceID()))
+	time.Sleep(time.Millisecond * 100)
+	fake.Lock()
+	updates = fake.updates
+	fake.Unlock()
+	time.Sleep(time.Millisecond * 200)
+	fake.Lock()
+	assert.Equal(t, updates, fake.updates)
+	fake.Unlock()
+}
+
+func Test_consulNaming_Subscribe(t *testing.T) {
+	n, _ := newTestNaming(t)
+
+	s1 := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+	s2 := naming.NewEntry("s2", "hello", "tcp", "127.0.0.1", 8002)
+	assert.Nil(t, n.Register(s1))
+
+	ch := make(chan []qim.ServiceRegistration, 10)
+	err := n.Subscribe("hello", func(services []qim.ServiceRegistration) {
+		ch <- services
+	})
+	assert.Nil(t, err)
+
+	// no callback without any change
+	select {
+	case <-ch:
+		t.Fatal("unexpected callback")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	assert.Nil(t, n.Register(s2))
+	ss := waitServices(t, ch, 2)
+	assert.Equal(t, 2, len(ss))
+
+	assert.Nil(t, n.Deregister(s1.ServiceID()))
+	ss = waitServices(t, ch, 1)
+	assert.Equal(t, "s2", ss[0].ServiceID())
+
+	assert.Nil(t, n.Unsubscribe("hello"))
+	time.Sleep(time.Millisecond * 100)
+	for len(ch) > 0 {
+		<-ch
+	}
+	assert.Nil(t, n.Deregister(s2.ServiceID()))
+	select {
+	case <-ch:
+		t.Fatal("callback after unsubscribe")
+	case <-time.After(time.Millisecond * 300):
+	}
+}
+
+// waitServices waits for the callback with count services, the updates between are skipped
+func waitServices(t *testing.T, ch chan []qim.ServiceRegistration, count int) []qim.ServiceRegistration {
+	timeout := time.After(time.Second * 3)
+	for {
+		select {
+		case ss := <-ch:
+			if len(ss) == count {
+				return ss
+			}
+		case <-timeout:
+			t.Fatalf("no callback with %d services", count)
+			return nil
+		}
+	}
+}
+
+func Test_consulNaming_Update(t *testing.T) {
+	n, _ := newTestNaming(t)
+
+	s1 := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+	assert.NotNil(t, n.Update(s1))
+	assert.Nil(t, n.Register(s1))
+
+	ch := make(chan []qim.ServiceRegistration, 10)
+	err := n.Subscribe("hello", func(services []qim.ServiceRegistration) {
+		ch <- services
+	})
+	assert.Nil(t, err)
+
+	s1Updated := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+	s1Updated.Meta = map[string]string{"load_channels": "100"}
+	assert.Nil(t, n.Update(s1Updated))
+
+	// the subscriber is called back with the meta changed
+	timeout := time.After(time.Second * 3)
+	for {
+		select {
+		case ss := <-ch:
+			if len(ss) == 1 && ss[0].GetMeta()["load_channels"] == "100" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("no callback with the meta changed")
+		}
+	}
+}
+
+func Test_consulNaming_Reregister(t *testing.T) {
+	n, fake := newTestNaming(t, WithCheck(CheckTTL, time.Millisecond*100), WithBackoff(time.Millisecond*10, time.Millisecond*40))
+
+	s1 := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+	assert.Nil(t, n.Register(s1))
+	s1Updated := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+	s1Updated.Meta = map[string]string{"load_channels": "100"}
+	assert.Nil(t, n.Update(s1Updated))
+
+	// the agent restarts without its state, and fails the first registrations
+	fake.Lock()
+	delete(fake.services, "s1")
+	delete(fake.checks, checkIDOf("s1"))
+	fake.failures = 2
+	registers := fake.registers
+	fake.bump()
+	fake.Unlock()
+
+	assert.Eventually(t, func() bool {
+		ss, err := n.Find("hello")
+		return err == nil && len(ss) == 1
+	}, time.Second*3, time.Millisecond*20)
+	ss, _ := n.Find("hello")
+	// the latest meta is registered
+	assert.Equal(t, "100", ss[0].GetMeta()["load_channels"])
+	fake.Lock()
+	assert.Equal(t, registers+3, fake.registers)
+	fake.Unlock()
+
+	// no more registrations after the service is deregistered
+	assert.Nil(t, n.Deregister(s1.ServiceID()))
+	fake.Lock()
+	registers = fake.registers
+	fake.Unlock()
+	time.Sleep(time.Millisecond * 200)
+	fake.Lock()
+	assert.Equal(t, registers, fake.registers)
+	fake.Unlock()
+}
@@ -0,0 +1,263 @@
+// Package dns implements a read-only naming.Naming with the SRV records of _service._proto.domain,
+// the TXT records of the SRV target keep the rest of the service, a key=value in each record:
+//
+//	_chat._tcp.qim.local.  SRV 0 100 8005 chat01.qim.local.
+//	chat01.qim.local.      TXT "id=chat01"
+//	chat01.qim.local.      TXT "tags=IDC:SH_ALI,dev"
+//	chat01.qim.local.      TXT "zone=zone_03"
+//
+// id, tags, protocol and namespace are the fields of naming.DefaultService, the others are its meta.
+// The records are managed by the DNS server, so Register and Deregister change nothing.
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"go.uber.org/zap"
+)
+
+const (
+	TxtID        = "id"
+	TxtTags      = "tags"
+	TxtProtocol  = "protocol"
+	TxtNamespace = "namespace"
+
+	DefaultProto    = "tcp"
+	DefaultInterval = time.Second * 10
+	DefaultTimeout  = time.Second * 5
+)
+
+type Options struct {
+	Resolver *net.Resolver
+	// Proto of the SRV records, tcp or udp
+	Proto string
+	// Interval of polling the records for Subscribe
+	Interval time.Duration
+	// Timeout of a lookup
+	Timeout time.Duration
+}
+
+type Option func(*Options)
+
+func WithResolver(resolver *net.Resolver) Option {
+	return func(opts *Options) {
+		opts.Resolver = resolver
+	}
+}
+
+func WithProto(proto string) Option {
+	return func(opts *Options) {
+		opts.Proto = proto
+	}
+}
+
+func WithInterval(val time.Duration) Option {
+	return func(opts *Options) {
+		opts.Interval = val
+	}
+}
+
+func WithTimeout(val time.Duration) Option {
+	return func(opts *Options) {
+		opts.Timeout = val
+	}
+}
+
+type dnsNaming struct {
+	domain  string
+	options *Options
+	mu      sync.Mutex
+	// key: serviceName, value: cancelFunc for watch
+	watchCancelFunc map[string]context.CancelFunc
+	lg              *zap.Logger
+}
+
+// NewNaming looks up the services under domain, such as qim.local
+func NewNaming(domain string, lg *zap.Logger, opts ...Option) (naming.Naming, error) {
+	if domain == "" {
+		return nil, errors.New("domain is required")
+	}
+	options := &Options{
+		Resolver: net.DefaultResolver,
+		Proto:    DefaultProto,
+		Interval: DefaultInterval,
+		Timeout:  DefaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &dnsNaming{
+		domain:          domain,
+		options:         options,
+		watchCancelFunc: make(map[string]context.CancelFunc),
+		lg:              lg,
+	}, nil
+}
+
+var _ naming.Naming = (*dnsNaming)(nil)
+
+// Find implements naming.Naming, the services are sorted by ID
+func (d *dnsNaming) Find(serviceName string, selectors ...naming.Selector) ([]qim.ServiceRegistration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.options.Timeout)
+	defer cancel()
+	return d.find(ctx, serviceName, selectors)
+}
+
+func (d *dnsNaming) find(ctx context.Context, serviceName string, selectors []naming.Selector) ([]qim.ServiceRegistration, error) {
+	_, addrs, err := d.options.Resolver.LookupSRV(ctx, serviceName, d.options.Proto, d.domain)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var services []qim.ServiceRegistration
+	for _, addr := range addrs {
+		txts, err := d.options.Resolver.LookupTXT(ctx, addr.Target)
+		if err != nil && !isNotFound(err) {
+			return nil, err
+		}
+		s := parseService(serviceName, d.options.Proto, addr, txts)
+		if naming.MatchSelectors(s, selectors...) {
+			services = append(services, s)
+		}
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].ServiceID() < services[j].ServiceID()
+	})
+	return services, nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+func parseService(serviceName, proto string, addr *net.SRV, txts []string) *naming.DefaultService {
+	host := strings.TrimSuffix(addr.Target, ".")
+	s := &naming.DefaultService{
+		ID:       fmt.Sprintf("%s-%d", host, addr.Port),
+		Name:     serviceName,
+		Address:  host,
+		Port:     addr.Port,
+		Protocol: proto,
+		Meta:     make(map[string]string),
+	}
+	for _, txt := range txts {
+		key, value, ok := strings.Cut(txt, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case TxtID:
+			s.ID = value
+		case TxtTags:
+			s.Tags = strings.Split(value, ",")
+		case TxtProtocol:
+			s.Protocol = value
+		case TxtNamespace:
+			s.Namespace = value
+		default:
+			s.Meta[key] = value
+		}
+	}
+	return s
+}
+
+// Register implements naming.Naming, the records are managed by the DNS server
+func (d *dnsNaming) Register(service qim.ServiceRegistration) error {
+	d.lg.Info("register is skipped by dns naming", zap.String("service", service.String()))
+	return nil
+}
+
+// Deregister implements naming.Naming, the records are managed by the DNS server
+func (d *dnsNaming) Deregister(serviceID string) error {
+	d.lg.Info("deregister is skipped by dns naming", zap.String("serviceID", serviceID))
+	return nil
+}
+
+// Update implements naming.Naming, the records are managed by the DNS server
+func (d *dnsNaming) Update(service qim.ServiceRegistration) error {
+	return nil
+}
+
+// Subscribe implements naming.Naming, the records are polled and the callback is called if they are changed
+func (d *dnsNaming) Subscribe(serviceName string, callback func(services []qim.ServiceRegistration), selectors ...naming.Selector) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if cancel, ok := d.watchCancelFunc[serviceName]; ok {
+		cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.watchCancelFunc[serviceName] = cancel
+
+	go d.watch(ctx, serviceName, callback, selectors)
+	return nil
+}
+
+func (d *dnsNaming) watch(ctx context.Context, serviceName string, callback func([]qim.ServiceRegistration), selectors []naming.Selector) {
+	log := d.lg.With(zap.String("func", "watch"), zap.String("serviceName", serviceName))
+	last, err := d.Find(serviceName, selectors...)
+	if err != nil {
+		log.Warn("lookup failed", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(d.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Info("subscribe over")
+			return
+		}
+
+		lookupCtx, cancel := context.WithTimeout(ctx, d.options.Timeout)
+		services, err := d.find(lookupCtx, serviceName, selectors)
+		cancel()
+		if ctx.Err() != nil {
+			log.Info("subscribe over")
+			return
+		}
+		if err != nil {
+			// the services found last are kept if the DNS server is unavailable
+			log.Warn("lookup failed", zap.Error(err))
+			continue
+		}
+		if reflect.DeepEqual(services, last) {
+			continue
+		}
+		last = services
+		// the callback gets copies, the meta of the services may be changed by the subscriber
+		copies := make([]qim.ServiceRegistration, 0, len(services))
+		for _, s := range services {
+			copies = append(copies, naming.Copy(s))
+		}
+		callback(copies)
+	}
+}
+
+// Unsubscribe implements naming.Naming
+func (d *dnsNaming) Unsubscribe(serviceName string) error {
+	d.mu.Lock()
+	cancel, ok := d.watchCancelFunc[serviceName]
+	delete(d.watchCancelFunc, serviceName)
+	d.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// stubServer answers the SRV and TXT queries with the records in memory
+type stubServer struct {
+	sync.Mutex
+	conn net.PacketConn
+	// key: name of the records
+	srvs map[string][]dnsmessage.SRVResource
+	txts map[string][]string
+}
+
+func newStubServer(t *testing.T) *stubServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &stubServer{
+		conn: conn,
+		srvs: make(map[string][]dnsmessage.SRVResource),
+		txts: make(map[string][]string),
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *stubServer) setSRV(name string, srvs ...dnsmessage.SRVResource) {
+	s.Lock()
+	defer s.Unlock()
+	s.srvs[name] = srvs
+}
+
+func (s *stubServer) setTXT(name string, txt ...string) {
+	s.Lock()
+	defer s.Unlock()
+	s.txts[name] = txt
+}
+
+func (s *stubServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var parser dnsmessage.Parser
+		header, err := parser.Start(buf[:n])
+		if err != nil {
+			continue
+		}
+		question, err := parser.Question()
+		if err != nil {
+			continue
+		}
+		resp, err := s.answer(header, question)
+		if err != nil {
+			continue
+		}
+		_, _ = s.conn.WriteTo(resp, addr)
+	}
+}
+
+func (s *stubServer) answer(header dnsmessage.Header, q dnsmessage.Question) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	name := strings.ToLower(q.Name.String())
+	srvs, hasSRV := s.srvs[name]
+	txts, hasTXT := s.txts[name]
+
+	rh := dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true, RecursionDesired: header.RecursionDesired}
+	if !hasSRV && !hasTXT {
+		rh.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, rh)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	rrh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 1}
+	switch {
+	case q.Type == dnsmessage.TypeSRV && hasSRV:
+		for _, srv := range srvs {
+			if err := b.SRVResource(rrh, srv); err != nil {
+				return nil, err
+			}
+		}
+	case q.Type == dnsmessage.TypeTXT && hasTXT:
+		for _, txt := range txts {
+			if err := b.TXTResource(rrh, dnsmessage.TXTResource{TXT: []string{txt}}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
+
+func (s *stubServer) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+		},
+	}
+}
+
+func srv(target string, port uint16) dnsmessage.SRVResource {
+	return dnsmessage.SRVResource{
+		Priority: 0,
+		Weight:   100,
+		Port:     port,
+		Target:   dnsmessage.MustNewName(target),
+	}
+}
+
+func Test_dnsNaming_Find(t *testing.T) {
+	stub := newStubServer(t)
+	stub.setSRV("_chat._tcp.qim.local.", srv("chat01.qim.local.", 8005), srv("chat02.qim.local.", 8005))
+	stub.setTXT("chat01.qim.local.", "id=chat01", "tags=IDC:SH_ALI,dev", "protocol=tcp", "namespace=qim", "zone=zone_03")
+	stub.setSRV("_wgateway._tcp.qim.local.", srv("gate01.qim.local.", 8000))
+	stub.setTXT("gate01.qim.local.", "protocol=ws", "domain=ws://gate01.qim.local:8000")
+
+	n, err := NewNaming("qim.local.", zap.NewNop(), WithResolver(stub.resolver()))
+	assert.Nil(t, err)
+
+	ss, err := n.Find("chat")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ss))
+	assert.Equal(t, &naming.DefaultService{
+		ID:        "chat01",
+		Name:      "chat",
+		Address:   "chat01.qim.local",
+		Port:      8005,
+		Protocol:  "tcp",
+		Namespace: "qim",
+		Tags:      []string{"IDC:SH_ALI", "dev"},
+		Meta:      map[string]string{"zone": "zone_03"},
+	}, ss[0])
+	// the ID is made of the target and port without the TXT record of id
+	assert.Equal(t, "chat02.qim.local-8005", ss[1].ServiceID())
+	assert.Empty(t, ss[1].GetMeta())
+
+	ss, err = n.Find("chat", naming.Tags("dev"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ss))
+
+	ss, err = n.Find("wgateway")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ss))
+	assert.Equal(t, "ws://gate01.qim.local:8000", ss[0].DialURL())
+	assert.Equal(t, "ws://gate01.qim.local:8000", ss[0].GetMeta()["domain"])
+
+	ss, err = n.Find("login")
+	assert.Nil(t, err)
+	assert.Empty(t, ss)
+
+	// nothing is changed by register
+	assert.Nil(t, n.Register(naming.NewEntry("login01", "login", "tcp", "127.0.0.1", 8003)))
+	ss, _ = n.Find("login")
+	assert.Empty(t, ss)
+	assert.Nil(t, n.Deregister("chat01"))
+	ss, _ = n.Find("chat")
+	assert.Equal(t, 2, len(ss))
+}
+
+func Test_dnsNaming_Subscribe(t *testing.T) {
+	stub := newStubServer(t)
+	stub.setSRV("_chat._tcp.qim.local.", srv("chat01.qim.local.", 8005))
+
+	n, err := NewNaming("qim.local.", zap.NewNop(), WithResolver(stub.resolver()), WithInterval(time.Millisecond*20))
+	assert.Nil(t, err)
+
+	ch := make(chan []qim.ServiceRegistration, 10)
+	err = n.Subscribe("chat", func(services []qim.ServiceRegistration) {
+		// the subscriber changes the meta like the container
+		for _, s := range services {
+			s.GetMeta()["state"] = "young"
+		}
+		ch <- services
+	})
+	assert.Nil(t, err)
+
+	// no callback without any change
+	select {
+	case <-ch:
+		t.Fatal("unexpected callback")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	stub.setSRV("_chat._tcp.qim.local.", srv("chat01.qim.local.", 8005), srv("chat02.qim.local.", 8005))
+	select {
+	case ss := <-ch:
+		assert.Equal(t, 2, len(ss))
+	case <-time.After(time.Second):
+		t.Fatal("no callback")
+	}
+
+	// a change of the meta is notified too
+	stub.setTXT("chat02.qim.local.", "zone=zone_04")
+	select {
+	case ss := <-ch:
+		assert.Equal(t, "zone_04", ss[1].GetMeta()["zone"])
+	case <-time.After(time.Second):
+		t.Fatal("no callback")
+	}
+	select {
+	case <-ch:
+		t.Fatal("unexpected callback")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	assert.Nil(t, n.Unsubscribe("chat"))
+	time.Sleep(time.Millisecond * 50)
+	stub.setSRV("_chat._tcp.qim.local.")
+	select {
+	case <-ch:
+		t.Fatal("callback after unsubscribe")
+	case <-time.After(time.Millisecond * 100):
+	}
+}
@@ -0,0 +1,224 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// fakeEtcd keeps the keys and leases in memory, a key is deleted with its lease
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Lease
+
+	sync.Mutex
+	nextLease clientv3.LeaseID
+	// key: key, value: value
+	kvs map[string]string
+	// key: key, value: lease of the key
+	keyLeases map[string]clientv3.LeaseID
+	// key: lease, value: keepalive channel
+	keepalives map[clientv3.LeaseID]chan *clientv3.LeaseKeepAliveResponse
+	revoked    []clientv3.LeaseID
+	// grantErrors is the count of the next grants failing
+	grantErrors int
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{
+		kvs:        make(map[string]string),
+		keyLeases:  make(map[string]clientv3.LeaseID),
+		keepalives: make(map[clientv3.LeaseID]chan *clientv3.LeaseKeepAliveResponse),
+	}
+}
+
+func (f *fakeEtcd) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.grantErrors > 0 {
+		f.grantErrors--
+		return nil, errors.New("etcdserver: request timed out")
+	}
+	f.nextLease++
+	return &clientv3.LeaseGrantResponse{ID: f.nextLease, TTL: ttl}, nil
+}
+
+// Put attaches the key to the lease granted last, as Register puts the key right after the grant
+func (f *fakeEtcd) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.kvs[key] = val
+	f.keyLeases[key] = f.nextLease
+	return &clientv3.PutResponse{}, nil
+}
+
+func (f *fakeEtcd) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	delete(f.kvs, key)
+	delete(f.keyLeases, key)
+	return &clientv3.DeleteResponse{}, nil
+}
+
+func (f *fakeEtcd) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	ch := make(chan *clientv3.LeaseKeepAliveResponse, 1)
+	ch <- &clientv3.LeaseKeepAliveResponse{ID: id}
+	f.keepalives[id] = ch
+	go func() {
+		<-ctx.Done()
+		f.expire(id)
+	}()
+	return ch, nil
+}
+
+func (f *fakeEtcd) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	f.Lock()
+	f.revoked = append(f.revoked, id)
+	f.Unlock()
+	f.expire(id)
+	return &clientv3.LeaseRevokeResponse{}, nil
+}
+
+// expire deletes the keys of the lease and closes its keepalive channel
+func (f *fakeEtcd) expire(id clientv3.LeaseID) {
+	f.Lock()
+	defer f.Unlock()
+	for key, lease := range f.keyLeases {
+		if lease == id {
+			delete(f.kvs, key)
+			delete(f.keyLeases, key)
+		}
+	}
+	if ch, ok := f.keepalives[id]; ok {
+		close(ch)
+		delete(f.keepalives, id)
+	}
+}
+
+func (f *fakeEtcd) leaseOf(key string) (clientv3.LeaseID, bool) {
+	f.Lock()
+	defer f.Unlock()
+	lease, ok := f.keyLeases[key]
+	return lease, ok
+}
+
+func newFakeNaming(f *fakeEtcd) *etcdNaming {
+	return &etcdNaming{
+		kv:    f,
+		lease: f,
+		options: &Options{
+			TTL:        DefaultTTL,
+			MinBackoff: time.Millisecond * 10,
+			MaxBackoff: time.Millisecond * 40,
+		},
+		mu:                  &sync.RWMutex{},
+		registry:            make(map[string]qim.ServiceRegistration),
+		leases:              make(map[string]clientv3.LeaseID),
+		keepaliveCancelFunc: make(map[string]context.CancelFunc),
+		watchCallback:       make(map[string]func([]qim.ServiceRegistration)),
+		watchCancelFunc:     make(map[string]context.CancelFunc),
+		lg:                  zap.NewNop(),
+	}
+}
+
+func Test_etcdNaming_Deregister_Revoke(t *testing.T) {
+	f := newFakeEtcd()
+	n := newFakeNaming(f)
+
+	s1 := naming.NewEntry("lease_s1", "lease_hello", "tcp", "127.0.0.1", 8001)
+	assert.Nil(t, n.Register(s1))
+	lease, ok := f.leaseOf(keyOf(s1))
+	assert.True(t, ok)
+	assert.Equal(t, lease, n.leases[s1.ServiceID()])
+	assert.Equal(t, float64(1), testutil.ToFloat64(registrationUp.WithLabelValues("lease_hello", "lease_s1")))
+
+	assert.Nil(t, n.Deregister(s1.ServiceID()))
+	_, ok = f.leaseOf(keyOf(s1))
+	assert.False(t, ok)
+	assert.Equal(t, []clientv3.LeaseID{lease}, f.revoked)
+	assert.Empty(t, n.leases)
+	assert.Empty(t, n.keepaliveCancelFunc)
+}
+
+func Test_etcdNaming_Reregister(t *testing.T) {
+	f := newFakeEtcd()
+	n := newFakeNaming(f)
+
+	lost := testutil.ToFloat64(leaseLostTotal.WithLabelValues("lease_world"))
+	failed := testutil.ToFloat64(reregisterTotal.WithLabelValues("lease_world", "failed"))
+	succeeded := testutil.ToFloat64(reregisterTotal.WithLabelValues("lease_world", "ok"))
+
+	s1 := naming.NewEntry("lease_s2", "lease_world", "tcp", "127.0.0.1", 8001)
+	assert.Nil(t, n.Register(s1))
+	lease, _ := f.leaseOf(keyOf(s1))
+
+	// the meta updated while the lease is lost is registered again
+	f.Lock()
+	f.grantErrors = 3
+	f.Unlock()
+	f.expire(lease)
+	s1Updated := naming.NewEntry("lease_s2", "lease_world", "tcp", "127.0.0.1", 8001)
+	s1Updated.Meta = map[string]string{"load": "1"}
+	_ = n.Update(s1Updated)
+
+	assert.Eventually(t, func() bool {
+		newLease, ok := f.leaseOf(keyOf(s1))
+		return ok && newLease != lease
+	}, time.Second, time.Millisecond*10)
+
+	f.Lock()
+	assert.Contains(t, f.kvs[keyOf(s1)], `"load":"1"`)
+	f.Unlock()
+	n.mu.RLock()
+	newLease := n.leases[s1.ServiceID()]
+	n.mu.RUnlock()
+	assert.NotEqual(t, lease, newLease)
+	assert.Equal(t, lost+1, testutil.ToFloat64(leaseLostTotal.WithLabelValues("lease_world")))
+	assert.Equal(t, failed+3, testutil.ToFloat64(reregisterTotal.WithLabelValues("lease_world", "failed")))
+	assert.Equal(t, succeeded+1, testutil.ToFloat64(reregisterTotal.WithLabelValues("lease_world", "ok")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(registrationUp.WithLabelValues("lease_world", "lease_s2")))
+
+	assert.Nil(t, n.Deregister(s1.ServiceID()))
+	_, ok := f.leaseOf(keyOf(s1))
+	assert.False(t, ok)
+}
+
+func Test_etcdNaming_Deregister_WhileReregister(t *testing.T) {
+	f := newFakeEtcd()
+	n := newFakeNaming(f)
+
+	failed := testutil.ToFloat64(reregisterTotal.WithLabelValues("lease_other", "failed"))
+	succeeded := testutil.ToFloat64(reregisterTotal.WithLabelValues("lease_other", "ok"))
+
+	s1 := naming.NewEntry("lease_s3", "lease_other", "tcp", "127.0.0.1", 8001)
+	assert.Nil(t, n.Register(s1))
+	lease, _ := f.leaseOf(keyOf(s1))
+
+	f.Lock()
+	f.grantErrors = 1 << 20
+	f.Unlock()
+	f.expire(lease)
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(reregisterTotal.WithLabelValues("lease_other", "failed")) > failed
+	}, time.Second, time.Millisecond*10)
+
+	assert.Nil(t, n.Deregister(s1.ServiceID()))
+	f.Lock()
+	f.grantErrors = 0
+	f.Unlock()
+	time.Sleep(time.Millisecond * 100)
+	_, ok := f.leaseOf(keyOf(s1))
+	assert.False(t, ok)
+	assert.Equal(t, succeeded, testutil.ToFloat64(reregisterTotal.WithLabelValues("lease_other", "ok")))
+}
@@ -0,0 +1,24 @@
+package etcd
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var registrationUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "qim",
+	Name:      "naming_registration_up",
+	Help:      "服务注册是否有效，租约丢失时为0",
+}, []string{"service", "service_id"})
+
+var leaseLostTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "naming_lease_lost_total",
+	Help:      "服务注册的租约丢失次数",
+}, []string{"service"})
+
+var reregisterTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "naming_reregister_total",
+	Help:      "租约丢失后重新注册的次数",
+}, []string{"service", "result"})
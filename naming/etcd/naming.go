@@ -11,16 +11,54 @@ import (
 	"github.com/joeyscat/qim"
 	"github.com/joeyscat/qim/naming"
 	"go.uber.org/zap"
-	"golang.org/x/exp/slices"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
+const (
+	DefaultTTL        = time.Second * 5
+	DefaultMinBackoff = time.Millisecond * 500
+	DefaultMaxBackoff = time.Second * 30
+
+	requestTimeout = time.Second * 5
+)
+
+type Options struct {
+	// TTL of the lease of the service key, the key is gone after TTL if the process is
+	// gone or etcd is unreachable
+	TTL time.Duration
+	// MinBackoff and MaxBackoff bound the interval of registering again after the lease is lost
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+type Option func(*Options)
+
+func WithTTL(ttl time.Duration) Option {
+	return func(opts *Options) {
+		opts.TTL = ttl
+	}
+}
+
+func WithBackoff(min, max time.Duration) Option {
+	return func(opts *Options) {
+		opts.MinBackoff = min
+		opts.MaxBackoff = max
+	}
+}
+
 type etcdNaming struct {
-	cli *clientv3.Client
-	mu  *sync.RWMutex
+	cli     *clientv3.Client
+	kv      clientv3.KV
+	lease   clientv3.Lease
+	options *Options
+	mu      *sync.RWMutex
 	// key: serviceID, value: service
 	registry map[string]qim.ServiceRegistration
+	// key: serviceID, value: lease of the service key
+	leases map[string]clientv3.LeaseID
+	// key: serviceID, value: cancelFunc for keepalive
+	keepaliveCancelFunc map[string]context.CancelFunc
 	// key: serviceName, value: callback function
 	watchCallback map[string]func(services []qim.ServiceRegistration)
 	// key: serviceName, value: cancelFunc for watch
@@ -28,7 +66,15 @@ type etcdNaming struct {
 	lg              *zap.Logger
 }
 
-func NewNaming(endpoints []string, lg *zap.Logger) (naming.Naming, error) {
+func NewNaming(endpoints []string, lg *zap.Logger, opts ...Option) (naming.Naming, error) {
+	options := &Options{
+		TTL:        DefaultTTL,
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
 	cli, err := clientv3.New(clientv3.Config{
 		Endpoints:   endpoints,
 		DialTimeout: 5 * time.Second,
@@ -38,12 +84,17 @@ func NewNaming(endpoints []string, lg *zap.Logger) (naming.Naming, error) {
 	}
 
 	e := &etcdNaming{
-		cli:             cli,
-		mu:              &sync.RWMutex{},
-		registry:        make(map[string]qim.ServiceRegistration),
-		watchCallback:   make(map[string]func([]qim.ServiceRegistration)),
-		watchCancelFunc: make(map[string]context.CancelFunc),
-		lg:              lg,
+		cli:                 cli,
+		kv:                  cli.KV,
+		lease:               cli.Lease,
+		options:             options,
+		mu:                  &sync.RWMutex{},
+		registry:            make(map[string]qim.ServiceRegistration),
+		leases:              make(map[string]clientv3.LeaseID),
+		keepaliveCancelFunc: make(map[string]context.CancelFunc),
+		watchCallback:       make(map[string]func([]qim.ServiceRegistration)),
+		watchCancelFunc:     make(map[string]context.CancelFunc),
+		lg:                  lg,
 	}
 	return e, nil
 }
@@ -51,8 +102,8 @@ func NewNaming(endpoints []string, lg *zap.Logger) (naming.Naming, error) {
 var _ naming.Naming = (*etcdNaming)(nil)
 
 // Find implements naming.Naming
-func (e *etcdNaming) Find(serviceName string, tags ...string) ([]qim.ServiceRegistration, error) {
-	resp, err := e.cli.Get(context.Background(), ServicesPrefix+serviceName+"/", clientv3.WithPrefix())
+func (e *etcdNaming) Find(serviceName string, selectors ...naming.Selector) ([]qim.ServiceRegistration, error) {
+	resp, err := e.kv.Get(context.Background(), ServicesPrefix+serviceName+"/", clientv3.WithPrefix())
 	if err != nil {
 		return nil, err
 	}
@@ -62,18 +113,16 @@ func (e *etcdNaming) Find(serviceName string, tags ...string) ([]qim.ServiceRegi
 		if err := json.Unmarshal(kv.Value, &s); err != nil {
 			return nil, err
 		}
-		if e.matchTags(s.GetTags(), tags) {
+		if naming.MatchSelectors(&s, selectors...) {
 			services = append(services, &s)
 		}
 	}
 	return services, nil
 }
 
-// Register implements naming.Naming
+// Register implements naming.Naming, the service key is kept alive by its lease until Deregister,
+// and it is registered again if the lease is lost, such as etcd is unavailable longer than the TTL.
 func (e *etcdNaming) Register(service qim.ServiceRegistration) error {
-	// put kv
-	// keepalive
-	// TODO keep leaseID
 	e.lg.Info("register service", zap.String("service", service.String()))
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -81,57 +130,183 @@ func (e *etcdNaming) Register(service qim.ServiceRegistration) error {
 		return fmt.Errorf("service already registered: %s", service.ServiceID())
 	}
 
-	data, err := json.Marshal(service)
+	ctx, cancel := context.WithCancel(context.Background())
+	leaseID, ch, err := e.register(ctx, service)
 	if err != nil {
+		cancel()
 		return err
 	}
-	key := ServicesPrefix + service.ServiceName() + "/" + service.ServiceID()
-	leaseResp, err := e.cli.Grant(context.Background(), 5)
+
+	e.registry[service.ServiceID()] = service
+	e.leases[service.ServiceID()] = leaseID
+	e.keepaliveCancelFunc[service.ServiceID()] = cancel
+	registrationUp.WithLabelValues(service.ServiceName(), service.ServiceID()).Set(1)
+
+	go e.keepalive(ctx, service, ch)
+	return nil
+}
+
+// register puts the service key under a new lease and keeps the lease alive
+func (e *etcdNaming) register(ctx context.Context, service qim.ServiceRegistration) (clientv3.LeaseID, <-chan *clientv3.LeaseKeepAliveResponse, error) {
+	data, err := json.Marshal(service)
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
-	_, err = e.cli.Put(context.Background(), key, string(data), clientv3.WithLease(leaseResp.ID))
+	reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	ttl := int64(e.options.TTL / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	leaseResp, err := e.lease.Grant(reqCtx, ttl)
 	if err != nil {
-		return err
+		return 0, nil, err
+	}
+	_, err = e.kv.Put(reqCtx, keyOf(service), string(data), clientv3.WithLease(leaseResp.ID))
+	if err == nil {
+		var ch <-chan *clientv3.LeaseKeepAliveResponse
+		ch, err = e.lease.KeepAlive(ctx, leaseResp.ID)
+		if err == nil {
+			return leaseResp.ID, ch, nil
+		}
 	}
+	e.revoke(leaseResp.ID)
+	return 0, nil, err
+}
 
-	_, err = e.cli.KeepAlive(context.TODO(), leaseResp.ID)
-	if err != nil {
-		e.lg.Error("KeepAlive error", zap.Error(err))
-		return err
+// keepalive consumes the keepalive responses, the channel is closed if the lease is lost or ctx is done
+func (e *etcdNaming) keepalive(ctx context.Context, service qim.ServiceRegistration, ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	log := e.lg.With(zap.String("func", "keepalive"), zap.String("serviceID", service.ServiceID()))
+	for {
+		for range ch {
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warn("lease lost, register again")
+		leaseLostTotal.WithLabelValues(service.ServiceName()).Inc()
+		registrationUp.WithLabelValues(service.ServiceName(), service.ServiceID()).Set(0)
+
+		ch = e.reregister(ctx, service.ServiceID())
+		if ch == nil {
+			return
+		}
 	}
+}
 
+// reregister registers the service with backoff until it succeeds, the service is deregistered
+// or ctx is done, a nil channel is returned in the latter cases.
+func (e *etcdNaming) reregister(ctx context.Context, serviceID string) <-chan *clientv3.LeaseKeepAliveResponse {
+	log := e.lg.With(zap.String("func", "reregister"), zap.String("serviceID", serviceID))
+	backoff := e.options.MinBackoff
+	for {
+		// the latest meta is registered, such as the load updated while the lease is lost
+		e.mu.RLock()
+		service, ok := e.registry[serviceID]
+		e.mu.RUnlock()
+		if !ok {
+			return nil
+		}
+
+		leaseID, ch, err := e.register(ctx, service)
+		if err == nil {
+			e.mu.Lock()
+			if _, ok := e.registry[serviceID]; !ok || ctx.Err() != nil {
+				e.mu.Unlock()
+				e.revoke(leaseID)
+				return nil
+			}
+			e.leases[serviceID] = leaseID
+			e.mu.Unlock()
+
+			log.Info("registered again", zap.Int64("lease", int64(leaseID)))
+			reregisterTotal.WithLabelValues(service.ServiceName(), "ok").Inc()
+			registrationUp.WithLabelValues(service.ServiceName(), serviceID).Set(1)
+			return ch
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		log.Warn("register again failed", zap.Duration("backoff", backoff), zap.Error(err))
+		reregisterTotal.WithLabelValues(service.ServiceName(), "failed").Inc()
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil
+		}
+		backoff *= 2
+		if backoff > e.options.MaxBackoff {
+			backoff = e.options.MaxBackoff
+		}
+	}
+}
+
+func (e *etcdNaming) revoke(leaseID clientv3.LeaseID) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if _, err := e.lease.Revoke(ctx, leaseID); err != nil {
+		e.lg.Warn("revoke lease failed", zap.Int64("lease", int64(leaseID)), zap.Error(err))
+	}
+}
+
+// Update implements naming.Naming, the key is rewritten under the lease of the registration.
+// The service is kept even if the put fails, so that it is registered by the latest if the lease is lost.
+func (e *etcdNaming) Update(service qim.ServiceRegistration) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	leaseID, ok := e.leases[service.ServiceID()]
+	if !ok {
+		return fmt.Errorf("service not registered: %s", service.ServiceID())
+	}
 	e.registry[service.ServiceID()] = service
-	return nil
+
+	data, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	_, err = e.kv.Put(ctx, keyOf(service), string(data), clientv3.WithLease(leaseID))
+	return err
 }
 
-// Deregister implements naming.Naming
+// Deregister implements naming.Naming, the lease is revoked so that the key is deleted at once
 func (e *etcdNaming) Deregister(serviceID string) error {
-	// TODO revoke lease
-	// delete kv
-
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	for k, service := range e.registry {
-		if k == serviceID {
-			delete(e.registry, k)
-			key := ServicesPrefix + service.ServiceName() + "/" + service.ServiceID()
-			_, err := e.cli.Delete(context.Background(), key)
-			return err
-		}
+	service, ok := e.registry[serviceID]
+	if !ok {
+		return errors.New("ServiceID  Not  Found")
 	}
-	return errors.New("ServiceID  Not  Found")
+	leaseID := e.leases[serviceID]
+	e.keepaliveCancelFunc[serviceID]()
+	delete(e.registry, serviceID)
+	delete(e.leases, serviceID)
+	delete(e.keepaliveCancelFunc, serviceID)
+	registrationUp.DeleteLabelValues(service.ServiceName(), serviceID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if _, err := e.lease.Revoke(ctx, leaseID); err != nil {
+		// the lease may be lost already, delete the key in case it is registered again meanwhile
+		e.lg.Warn("revoke lease failed", zap.String("serviceID", serviceID), zap.Error(err))
+		_, err = e.kv.Delete(ctx, keyOf(service))
+		return err
+	}
+	return nil
 }
 
-// Subscribe implements naming.Naming
-func (e *etcdNaming) Subscribe(serviceName string, callback func(services []qim.ServiceRegistration)) error {
+// Subscribe implements naming.Naming, the callback is called on the changes after it, the services
+// online already are found by Find
+func (e *etcdNaming) Subscribe(serviceName string, callback func(services []qim.ServiceRegistration), selectors ...naming.Selector) error {
 	// cancel old watch
 	// create new watch
 	// keep the cancelFunc
 
 	e.mu.Lock()
-	defer e.mu.Unlock()
-
 	if cancel, ok := e.watchCancelFunc[serviceName]; ok {
 		cancel()
 	}
@@ -142,28 +317,29 @@ func (e *etcdNaming) Subscribe(serviceName string, callback func(services []qim.
 		watchKey := ServicesPrefix + serviceName + "/"
 		rch := e.cli.Watch(ctx, watchKey, clientv3.WithPrefix())
 		for wresp := range rch {
+			changed := false
 			for _, ev := range wresp.Events {
 				switch ev.Type {
 				case clientv3.EventTypeDelete:
 					fallthrough
 				case clientv3.EventTypePut:
-					e.mu.Lock()
-					cb, ok := e.watchCallback[serviceName]
-					e.mu.Unlock()
-					if ok {
-						cb(e.getServices(serviceName))
-					}
+					changed = true
 				default:
 					e.lg.Info("unknown watch event", zap.Any("event", ev))
 				}
 			}
+			// the events of a response are notified once, the services are found after all of them
+			if changed {
+				e.notify(serviceName)
+			}
 		}
 		e.lg.Info("subscribe over", zap.String("serviceName", serviceName))
 	}()
 
-	e.watchCallback[serviceName] = callback
-	callback(e.getServices(serviceName))
-
+	e.watchCallback[serviceName] = func(services []qim.ServiceRegistration) {
+		callback(naming.Select(services, selectors...))
+	}
+	e.mu.Unlock()
 	return nil
 }
 
@@ -185,24 +361,22 @@ const (
 	ServicesPrefix = "services/"
 )
 
-func (e *etcdNaming) getServices(serviceName string) []qim.ServiceRegistration {
-	var services []qim.ServiceRegistration
-	for _, v := range e.registry {
-		if v.ServiceName() == serviceName {
-			services = append(services, v)
-		}
-	}
-	return services
+func keyOf(service qim.ServiceRegistration) string {
+	return ServicesPrefix + service.ServiceName() + "/" + service.ServiceID()
 }
 
-func (e *etcdNaming) matchTags(srcTags, matchTags []string) bool {
-	if len(matchTags) == 0 {
-		return true
+// notify calls back the subscriber of serviceName with the services in etcd, including the meta changed by Update
+func (e *etcdNaming) notify(serviceName string) {
+	e.mu.RLock()
+	cb, ok := e.watchCallback[serviceName]
+	e.mu.RUnlock()
+	if !ok {
+		return
 	}
-	for _, mt := range matchTags {
-		if !slices.Contains(srcTags, mt) {
-			return false
-		}
+	services, err := e.Find(serviceName)
+	if err != nil {
+		e.lg.Warn("find services failed", zap.String("serviceName", serviceName), zap.Error(err))
+		return
 	}
-	return true
+	cb(services)
 }
@@ -165,11 +165,61 @@ func Test_etcdNaming_Find(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 3, len(ss))
 
-	ss, err = n.Find(s1.ServiceName(), "gate")
+	ss, err = n.Find(s1.ServiceName(), naming.Tags("gate"))
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(ss))
 
-	ss, err = n.Find(s1.ServiceName(), "tab2")
+	ss, err = n.Find(s1.ServiceName(), naming.Tags("tab2"))
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(ss))
 }
+
+func Test_etcdNaming_Update(t *testing.T) {
+	log, err := zap.NewDevelopment()
+	assert.Nil(t, err)
+	n, err := NewNaming([]string{"127.0.0.1:2379"}, log)
+	assert.Nil(t, err)
+
+	s1 := &naming.DefaultService{
+		ID:       "s1",
+		Name:     "load",
+		Address:  "localhost",
+		Port:     8001,
+		Protocol: "tcp",
+		Meta:     map[string]string{},
+	}
+	assert.NotNil(t, n.Update(s1))
+
+	err = n.Register(s1)
+	assert.Nil(t, err)
+	defer func() {
+		_ = n.Deregister(s1.ServiceID())
+	}()
+
+	ch := make(chan []qim.ServiceRegistration, 1)
+	err = n.Subscribe(s1.ServiceName(), func(services []qim.ServiceRegistration) {
+		ch <- services
+	})
+	assert.Nil(t, err)
+	defer func() {
+		_ = n.Unsubscribe(s1.ServiceName())
+	}()
+
+	s1.Meta["load_channels"] = "100"
+	err = n.Update(s1)
+	assert.Nil(t, err)
+
+	// the subscriber is called back with the meta changed
+	select {
+	case ss := <-ch:
+		assert.Equal(t, 1, len(ss))
+		assert.Equal(t, "100", ss[0].GetMeta()["load_channels"])
+	case <-time.After(time.Second * 3):
+		t.Fatal("no callback")
+	}
+
+	ss, err := n.Find(s1.ServiceName())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ss))
+	assert.Equal(t, "100", ss[0].GetMeta()["load_channels"])
+}
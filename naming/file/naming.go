@@ -0,0 +1,319 @@
+// Package file implements naming.Naming with the services listed in a YAML or JSON file,
+// the file is watched for changes to drive the Subscribe callbacks. Replace the file
+// by rename to change it, so that a file half written is never loaded.
+//
+//	services:
+//	  - id: gate01
+//	    name: wgateway
+//	    address: 127.0.0.1
+//	    port: 8000
+//	    protocol: ws
+//	    tags: ["IDC:SH_ALI"]
+//	    meta:
+//	      domain: ws://127.0.0.1:8000
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultInterval = time.Second * 2
+
+type Service struct {
+	ID        string            `json:"id" yaml:"id"`
+	Name      string            `json:"name" yaml:"name"`
+	Address   string            `json:"address" yaml:"address"`
+	Port      uint16            `json:"port" yaml:"port"`
+	Protocol  string            `json:"protocol" yaml:"protocol"`
+	Namespace string            `json:"namespace" yaml:"namespace"`
+	Tags      []string          `json:"tags" yaml:"tags"`
+	Meta      map[string]string `json:"meta" yaml:"meta"`
+}
+
+type File struct {
+	Services []Service `json:"services" yaml:"services"`
+}
+
+type Options struct {
+	// Interval of checking the file for changes
+	Interval time.Duration
+}
+
+type Option func(*Options)
+
+func WithInterval(val time.Duration) Option {
+	return func(opts *Options) {
+		opts.Interval = val
+	}
+}
+
+type fileNaming struct {
+	path    string
+	options *Options
+	lg      *zap.Logger
+
+	mu sync.RWMutex
+	// content of the file loaded last
+	content []byte
+	// key: serviceID, value: service listed in the file
+	static map[string]qim.ServiceRegistration
+	// key: serviceID, value: service registered by the process, it takes place of the one in the file
+	registry map[string]qim.ServiceRegistration
+	// key: serviceName, value: subscription
+	watchCallback map[string]*naming.Subscription
+	stopWatch     chan struct{}
+}
+
+// NewNaming loads the services in path, the file is JSON if its extension is .json, YAML otherwise
+func NewNaming(path string, lg *zap.Logger, opts ...Option) (naming.Naming, error) {
+	options := &Options{
+		Interval: DefaultInterval,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	f := &fileNaming{
+		path:          path,
+		options:       options,
+		lg:            lg,
+		registry:      make(map[string]qim.ServiceRegistration),
+		watchCallback: make(map[string]*naming.Subscription),
+	}
+	content, static, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	f.content = content
+	f.static = static
+	return f, nil
+}
+
+var _ naming.Naming = (*fileNaming)(nil)
+
+func (f *fileNaming) load() ([]byte, map[string]qim.ServiceRegistration, error) {
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	static, err := Parse(content, strings.EqualFold(filepath.Ext(f.path), ".json"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse %s: %w", f.path, err)
+	}
+	return content, static, nil
+}
+
+// Parse decodes the content of a naming file, key of the map is the ID of the service
+func Parse(content []byte, isJSON bool) (map[string]qim.ServiceRegistration, error) {
+	var file File
+	var err error
+	if isJSON {
+		err = json.Unmarshal(content, &file)
+	} else {
+		err = yaml.Unmarshal(content, &file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[string]qim.ServiceRegistration, len(file.Services))
+	for i, s := range file.Services {
+		if s.ID == "" || s.Name == "" {
+			return nil, fmt.Errorf("services[%d]: id and name are required", i)
+		}
+		if _, ok := services[s.ID]; ok {
+			return nil, fmt.Errorf("services[%d]: duplicate id %s", i, s.ID)
+		}
+		services[s.ID] = &naming.DefaultService{
+			ID:        s.ID,
+			Name:      s.Name,
+			Address:   s.Address,
+			Port:      s.Port,
+			Protocol:  s.Protocol,
+			Namespace: s.Namespace,
+			Tags:      s.Tags,
+			Meta:      s.Meta,
+		}
+	}
+	return services, nil
+}
+
+// Find implements naming.Naming, the services are sorted by ID
+func (f *fileNaming) Find(serviceName string, selectors ...naming.Selector) ([]qim.ServiceRegistration, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.find(serviceName, selectors), nil
+}
+
+func (f *fileNaming) find(serviceName string, selectors []naming.Selector) []qim.ServiceRegistration {
+	var services []qim.ServiceRegistration
+	match := func(s qim.ServiceRegistration) bool {
+		return s.ServiceName() == serviceName && naming.MatchSelectors(s, selectors...)
+	}
+	for id, s := range f.static {
+		if _, ok := f.registry[id]; !ok && match(s) {
+			services = append(services, naming.Copy(s))
+		}
+	}
+	for _, s := range f.registry {
+		if match(s) {
+			services = append(services, naming.Copy(s))
+		}
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].ServiceID() < services[j].ServiceID()
+	})
+	return services
+}
+
+// Register implements naming.Naming, the service is kept in the process and the file is not written
+func (f *fileNaming) Register(service qim.ServiceRegistration) error {
+	f.mu.Lock()
+	if _, ok := f.registry[service.ServiceID()]; ok {
+		f.mu.Unlock()
+		return fmt.Errorf("service already registered: %s", service.ServiceID())
+	}
+	f.registry[service.ServiceID()] = naming.Copy(service)
+	f.mu.Unlock()
+
+	f.notify(service.ServiceName())
+	return nil
+}
+
+// Update implements naming.Naming
+func (f *fileNaming) Update(service qim.ServiceRegistration) error {
+	f.mu.Lock()
+	if _, ok := f.registry[service.ServiceID()]; !ok {
+		f.mu.Unlock()
+		return fmt.Errorf("service not registered: %s", service.ServiceID())
+	}
+	f.registry[service.ServiceID()] = naming.Copy(service)
+	f.mu.Unlock()
+
+	f.notify(service.ServiceName())
+	return nil
+}
+
+// Deregister implements naming.Naming, a service listed in the file is found again after it is deregistered
+func (f *fileNaming) Deregister(serviceID string) error {
+	f.mu.Lock()
+	service, ok := f.registry[serviceID]
+	if !ok {
+		f.mu.Unlock()
+		return naming.ErrNotFound
+	}
+	delete(f.registry, serviceID)
+	f.mu.Unlock()
+
+	f.notify(service.ServiceName())
+	return nil
+}
+
+// Subscribe implements naming.Naming, the file is watched while there is any subscriber
+func (f *fileNaming) Subscribe(serviceName string, callback func(services []qim.ServiceRegistration), selectors ...naming.Selector) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.watchCallback[serviceName] = naming.NewSubscription(callback, selectors...)
+	if f.stopWatch == nil {
+		f.stopWatch = make(chan struct{})
+		go f.watch(f.stopWatch)
+	}
+	return nil
+}
+
+// Unsubscribe implements naming.Naming
+func (f *fileNaming) Unsubscribe(serviceName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.watchCallback, serviceName)
+	if len(f.watchCallback) == 0 && f.stopWatch != nil {
+		close(f.stopWatch)
+		f.stopWatch = nil
+	}
+	return nil
+}
+
+func (f *fileNaming) watch(stop chan struct{}) {
+	ticker := time.NewTicker(f.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.reload()
+		case <-stop:
+			f.lg.Info("watch over", zap.String("path", f.path))
+			return
+		}
+	}
+}
+
+// reload loads the file if it is changed, and notifies the subscribers of the services changed.
+// The services loaded last are kept if the file is broken.
+func (f *fileNaming) reload() {
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		f.lg.Warn("read naming file failed", zap.String("path", f.path), zap.Error(err))
+		return
+	}
+	f.mu.RLock()
+	same := bytes.Equal(content, f.content)
+	f.mu.RUnlock()
+	if same {
+		return
+	}
+
+	static, err := Parse(content, strings.EqualFold(filepath.Ext(f.path), ".json"))
+	if err != nil {
+		f.lg.Warn("parse naming file failed", zap.String("path", f.path), zap.Error(err))
+		return
+	}
+
+	f.mu.Lock()
+	before := make(map[string][]qim.ServiceRegistration, len(f.watchCallback))
+	for name, sub := range f.watchCallback {
+		before[name] = f.find(name, sub.Selectors)
+	}
+	f.content = content
+	f.static = static
+	var changed []string
+	for name, services := range before {
+		if !reflect.DeepEqual(services, f.find(name, f.watchCallback[name].Selectors)) {
+			changed = append(changed, name)
+		}
+	}
+	f.mu.Unlock()
+
+	f.lg.Info("naming file reloaded", zap.String("path", f.path), zap.Strings("changed", changed))
+	for _, name := range changed {
+		f.notify(name)
+	}
+}
+
+// notify calls the callback of serviceName out of the lock, so that it can call back into the naming,
+// the lists taken by the concurrent changes are delivered in order
+func (f *fileNaming) notify(serviceName string) {
+	f.mu.RLock()
+	sub, ok := f.watchCallback[serviceName]
+	if !ok {
+		f.mu.RUnlock()
+		return
+	}
+	services := f.find(serviceName, sub.Selectors)
+	seq := sub.Next()
+	f.mu.RUnlock()
+	sub.Deliver(seq, services)
+}
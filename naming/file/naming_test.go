@@ -0,0 +1,167 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const servicesYaml = `
+services:
+  - id: gate01
+    name: wgateway
+    address: 127.0.0.1
+    port: 8000
+    protocol: ws
+    namespace: qim
+    tags: ["IDC:SH_ALI"]
+    meta:
+      domain: ws://127.0.0.1:8000
+  - id: chat01
+    name: chat
+    address: 127.0.0.1
+    port: 8005
+    protocol: tcp
+`
+
+const servicesJSON = `{
+  "services": [
+    {"id": "gate01", "name": "wgateway", "address": "127.0.0.1", "port": 8000, "protocol": "ws", "namespace": "qim",
+     "tags": ["IDC:SH_ALI"], "meta": {"domain": "ws://127.0.0.1:8000"}},
+    {"id": "chat01", "name": "chat", "address": "127.0.0.1", "port": 8005, "protocol": "tcp"}
+  ]
+}`
+
+// writeFile replaces the file by rename, so that the watcher never reads a file half written
+func writeFile(t *testing.T, path, content string) {
+	err := os.WriteFile(path+".tmp", []byte(content), 0644)
+	assert.Nil(t, err)
+	err = os.Rename(path+".tmp", path)
+	assert.Nil(t, err)
+}
+
+func Test_fileNaming_Find(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"naming.yaml", "naming.json"} {
+		path := filepath.Join(dir, name)
+		if name == "naming.json" {
+			writeFile(t, path, servicesJSON)
+		} else {
+			writeFile(t, path, servicesYaml)
+		}
+		n, err := NewNaming(path, zap.NewNop())
+		assert.Nil(t, err, name)
+
+		ss, err := n.Find("wgateway")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(ss), name)
+		assert.Equal(t, &naming.DefaultService{
+			ID:        "gate01",
+			Name:      "wgateway",
+			Address:   "127.0.0.1",
+			Port:      8000,
+			Protocol:  "ws",
+			Namespace: "qim",
+			Tags:      []string{"IDC:SH_ALI"},
+			Meta:      map[string]string{"domain": "ws://127.0.0.1:8000"},
+		}, ss[0], name)
+
+		ss, _ = n.Find("wgateway", naming.Tags("IDC:HZ_ALI"))
+		assert.Empty(t, ss)
+		ss, _ = n.Find("chat")
+		assert.Equal(t, 1, len(ss))
+	}
+}
+
+func Test_fileNaming_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "naming.yaml")
+
+	_, err := NewNaming(path, zap.NewNop())
+	assert.NotNil(t, err)
+
+	writeFile(t, path, "services:\n  - name: chat\n")
+	_, err = NewNaming(path, zap.NewNop())
+	assert.NotNil(t, err)
+
+	writeFile(t, path, "services:\n  - {id: s1, name: chat}\n  - {id: s1, name: chat}\n")
+	_, err = NewNaming(path, zap.NewNop())
+	assert.NotNil(t, err)
+}
+
+func Test_fileNaming_Register(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "naming.yaml")
+	writeFile(t, path, servicesYaml)
+	n, err := NewNaming(path, zap.NewNop())
+	assert.Nil(t, err)
+
+	chat02 := naming.NewEntry("chat02", "chat", "tcp", "127.0.0.1", 8006)
+	assert.Nil(t, n.Register(chat02))
+	assert.NotNil(t, n.Register(chat02))
+	ss, _ := n.Find("chat")
+	assert.Equal(t, 2, len(ss))
+
+	// the service in the file is replaced by the one registered
+	chat01 := naming.NewEntry("chat01", "chat", "tcp", "127.0.0.2", 8005)
+	assert.Nil(t, n.Register(chat01))
+	ss, _ = n.Find("chat")
+	assert.Equal(t, 2, len(ss))
+	assert.Equal(t, "127.0.0.2", ss[0].PublicAddress())
+
+	assert.Nil(t, n.Deregister("chat01"))
+	assert.Nil(t, n.Deregister("chat02"))
+	assert.Equal(t, naming.ErrNotFound, n.Deregister("chat02"))
+	ss, _ = n.Find("chat")
+	assert.Equal(t, 1, len(ss))
+	assert.Equal(t, "127.0.0.1", ss[0].PublicAddress())
+}
+
+func Test_fileNaming_Subscribe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "naming.yaml")
+	writeFile(t, path, servicesYaml)
+	n, err := NewNaming(path, zap.NewNop(), WithInterval(time.Millisecond*20))
+	assert.Nil(t, err)
+
+	ch := make(chan []qim.ServiceRegistration, 10)
+	err = n.Subscribe("chat", func(services []qim.ServiceRegistration) {
+		ch <- services
+	})
+	assert.Nil(t, err)
+
+	// a change of other services is not notified
+	writeFile(t, path, servicesYaml+"  - {id: gate02, name: wgateway, address: 127.0.0.1, port: 8010}\n")
+	select {
+	case <-ch:
+		t.Fatal("unexpected callback")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	writeFile(t, path, servicesYaml+"  - {id: chat02, name: chat, address: 127.0.0.1, port: 8006}\n")
+	select {
+	case ss := <-ch:
+		assert.Equal(t, 2, len(ss))
+	case <-time.After(time.Second):
+		t.Fatal("no callback")
+	}
+
+	// the services loaded last are kept if the file is broken
+	writeFile(t, path, "services: [")
+	time.Sleep(time.Millisecond * 100)
+	ss, _ := n.Find("chat")
+	assert.Equal(t, 2, len(ss))
+	assert.Empty(t, ch)
+
+	assert.Nil(t, n.Unsubscribe("chat"))
+	writeFile(t, path, servicesYaml)
+	select {
+	case <-ch:
+		t.Fatal("callback after unsubscribe")
+	case <-time.After(time.Millisecond * 100):
+	}
+}
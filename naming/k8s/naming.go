@@ -0,0 +1,383 @@
+// Package k8s implements naming.Naming with the EndpointSlices (or Endpoints) of the kubernetes
+// services, a qim service is the kubernetes service of the same name in the namespace. The pods
+// of the endpoints keep the rest of the service in their annotations:
+//
+//	qim.io/id: chat01             # the name of the pod if it is absent
+//	qim.io/tags: IDC:SH_ALI,dev
+//	qim.io/protocol: tcp          # tcp if it is absent
+//	qim.io/namespace: qim
+//	meta.qim.io/zone: zone_03     # meta zone=zone_03
+//
+// The endpoints are maintained by kubernetes with the readiness of the pods, so Register,
+// Deregister and Update change nothing.
+//
+// The package is a module of its own to keep client-go out of the dependencies of qim. It
+// registers backend.BackendK8s once imported, as the qim command in cmd/qim does.
+package k8s
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	AnnotationID         = "qim.io/id"
+	AnnotationTags       = "qim.io/tags"
+	AnnotationProtocol   = "qim.io/protocol"
+	AnnotationNamespace  = "qim.io/namespace"
+	AnnotationMetaPrefix = "meta.qim.io/"
+
+	DefaultProtocol    = "tcp"
+	DefaultSyncTimeout = time.Second * 30
+)
+
+type Options struct {
+	// PortName of the endpoints, the first port is used if it is empty
+	PortName string
+	// Endpoints is used instead of EndpointSlices, for the clusters older than 1.21
+	Endpoints   bool
+	SyncTimeout time.Duration
+}
+
+type Option func(*Options)
+
+func WithPortName(name string) Option {
+	return func(opts *Options) {
+		opts.PortName = name
+	}
+}
+
+// WithEndpoints uses the Endpoints instead of the EndpointSlices
+func WithEndpoints() Option {
+	return func(opts *Options) {
+		opts.Endpoints = true
+	}
+}
+
+func WithSyncTimeout(val time.Duration) Option {
+	return func(opts *Options) {
+		opts.SyncTimeout = val
+	}
+}
+
+// endpoint is a ready address of a kubernetes service
+type endpoint struct {
+	ip   string
+	port uint16
+	// pod is the name of the pod behind the endpoint, it is empty if the endpoint is not a pod
+	pod string
+}
+
+type k8sNaming struct {
+	namespace string
+	options   *Options
+	factory   informers.SharedInformerFactory
+	pods      cache.Indexer
+	slices    cache.Indexer
+	endpoints cache.Indexer
+	stop      chan struct{}
+
+	mu sync.Mutex
+	// key: serviceName, value: subscription
+	watchCallback map[string]*subscription
+	lg            *zap.Logger
+}
+
+type subscription struct {
+	callback  func([]qim.ServiceRegistration)
+	selectors []naming.Selector
+	last      []qim.ServiceRegistration
+}
+
+// NewInClusterNaming creates the naming with the service account of the pod
+func NewInClusterNaming(namespace string, lg *zap.Logger, opts ...Option) (naming.Naming, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewNaming(client, namespace, lg, opts...)
+}
+
+// NewNaming watches the endpoints and pods in namespace, the default namespace is used if it is empty.
+// It returns after the caches are synced.
+func NewNaming(client kubernetes.Interface, namespace string, lg *zap.Logger, opts ...Option) (naming.Naming, error) {
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	options := &Options{
+		SyncTimeout: DefaultSyncTimeout,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	k := &k8sNaming{
+		namespace:     namespace,
+		options:       options,
+		factory:       informers.NewSharedInformerFactoryWithOptions(client, 0, informers.WithNamespace(namespace)),
+		stop:          make(chan struct{}),
+		watchCallback: make(map[string]*subscription),
+		lg:            lg,
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { k.changed() },
+		UpdateFunc: func(oldObj, newObj interface{}) { k.changed() },
+		DeleteFunc: func(obj interface{}) { k.changed() },
+	}
+	informerList := []cache.SharedIndexInformer{k.factory.Core().V1().Pods().Informer()}
+	k.pods = informerList[0].GetIndexer()
+	if options.Endpoints {
+		informer := k.factory.Core().V1().Endpoints().Informer()
+		k.endpoints = informer.GetIndexer()
+		informerList = append(informerList, informer)
+	} else {
+		informer := k.factory.Discovery().V1().EndpointSlices().Informer()
+		k.slices = informer.GetIndexer()
+		informerList = append(informerList, informer)
+	}
+	for _, informer := range informerList {
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			return nil, err
+		}
+	}
+
+	k.factory.Start(k.stop)
+	synced := make(chan struct{})
+	go func() {
+		defer close(synced)
+		k.factory.WaitForCacheSync(k.stop)
+	}()
+	select {
+	case <-synced:
+	case <-time.After(options.SyncTimeout):
+		k.close()
+		return nil, errors.New("wait for the caches of kubernetes timeout")
+	}
+	return k, nil
+}
+
+var _ naming.Naming = (*k8sNaming)(nil)
+
+func (k *k8sNaming) close() {
+	close(k.stop)
+	k.factory.Shutdown()
+}
+
+// Find implements naming.Naming, the services are sorted by ID
+func (k *k8sNaming) Find(serviceName string, selectors ...naming.Selector) ([]qim.ServiceRegistration, error) {
+	var eps []endpoint
+	if k.options.Endpoints {
+		eps = k.findEndpoints(serviceName)
+	} else {
+		eps = k.findSlices(serviceName)
+	}
+
+	var services []qim.ServiceRegistration
+	seen := make(map[string]bool, len(eps))
+	for _, ep := range eps {
+		s := k.serviceOf(serviceName, ep)
+		// an endpoint is in more than one slice while the slices are changing
+		if seen[s.ID] || !naming.MatchSelectors(s, selectors...) {
+			continue
+		}
+		seen[s.ID] = true
+		services = append(services, s)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].ServiceID() < services[j].ServiceID()
+	})
+	return services, nil
+}
+
+func (k *k8sNaming) findSlices(serviceName string) []endpoint {
+	var eps []endpoint
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: serviceName})
+	_ = cache.ListAllByNamespace(k.slices, k.namespace, selector, func(obj interface{}) {
+		slice := obj.(*discoveryv1.EndpointSlice)
+		port, ok := k.selectSlicePort(slice.Ports)
+		if !ok {
+			return
+		}
+		for _, e := range slice.Endpoints {
+			// nil is taken as ready, the same as kube-proxy
+			if len(e.Addresses) == 0 || (e.Conditions.Ready != nil && !*e.Conditions.Ready) {
+				continue
+			}
+			ep := endpoint{ip: e.Addresses[0], port: port}
+			if e.TargetRef != nil && e.TargetRef.Kind == "Pod" {
+				ep.pod = e.TargetRef.Name
+			}
+			eps = append(eps, ep)
+		}
+	})
+	return eps
+}
+
+func (k *k8sNaming) selectSlicePort(ports []discoveryv1.EndpointPort) (uint16, bool) {
+	for _, p := range ports {
+		if p.Port == nil {
+			continue
+		}
+		if k.options.PortName == "" || (p.Name != nil && *p.Name == k.options.PortName) {
+			return uint16(*p.Port), true
+		}
+	}
+	return 0, false
+}
+
+func (k *k8sNaming) findEndpoints(serviceName string) []endpoint {
+	obj, ok, err := k.endpoints.GetByKey(k.namespace + "/" + serviceName)
+	if err != nil || !ok {
+		return nil
+	}
+	var eps []endpoint
+	for _, subset := range obj.(*corev1.Endpoints).Subsets {
+		port, ok := k.selectPort(subset.Ports)
+		if !ok {
+			continue
+		}
+		// the addresses not ready are in subset.NotReadyAddresses
+		for _, addr := range subset.Addresses {
+			ep := endpoint{ip: addr.IP, port: port}
+			if addr.TargetRef != nil && addr.TargetRef.Kind == "Pod" {
+				ep.pod = addr.TargetRef.Name
+			}
+			eps = append(eps, ep)
+		}
+	}
+	return eps
+}
+
+func (k *k8sNaming) selectPort(ports []corev1.EndpointPort) (uint16, bool) {
+	for _, p := range ports {
+		if k.options.PortName == "" || p.Name == k.options.PortName {
+			return uint16(p.Port), true
+		}
+	}
+	return 0, false
+}
+
+func (k *k8sNaming) serviceOf(serviceName string, ep endpoint) *naming.DefaultService {
+	s := &naming.DefaultService{
+		ID:       ep.pod,
+		Name:     serviceName,
+		Address:  ep.ip,
+		Port:     ep.port,
+		Protocol: DefaultProtocol,
+		Meta:     make(map[string]string),
+	}
+	if s.ID == "" {
+		s.ID = ep.ip
+	}
+	if ep.pod == "" {
+		return s
+	}
+	obj, ok, err := k.pods.GetByKey(k.namespace + "/" + ep.pod)
+	if err != nil || !ok {
+		return s
+	}
+	for key, val := range obj.(*corev1.Pod).Annotations {
+		switch {
+		case key == AnnotationID:
+			s.ID = val
+		case key == AnnotationTags:
+			s.Tags = strings.Split(val, ",")
+		case key == AnnotationProtocol:
+			s.Protocol = val
+		case key == AnnotationNamespace:
+			s.Namespace = val
+		case strings.HasPrefix(key, AnnotationMetaPrefix):
+			s.Meta[strings.TrimPrefix(key, AnnotationMetaPrefix)] = val
+		}
+	}
+	return s
+}
+
+// Register implements naming.Naming, the endpoints are maintained by kubernetes with the readiness of the pod
+func (k *k8sNaming) Register(service qim.ServiceRegistration) error {
+	k.lg.Info("register is skipped by k8s naming", zap.String("service", service.String()))
+	return nil
+}
+
+// Deregister implements naming.Naming, the pod is removed from the endpoints once it is not ready
+func (k *k8sNaming) Deregister(serviceID string) error {
+	k.lg.Info("deregister is skipped by k8s naming", zap.String("serviceID", serviceID))
+	return nil
+}
+
+// Update implements naming.Naming, the meta is changed by the annotations of the pod
+func (k *k8sNaming) Update(service qim.ServiceRegistration) error {
+	return nil
+}
+
+// Subscribe implements naming.Naming, the callback is called if the services selected are changed
+func (k *k8sNaming) Subscribe(serviceName string, callback func(services []qim.ServiceRegistration), selectors ...naming.Selector) error {
+	last, _ := k.Find(serviceName, selectors...)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.watchCallback[serviceName] = &subscription{
+		callback:  callback,
+		selectors: selectors,
+		last:      last,
+	}
+	return nil
+}
+
+// Unsubscribe implements naming.Naming
+func (k *k8sNaming) Unsubscribe(serviceName string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.watchCallback, serviceName)
+	return nil
+}
+
+// changed is called by the informers, the pods and endpoints changed may be of any service,
+// so the services of every subscription are compared with the last.
+func (k *k8sNaming) changed() {
+	type change struct {
+		callback func([]qim.ServiceRegistration)
+		services []qim.ServiceRegistration
+	}
+	var changes []change
+
+	k.mu.Lock()
+	for name, sub := range k.watchCallback {
+		services, _ := k.Find(name, sub.selectors...)
+		if reflect.DeepEqual(services, sub.last) {
+			continue
+		}
+		sub.last = services
+		// the callback gets copies, the meta of the services may be changed by the subscriber
+		copies := make([]qim.ServiceRegistration, 0, len(services))
+		for _, s := range services {
+			copies = append(copies, naming.Copy(s))
+		}
+		changes = append(changes, change{callback: sub.callback, services: copies})
+	}
+	k.mu.Unlock()
+
+	for _, c := range changes {
+		c.callback(c.services)
+	}
+}
@@ -0,0 +1,211 @@
+package k8s
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testNamespace = "qim"
+
+func newPod(name string, annotations map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Annotations: annotations},
+	}
+}
+
+func newEndpoint(ip, pod string, ready bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  []string{ip},
+		Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: pod, Namespace: testNamespace},
+	}
+}
+
+func newSlice(name, service string, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	portName, port := "tcp", int32(8000)
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+		Ports:       []discoveryv1.EndpointPort{{Name: &portName, Port: &port}},
+	}
+}
+
+func newTestNaming(t *testing.T, client *fake.Clientset, opts ...Option) *k8sNaming {
+	n, err := NewNaming(client, testNamespace, zap.NewNop(), opts...)
+	assert.Nil(t, err)
+	k := n.(*k8sNaming)
+	t.Cleanup(k.close)
+	return k
+}
+
+func Test_k8sNaming_Find(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newPod("chat-0", map[string]string{
+			AnnotationID:                  "chat01",
+			AnnotationTags:                "IDC:SH_ALI,dev",
+			AnnotationNamespace:           "qim",
+			AnnotationMetaPrefix + "zone": "zone_03",
+			"other.io/ignored":            "x",
+		}),
+		newPod("chat-1", nil),
+		newPod("chat-2", nil),
+		newSlice("chat-abc", "chat",
+			newEndpoint("10.0.0.1", "chat-0", true),
+			newEndpoint("10.0.0.2", "chat-1", true),
+			newEndpoint("10.0.0.3", "chat-2", false),
+		),
+		// the same endpoint in another slice
+		newSlice("chat-def", "chat", newEndpoint("10.0.0.2", "chat-1", true)),
+		newSlice("login-abc", "login", newEndpoint("10.0.0.9", "login-0", true)),
+	)
+	k := newTestNaming(t, client)
+
+	services, err := k.Find("chat")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(services))
+	assert.Equal(t, &naming.DefaultService{
+		ID:       "chat-1",
+		Name:     "chat",
+		Address:  "10.0.0.2",
+		Port:     8000,
+		Protocol: DefaultProtocol,
+		Meta:     map[string]string{},
+	}, services[0])
+	s := services[1]
+	assert.Equal(t, "chat01", s.ServiceID())
+	assert.Equal(t, "10.0.0.1", s.PublicAddress())
+	assert.Equal(t, []string{"IDC:SH_ALI", "dev"}, s.GetTags())
+	assert.Equal(t, "qim", s.GetNamespace())
+	assert.Equal(t, map[string]string{"zone": "zone_03"}, s.GetMeta())
+
+	services, err = k.Find("chat", naming.Tags("IDC:SH_ALI"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(services))
+	services, err = k.Find("chat", naming.Equals("zone", "zone_04"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(services))
+
+	// the pod of login is not found
+	services, err = k.Find("login")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(services))
+	assert.Equal(t, "login-0", services[0].ServiceID())
+
+	services, err = k.Find("none")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(services))
+}
+
+func Test_k8sNaming_FindEndpoints(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newPod("chat-0", map[string]string{AnnotationProtocol: "ws"}),
+		&corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "chat", Namespace: testNamespace},
+			Subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{
+					IP:        "10.0.0.1",
+					TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "chat-0"},
+				}},
+				NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+				Ports: []corev1.EndpointPort{
+					{Name: "monitor", Port: 8001},
+					{Name: "websocket", Port: 8000},
+				},
+			}},
+		},
+	)
+	k := newTestNaming(t, client, WithEndpoints(), WithPortName("websocket"))
+
+	services, err := k.Find("chat")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(services))
+	assert.Equal(t, "chat-0", services[0].ServiceID())
+	assert.Equal(t, uint16(8000), services[0].PublicPort())
+	assert.Equal(t, "ws", services[0].GetProtocol())
+}
+
+func Test_k8sNaming_Subscribe(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newPod("chat-0", nil),
+		newPod("chat-1", nil),
+		newSlice("chat-abc", "chat", newEndpoint("10.0.0.1", "chat-0", true)),
+	)
+	k := newTestNaming(t, client)
+
+	var mu sync.Mutex
+	var got [][]qim.ServiceRegistration
+	err := k.Subscribe("chat", func(services []qim.ServiceRegistration) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, services)
+	})
+	assert.Nil(t, err)
+	calls := func() [][]qim.ServiceRegistration {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([][]qim.ServiceRegistration(nil), got...)
+	}
+
+	ctx := context.Background()
+	// the pod ready
+	_, err = client.DiscoveryV1().EndpointSlices(testNamespace).Update(ctx,
+		newSlice("chat-abc", "chat", newEndpoint("10.0.0.1", "chat-0", true), newEndpoint("10.0.0.2", "chat-1", true)),
+		metav1.UpdateOptions{})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return len(calls()) == 1 }, time.Second*3, time.Millisecond*10)
+	assert.Equal(t, 2, len(calls()[0]))
+
+	// the annotations of the pod changed
+	_, err = client.CoreV1().Pods(testNamespace).Update(ctx,
+		newPod("chat-1", map[string]string{AnnotationMetaPrefix + "zone": "zone_03"}), metav1.UpdateOptions{})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return len(calls()) == 2 }, time.Second*3, time.Millisecond*10)
+	assert.Equal(t, "zone_03", calls()[1][1].GetMeta()["zone"])
+
+	// the services of others changed
+	_, err = client.DiscoveryV1().EndpointSlices(testNamespace).Create(ctx,
+		newSlice("login-abc", "login", newEndpoint("10.0.0.9", "login-0", true)), metav1.CreateOptions{})
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, 2, len(calls()))
+
+	// the pod not ready
+	_, err = client.DiscoveryV1().EndpointSlices(testNamespace).Update(ctx,
+		newSlice("chat-abc", "chat", newEndpoint("10.0.0.1", "chat-0", true), newEndpoint("10.0.0.2", "chat-1", false)),
+		metav1.UpdateOptions{})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return len(calls()) == 3 }, time.Second*3, time.Millisecond*10)
+	assert.Equal(t, 1, len(calls()[2]))
+
+	assert.Nil(t, k.Unsubscribe("chat"))
+	assert.Nil(t, client.DiscoveryV1().EndpointSlices(testNamespace).Delete(ctx, "chat-abc", metav1.DeleteOptions{}))
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, 3, len(calls()))
+}
+
+func Test_k8sNaming_Register(t *testing.T) {
+	k := newTestNaming(t, fake.NewSimpleClientset())
+
+	assert.Nil(t, k.Register(naming.NewEntry("chat01", "chat", "tcp", "10.0.0.1", 8000)))
+	assert.Nil(t, k.Update(naming.NewEntry("chat01", "chat", "tcp", "10.0.0.1", 8000)))
+	services, err := k.Find("chat")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(services))
+	assert.Nil(t, k.Deregister("chat01"))
+}
@@ -0,0 +1,14 @@
+package k8s
+
+import (
+	"github.com/joeyscat/qim/naming"
+	"github.com/joeyscat/qim/naming/backend"
+	"go.uber.org/zap"
+)
+
+// the services select the kubernetes naming with backend.BackendK8s once this package is imported
+func init() {
+	backend.Register(backend.BackendK8s, func(settings backend.Settings, lg *zap.Logger) (naming.Naming, error) {
+		return NewInClusterNaming(settings.K8sNamespace, lg)
+	})
+}
@@ -0,0 +1,123 @@
+// Package memory implements naming.Naming in the process, for the tests and
+// the setups running all of the services in a single process.
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+)
+
+type memoryNaming struct {
+	mu sync.RWMutex
+	// key: serviceID, value: service
+	registry map[string]qim.ServiceRegistration
+	// key: serviceName, value: subscription
+	watchCallback map[string]*naming.Subscription
+}
+
+func NewNaming() naming.Naming {
+	return &memoryNaming{
+		registry:      make(map[string]qim.ServiceRegistration),
+		watchCallback: make(map[string]*naming.Subscription),
+	}
+}
+
+var _ naming.Naming = (*memoryNaming)(nil)
+
+// Find implements naming.Naming, the services are sorted by ID
+func (m *memoryNaming) Find(serviceName string, selectors ...naming.Selector) ([]qim.ServiceRegistration, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.find(serviceName, selectors), nil
+}
+
+func (m *memoryNaming) find(serviceName string, selectors []naming.Selector) []qim.ServiceRegistration {
+	var services []qim.ServiceRegistration
+	for _, s := range m.registry {
+		if s.ServiceName() == serviceName && naming.MatchSelectors(s, selectors...) {
+			services = append(services, naming.Copy(s))
+		}
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].ServiceID() < services[j].ServiceID()
+	})
+	return services
+}
+
+// Register implements naming.Naming
+func (m *memoryNaming) Register(service qim.ServiceRegistration) error {
+	m.mu.Lock()
+	if _, ok := m.registry[service.ServiceID()]; ok {
+		m.mu.Unlock()
+		return fmt.Errorf("service already registered: %s", service.ServiceID())
+	}
+	m.registry[service.ServiceID()] = naming.Copy(service)
+	m.mu.Unlock()
+
+	m.notify(service.ServiceName())
+	return nil
+}
+
+// Update implements naming.Naming
+func (m *memoryNaming) Update(service qim.ServiceRegistration) error {
+	m.mu.Lock()
+	if _, ok := m.registry[service.ServiceID()]; !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("service not registered: %s", service.ServiceID())
+	}
+	m.registry[service.ServiceID()] = naming.Copy(service)
+	m.mu.Unlock()
+
+	m.notify(service.ServiceName())
+	return nil
+}
+
+// Deregister implements naming.Naming
+func (m *memoryNaming) Deregister(serviceID string) error {
+	m.mu.Lock()
+	service, ok := m.registry[serviceID]
+	if !ok {
+		m.mu.Unlock()
+		return naming.ErrNotFound
+	}
+	delete(m.registry, serviceID)
+	m.mu.Unlock()
+
+	m.notify(service.ServiceName())
+	return nil
+}
+
+// Subscribe implements naming.Naming, the callback is called on every change of the service
+func (m *memoryNaming) Subscribe(serviceName string, callback func(services []qim.ServiceRegistration), selectors ...naming.Selector) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchCallback[serviceName] = naming.NewSubscription(callback, selectors...)
+	return nil
+}
+
+// Unsubscribe implements naming.Naming
+func (m *memoryNaming) Unsubscribe(serviceName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.watchCallback, serviceName)
+	return nil
+}
+
+// notify calls the callback of serviceName out of the lock, so that it can call back into the naming,
+// the lists taken by the concurrent changes are delivered in order
+func (m *memoryNaming) notify(serviceName string) {
+	m.mu.RLock()
+	sub, ok := m.watchCallback[serviceName]
+	if !ok {
+		m.mu.RUnlock()
+		return
+	}
+	services := m.find(serviceName, sub.Selectors)
+	seq := sub.Next()
+	m.mu.RUnlock()
+	sub.Deliver(seq, services)
+}
@@ -0,0 +1,153 @@
+package memory
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_memoryNaming_Register(t *testing.T) {
+	n := NewNaming()
+
+	s1 := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+	s2 := naming.NewEntry("s2", "hello", "tcp", "127.0.0.1", 8002)
+	s2.Tags = []string{"a"}
+	s3 := naming.NewEntry("s3", "world", "tcp", "127.0.0.1", 8003)
+
+	assert.Nil(t, n.Register(s1))
+	assert.NotNil(t, n.Register(s1))
+	assert.Nil(t, n.Register(s2))
+	assert.Nil(t, n.Register(s3))
+
+	ss, err := n.Find("hello")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ss))
+	assert.Equal(t, "s1", ss[0].ServiceID())
+
+	ss, err = n.Find("hello", naming.Tags("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ss))
+	assert.Equal(t, "s2", ss[0].ServiceID())
+
+	assert.Nil(t, n.Deregister("s1"))
+	assert.Equal(t, naming.ErrNotFound, n.Deregister("s1"))
+	ss, _ = n.Find("hello")
+	assert.Equal(t, 1, len(ss))
+}
+
+func Test_memoryNaming_Subscribe(t *testing.T) {
+	n := NewNaming()
+
+	var got [][]qim.ServiceRegistration
+	err := n.Subscribe("hello", func(services []qim.ServiceRegistration) {
+		got = append(got, services)
+		// calling back into the naming must not dead lock
+		_, _ = n.Find("hello")
+	})
+	assert.Nil(t, err)
+
+	s1 := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+	assert.Nil(t, n.Register(s1))
+	assert.Nil(t, n.Register(naming.NewEntry("s2", "world", "tcp", "127.0.0.1", 8002)))
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, 1, len(got[0]))
+
+	s1Updated := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+	s1Updated.Meta = map[string]string{"load": "1"}
+	assert.Nil(t, n.Update(s1Updated))
+	assert.Equal(t, 2, len(got))
+	assert.Equal(t, "1", got[1][0].GetMeta()["load"])
+
+	assert.Nil(t, n.Deregister("s1"))
+	assert.Equal(t, 3, len(got))
+	assert.Empty(t, got[2])
+
+	assert.Nil(t, n.Unsubscribe("hello"))
+	assert.Nil(t, n.Register(s1))
+	assert.Equal(t, 3, len(got))
+}
+
+func Test_memoryNaming_SubscribeOrder(t *testing.T) {
+	n := NewNaming()
+
+	var mu sync.Mutex
+	var last []qim.ServiceRegistration
+	err := n.Subscribe("hello", func(services []qim.ServiceRegistration) {
+		// the callbacks of the concurrent changes would return in any order
+		time.Sleep(time.Microsecond * time.Duration(rand.Intn(100)))
+		mu.Lock()
+		defer mu.Unlock()
+		last = services
+	})
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_ = n.Register(naming.NewEntry(fmt.Sprintf("s%02d", i), "hello", "tcp", "127.0.0.1", uint16(8000+i)))
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	// the list delivered last is the latest one
+	ss, _ := n.Find("hello")
+	assert.Equal(t, 50, len(ss))
+	assert.Equal(t, ss, last)
+}
+
+func Test_memoryNaming_Copy(t *testing.T) {
+	n := NewNaming()
+
+	assert.Nil(t, n.Register(naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)))
+	ss, _ := n.Find("hello")
+	// the meta of the services found can be changed by the caller
+	ss[0].GetMeta()["state"] = "young"
+
+	ss, _ = n.Find("hello")
+	assert.Empty(t, ss[0].GetMeta())
+}
+
+func Test_memoryNaming_Selector(t *testing.T) {
+	n := NewNaming()
+
+	s1 := naming.NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)
+	s1.Meta = map[string]string{"idc": "SH_ALI"}
+	s2 := naming.NewEntry("s2", "hello", "tcp", "127.0.0.1", 8002)
+	s2.Meta = map[string]string{"idc": "HZ_ALI"}
+	assert.Nil(t, n.Register(s1))
+	assert.Nil(t, n.Register(s2))
+
+	ss, err := n.Find("hello", naming.Equals("idc", "SH_ALI"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ss))
+	assert.Equal(t, "s1", ss[0].ServiceID())
+
+	ss, _ = n.Find("hello", naming.MustParseSelector("idc in (SH_ALI,HZ_ALI)"))
+	assert.Equal(t, 2, len(ss))
+
+	// the subscriber gets the services selected only
+	var got [][]qim.ServiceRegistration
+	err = n.Subscribe("hello", func(services []qim.ServiceRegistration) {
+		got = append(got, services)
+	}, naming.Equals("idc", "HZ_ALI"))
+	assert.Nil(t, err)
+
+	s3 := naming.NewEntry("s3", "hello", "tcp", "127.0.0.1", 8003)
+	s3.Meta = map[string]string{"idc": "HZ_ALI"}
+	assert.Nil(t, n.Register(s3))
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, 2, len(got[0]))
+	assert.Equal(t, "s2", got[0][0].ServiceID())
+	assert.Equal(t, "s3", got[0][1].ServiceID())
+}
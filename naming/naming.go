@@ -11,9 +11,14 @@ var (
 )
 
 type Naming interface {
-	Find(serviceName string, tags ...string) ([]qim.ServiceRegistration, error)
-	Subscribe(serviceName string, callback func(services []qim.ServiceRegistration)) error
+	// Find returns the services matching all of selectors
+	Find(serviceName string, selectors ...Selector) ([]qim.ServiceRegistration, error)
+	// Subscribe calls back with the services matching all of selectors if any service is changed
+	Subscribe(serviceName string, callback func(services []qim.ServiceRegistration), selectors ...Selector) error
 	Unsubscribe(serviceName string) error
 	Register(service qim.ServiceRegistration) error
 	Deregister(serviceID string) error
+	// Update changes the meta and tags of a registered service, such as the load published by the service,
+	// the subscribers of the service are called back with the change.
+	Update(service qim.ServiceRegistration) error
 }
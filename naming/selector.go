@@ -0,0 +1,253 @@
+package naming
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/joeyscat/qim"
+	"golang.org/x/exp/slices"
+)
+
+type Operator string
+
+const (
+	OpEquals       Operator = "="
+	OpNotEquals    Operator = "!="
+	OpIn           Operator = "in"
+	OpNotIn        Operator = "notin"
+	OpExists       Operator = "exists"
+	OpDoesNotExist Operator = "!"
+)
+
+// Requirement is a condition on a key of the meta of a service
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Matches reports whether meta meets the requirement, a missing key does not equal any value,
+// so that it meets != and notin. A requirement of = or != without a value matches nothing.
+func (r Requirement) Matches(meta map[string]string) bool {
+	val, ok := meta[r.Key]
+	switch r.Operator {
+	case OpEquals:
+		return ok && len(r.Values) > 0 && val == r.Values[0]
+	case OpNotEquals:
+		return len(r.Values) > 0 && (!ok || val != r.Values[0])
+	case OpIn:
+		return ok && slices.Contains(r.Values, val)
+	case OpNotIn:
+		return !ok || !slices.Contains(r.Values, val)
+	case OpExists:
+		return ok
+	case OpDoesNotExist:
+		return !ok
+	default:
+		return false
+	}
+}
+
+func (r Requirement) String() string {
+	switch r.Operator {
+	case OpEquals, OpNotEquals:
+		return r.Key + string(r.Operator) + strings.Join(r.Values, ",")
+	case OpIn, OpNotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+	case OpDoesNotExist:
+		return "!" + r.Key
+	default:
+		return r.Key
+	}
+}
+
+// Selector selects the services having all of the tags and meeting all of the requirements,
+// the selectors passed to Find and Subscribe are combined in the same way.
+type Selector struct {
+	Tags         []string
+	Requirements []Requirement
+}
+
+// Matches reports whether the service is selected
+func (s Selector) Matches(service qim.ServiceRegistration) bool {
+	if !MatchTags(service.GetTags(), s.Tags) {
+		return false
+	}
+	for _, r := range s.Requirements {
+		if !r.Matches(service.GetMeta()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	terms := make([]string, 0, len(s.Requirements))
+	for _, r := range s.Requirements {
+		terms = append(terms, r.String())
+	}
+	if len(s.Tags) > 0 {
+		terms = append([]string{fmt.Sprintf("tags(%s)", strings.Join(s.Tags, ","))}, terms...)
+	}
+	return strings.Join(terms, ",")
+}
+
+// Tags selects the services having all of tags
+func Tags(tags ...string) Selector {
+	return Selector{Tags: tags}
+}
+
+func Equals(key, value string) Selector {
+	return Selector{Requirements: []Requirement{{Key: key, Operator: OpEquals, Values: []string{value}}}}
+}
+
+func NotEquals(key, value string) Selector {
+	return Selector{Requirements: []Requirement{{Key: key, Operator: OpNotEquals, Values: []string{value}}}}
+}
+
+func In(key string, values ...string) Selector {
+	return Selector{Requirements: []Requirement{{Key: key, Operator: OpIn, Values: values}}}
+}
+
+func NotIn(key string, values ...string) Selector {
+	return Selector{Requirements: []Requirement{{Key: key, Operator: OpNotIn, Values: values}}}
+}
+
+func Exists(key string) Selector {
+	return Selector{Requirements: []Requirement{{Key: key, Operator: OpExists}}}
+}
+
+func DoesNotExist(key string) Selector {
+	return Selector{Requirements: []Requirement{{Key: key, Operator: OpDoesNotExist}}}
+}
+
+// Select returns the services matching all of selectors
+func Select(services []qim.ServiceRegistration, selectors ...Selector) []qim.ServiceRegistration {
+	if len(selectors) == 0 {
+		return services
+	}
+	var selected []qim.ServiceRegistration
+	for _, s := range services {
+		if MatchSelectors(s, selectors...) {
+			selected = append(selected, s)
+		}
+	}
+	return selected
+}
+
+// MatchSelectors reports whether the service matches all of selectors
+func MatchSelectors(service qim.ServiceRegistration, selectors ...Selector) bool {
+	for _, s := range selectors {
+		if !s.Matches(service) {
+			return false
+		}
+	}
+	return true
+}
+
+// SelectedTags returns the tags of all selectors, for the namings which filter the tags on the server
+func SelectedTags(selectors ...Selector) []string {
+	var tags []string
+	for _, s := range selectors {
+		tags = append(tags, s.Tags...)
+	}
+	return tags
+}
+
+var (
+	keyPattern = regexp.MustCompile(`^[A-Za-z0-9_.:/-]+$`)
+	valPattern = regexp.MustCompile(`^[A-Za-z0-9_.:/-]*$`)
+	setPattern = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+)
+
+// ParseSelector parses the requirements separated by comma, such as
+//
+//	idc=SH_ALI,zone!=zone_01,env in (dev,qa),version notin (1.0),draining,!deprecated
+//
+// == is the same as =, a key alone requires the key to exist and !key requires it not to.
+func ParseSelector(selector string) (Selector, error) {
+	var s Selector
+	for _, term := range splitTerms(selector) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		r, err := parseRequirement(term)
+		if err != nil {
+			return Selector{}, err
+		}
+		s.Requirements = append(s.Requirements, r)
+	}
+	return s, nil
+}
+
+// MustParseSelector is like ParseSelector but panics if the selector is invalid
+func MustParseSelector(selector string) Selector {
+	s, err := ParseSelector(selector)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// splitTerms splits the selector by the commas out of parentheses
+func splitTerms(selector string) []string {
+	var terms []string
+	depth, start := 0, 0
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, selector[start:])
+}
+
+func parseRequirement(term string) (Requirement, error) {
+	if m := setPattern.FindStringSubmatch(term); m != nil {
+		if strings.TrimSpace(m[3]) == "" {
+			return Requirement{}, fmt.Errorf("empty set in %q", term)
+		}
+		var values []string
+		for _, v := range strings.Split(m[3], ",") {
+			v = strings.TrimSpace(v)
+			if !valPattern.MatchString(v) {
+				return Requirement{}, fmt.Errorf("invalid value %q in %q", v, term)
+			}
+			values = append(values, v)
+		}
+		return newRequirement(m[1], Operator(m[2]), values, term)
+	}
+	for _, op := range []string{"!=", "==", "="} {
+		if key, val, ok := strings.Cut(term, op); ok {
+			key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+			if !valPattern.MatchString(val) {
+				return Requirement{}, fmt.Errorf("invalid value %q in %q", val, term)
+			}
+			operator := OpEquals
+			if op == "!=" {
+				operator = OpNotEquals
+			}
+			return newRequirement(key, operator, []string{val}, term)
+		}
+	}
+	if strings.HasPrefix(term, "!") {
+		return newRequirement(strings.TrimSpace(term[1:]), OpDoesNotExist, nil, term)
+	}
+	return newRequirement(term, OpExists, nil, term)
+}
+
+func newRequirement(key string, op Operator, values []string, term string) (Requirement, error) {
+	if !keyPattern.MatchString(key) {
+		return Requirement{}, fmt.Errorf("invalid key %q in %q", key, term)
+	}
+	return Requirement{Key: key, Operator: op, Values: values}, nil
+}
@@ -0,0 +1,85 @@
+package naming
+
+import (
+	"testing"
+
+	"github.com/joeyscat/qim"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelector(t *testing.T) {
+	s, err := ParseSelector("idc=SH_ALI, zone!=zone_01,env in (dev, qa),version notin (1.0),draining,!deprecated,app==im")
+	assert.Nil(t, err)
+	assert.Equal(t, []Requirement{
+		{Key: "idc", Operator: OpEquals, Values: []string{"SH_ALI"}},
+		{Key: "zone", Operator: OpNotEquals, Values: []string{"zone_01"}},
+		{Key: "env", Operator: OpIn, Values: []string{"dev", "qa"}},
+		{Key: "version", Operator: OpNotIn, Values: []string{"1.0"}},
+		{Key: "draining", Operator: OpExists},
+		{Key: "deprecated", Operator: OpDoesNotExist},
+		{Key: "app", Operator: OpEquals, Values: []string{"im"}},
+	}, s.Requirements)
+	assert.Equal(t, "idc=SH_ALI,zone!=zone_01,env in (dev,qa),version notin (1.0),draining,!deprecated,app=im", s.String())
+
+	s, err = ParseSelector("")
+	assert.Nil(t, err)
+	assert.Empty(t, s.Requirements)
+
+	for _, invalid := range []string{"=a", "a b", "env in (a b)", "a=b c", "!", "env in ()", "env notin ( )"} {
+		_, err = ParseSelector(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	service := &DefaultService{
+		ID:   "gate01",
+		Name: "wgateway",
+		Tags: []string{"IDC:SH_ALI"},
+		Meta: map[string]string{"idc": "SH_ALI", "env": "dev"},
+	}
+	tests := []struct {
+		selector Selector
+		want     bool
+	}{
+		{Equals("idc", "SH_ALI"), true},
+		{Equals("idc", "HZ_ALI"), false},
+		{NotEquals("idc", "HZ_ALI"), true},
+		{NotEquals("zone", "zone_01"), true},
+		{In("env", "dev", "qa"), true},
+		{In("env", "prod"), false},
+		{In("zone", "zone_01"), false},
+		{NotIn("env", "prod"), true},
+		{NotIn("env", "dev"), false},
+		{Exists("env"), true},
+		{Exists("zone"), false},
+		{DoesNotExist("zone"), true},
+		{DoesNotExist("env"), false},
+		{Tags("IDC:SH_ALI"), true},
+		{Tags("IDC:HZ_ALI"), false},
+		{MustParseSelector("idc=SH_ALI,env in (dev,qa),!draining"), true},
+		{MustParseSelector("idc=SH_ALI,env=prod"), false},
+		{Selector{}, true},
+		// a requirement built without a value matches nothing
+		{Selector{Requirements: []Requirement{{Key: "idc", Operator: OpEquals}}}, false},
+		{Selector{Requirements: []Requirement{{Key: "idc", Operator: OpNotEquals}}}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.selector.Matches(service), tt.selector.String())
+	}
+}
+
+func TestSelect(t *testing.T) {
+	s1 := &DefaultService{ID: "s1", Tags: []string{"a"}, Meta: map[string]string{"idc": "SH_ALI"}}
+	s2 := &DefaultService{ID: "s2", Tags: []string{"a"}, Meta: map[string]string{"idc": "HZ_ALI"}}
+	s3 := &DefaultService{ID: "s3", Meta: map[string]string{"idc": "SH_ALI"}}
+	services := []qim.ServiceRegistration{s1, s2, s3}
+
+	assert.Equal(t, services, Select(services))
+	assert.Equal(t, []qim.ServiceRegistration{s1, s3}, Select(services, Equals("idc", "SH_ALI")))
+	// the selectors are combined
+	assert.Equal(t, []qim.ServiceRegistration{s1}, Select(services, Equals("idc", "SH_ALI"), Tags("a")))
+	assert.Empty(t, Select(services, Equals("idc", "BJ_ALI")))
+
+	assert.Equal(t, []string{"a", "b"}, SelectedTags(Tags("a"), Equals("idc", "SH_ALI"), Tags("b")))
+}
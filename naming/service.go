@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/joeyscat/qim"
+	"golang.org/x/exp/slices"
 )
 
 // "ID": "qa-dfirst-zfirst-tgateway-172.16.235.145-0-8000",
@@ -94,3 +95,36 @@ func (s *DefaultService) ServiceName() string {
 
 var _ qim.Service = (*DefaultService)(nil)
 var _ qim.ServiceRegistration = (*DefaultService)(nil)
+
+// MatchTags reports whether all of matchTags are in srcTags, it is true if matchTags is empty
+func MatchTags(srcTags, matchTags []string) bool {
+	for _, mt := range matchTags {
+		if !slices.Contains(srcTags, mt) {
+			return false
+		}
+	}
+	return true
+}
+
+// Copy returns a DefaultService with the fields of s, its tags and meta are copied so that
+// the copy can be changed by the caller, such as the state of the service set by the container.
+func Copy(s qim.ServiceRegistration) *DefaultService {
+	meta := make(map[string]string, len(s.GetMeta()))
+	for k, v := range s.GetMeta() {
+		meta[k] = v
+	}
+	var tags []string
+	if len(s.GetTags()) > 0 {
+		tags = append(tags, s.GetTags()...)
+	}
+	return &DefaultService{
+		ID:        s.ServiceID(),
+		Name:      s.ServiceName(),
+		Address:   s.PublicAddress(),
+		Port:      s.PublicPort(),
+		Protocol:  s.GetProtocol(),
+		Namespace: s.GetNamespace(),
+		Tags:      tags,
+		Meta:      meta,
+	}
+}
@@ -0,0 +1,62 @@
+package naming
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/joeyscat/qim"
+)
+
+// Subscription calls back a subscriber in the order the lists of the services are taken, for the
+// namings calling back on the goroutines which change the services. A list is taken with Next under
+// the lock of the naming, and delivered with Deliver out of the lock.
+type Subscription struct {
+	Callback  func([]qim.ServiceRegistration)
+	Selectors []Selector
+
+	seq uint64 // the sequence of the list taken last
+
+	mu         sync.Mutex
+	delivered  uint64 // the sequence of the list delivered last
+	pending    []qim.ServiceRegistration
+	hasPending bool
+	delivering bool
+}
+
+// NewSubscription returns a subscription calling back with the services matching all of selectors
+func NewSubscription(callback func([]qim.ServiceRegistration), selectors ...Selector) *Subscription {
+	return &Subscription{Callback: callback, Selectors: selectors}
+}
+
+// Next returns the sequence of a list of the services, it must be taken with the list under the
+// same lock, so that a later list always has a greater sequence.
+func (s *Subscription) Next() uint64 {
+	return atomic.AddUint64(&s.seq, 1)
+}
+
+// Deliver calls back with the services of seq unless a later list has been delivered. The callbacks
+// never run at the same time: the list is handed over to the callback running, which delivers the
+// latest list once it returns, so that a callback can still call back into the naming.
+func (s *Subscription) Deliver(seq uint64, services []qim.ServiceRegistration) {
+	s.mu.Lock()
+	if seq <= s.delivered {
+		s.mu.Unlock()
+		return
+	}
+	s.delivered = seq
+	s.pending, s.hasPending = services, true
+	if s.delivering {
+		s.mu.Unlock()
+		return
+	}
+	s.delivering = true
+	for s.hasPending {
+		services = s.pending
+		s.pending, s.hasPending = nil, false
+		s.mu.Unlock()
+		s.Callback(services)
+		s.mu.Lock()
+	}
+	s.delivering = false
+	s.mu.Unlock()
+}
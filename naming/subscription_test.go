@@ -0,0 +1,30 @@
+package naming
+
+import (
+	"testing"
+
+	"github.com/joeyscat/qim"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscription_Deliver(t *testing.T) {
+	var got []string
+	var sub *Subscription
+	sub = NewSubscription(func(services []qim.ServiceRegistration) {
+		got = append(got, services[0].ServiceID())
+		// the list delivered by the callback is delivered once the callback returns
+		if len(got) == 1 {
+			sub.Deliver(sub.Next(), []qim.ServiceRegistration{NewEntry("s3", "hello", "tcp", "127.0.0.1", 8003)})
+			assert.Equal(t, []string{"s1"}, got)
+		}
+	})
+
+	seq1 := sub.Next()
+	seq2 := sub.Next()
+	sub.Deliver(seq1, []qim.ServiceRegistration{NewEntry("s1", "hello", "tcp", "127.0.0.1", 8001)})
+	assert.Equal(t, []string{"s1", "s3"}, got)
+
+	// a list taken before the one delivered last is dropped
+	sub.Deliver(seq2, []qim.ServiceRegistration{NewEntry("s2", "hello", "tcp", "127.0.0.1", 8002)})
+	assert.Equal(t, []string{"s1", "s3"}, got)
+}
@@ -121,6 +121,8 @@ type DialerContext struct {
 	Name    string
 	Address string
 	Timeout time.Duration
+	// Index of the connection in the pool
+	Index int
 }
 
 type OpCode byte
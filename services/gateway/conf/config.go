@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/joeyscat/qim"
 	"github.com/kelseyhightower/envconfig"
@@ -12,19 +13,41 @@ import (
 )
 
 type Config struct {
-	ServiceID       string
-	ServiceName     string `default:"wgateway"`
-	Listen          string `default:":8000"`
-	PublicAddress   string
-	PublicPort      uint16 `default:"8000"`
-	Tags            []string
-	Domain          string
-	EtcdEndpoints   string
-	MonitorPort     uint16 `default:"8001"`
-	AppSecret       string
-	LogLevel        string `default:"debug"`
-	MessageGPool    int    `default:"10000"`
-	ConnectionGPool int    `default:"15000"`
+	ServiceID     string
+	ServiceName   string `default:"wgateway"`
+	Listen        string `default:":8000"`
+	PublicAddress string
+	PublicPort    uint16 `default:"8000"`
+	Tags          []string
+	Domain        string
+	// Idc is published in the meta for the router, it is taken from the tag IDC:xxx if it is empty
+	Idc              string
+	Naming           string `default:"etcd"`
+	EtcdEndpoints    string
+	ConsulAddress    string
+	NamingFile       string
+	DNSDomain        string
+	K8sNamespace     string
+	MonitorPort      uint16 `default:"8001"`
+	AppSecret        string
+	LogLevel         string `default:"debug"`
+	MessageGPool     int    `default:"10000"`
+	ConnectionGPool  int    `default:"15000"`
+	TraceExporter    string
+	TraceEndpoint    string
+	TraceSampleRatio float64 `default:"1"`
+	Warmups          map[string]time.Duration
+	SlowStart        time.Duration
+	ForwardRetries   int           `default:"2"`
+	RetryBudget      float64       `default:"0.2"`
+	OutlierFailures  int           `default:"3"`
+	OutlierEjection  time.Duration `default:"30s"`
+	PoolSize         int           `default:"1"`
+	AdminToken       string        `json:"-"`
+	LoadReport       time.Duration `default:"10s"`
+	DrainBatch       int           `default:"100"`
+	DrainInterval    time.Duration `default:"1s"`
+	DrainTimeout     time.Duration `default:"5m"`
 }
 
 func (c Config) String() string {
@@ -32,6 +55,19 @@ func (c Config) String() string {
 	return string(bts)
 }
 
+// IdcOf returns the Idc, or the one in the tags like IDC:SH_ALI
+func (c Config) IdcOf() string {
+	if c.Idc != "" {
+		return c.Idc
+	}
+	for _, tag := range c.Tags {
+		if strings.HasPrefix(tag, "IDC:") {
+			return strings.TrimPrefix(tag, "IDC:")
+		}
+	}
+	return ""
+}
+
 func Init(file string) (*Config, error) {
 	viper.SetConfigFile(file)
 	viper.AddConfigPath(".")
@@ -63,3 +99,23 @@ func Init(file string) (*Config, error) {
 
 	return &config, nil
 }
+
+// Reload reads the config file again, unlike Init it returns the error
+// instead of exiting, so that the config in use is kept if the file is broken.
+func Reload(file string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("yaml")
+
+	var config Config
+	if err := envconfig.Process("qim", &config); err != nil {
+		return nil, err
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read config error: %w", err)
+	}
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
@@ -2,6 +2,8 @@ package conf
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 )
 
@@ -15,13 +17,20 @@ type Route struct {
 	Zones     []Zone
 	Whitelist map[string]string
 	Slots     []int
+	// VirtualNodes of a service on the hash ring of a zone
+	VirtualNodes int
+	// LoadTolerance is the ratio a service is allowed to be loaded above the mean of its zone,
+	// the overloaded services are skipped by new accounts. 0 disables it.
+	LoadTolerance float64
 }
 
 func ReadRoute(path string) (*Route, error) {
 	var conf struct {
-		RouteBy   string `json:"route_by,omitempty"`
-		Zones     []Zone `json:"zones,omitempty"`
-		Whitelist []struct {
+		RouteBy       string  `json:"route_by,omitempty"`
+		Zones         []Zone  `json:"zones,omitempty"`
+		VirtualNodes  int     `json:"virtual_nodes,omitempty"`
+		LoadTolerance float64 `json:"load_tolerance,omitempty"`
+		Whitelist     []struct {
 			Key   string `json:"key,omitempty"`
 			Value string `json:"value,omitempty"`
 		} `json:"whitelist,omitempty"`
@@ -38,10 +47,12 @@ func ReadRoute(path string) (*Route, error) {
 	}
 
 	var rt = Route{
-		RouteBy:   conf.RouteBy,
-		Zones:     conf.Zones,
-		Whitelist: make(map[string]string, len(conf.Whitelist)),
-		Slots:     make([]int, 0),
+		RouteBy:       conf.RouteBy,
+		Zones:         conf.Zones,
+		Whitelist:     make(map[string]string, len(conf.Whitelist)),
+		Slots:         make([]int, 0),
+		VirtualNodes:  conf.VirtualNodes,
+		LoadTolerance: conf.LoadTolerance,
 	}
 
 	// build slots
@@ -56,5 +67,45 @@ func ReadRoute(path string) (*Route, error) {
 		rt.Whitelist[wl.Key] = wl.Value
 	}
 
+	if err := rt.Validate(); err != nil {
+		return nil, err
+	}
 	return &rt, nil
 }
+
+// Validate checks the route before it is used
+func (r *Route) Validate() error {
+	switch r.RouteBy {
+	case "", "app", "account":
+	default:
+		return fmt.Errorf("unsupported route_by: %s", r.RouteBy)
+	}
+	if r.VirtualNodes < 0 {
+		return fmt.Errorf("virtual_nodes must not be negative: %d", r.VirtualNodes)
+	}
+	if r.LoadTolerance < 0 {
+		return fmt.Errorf("load_tolerance must not be negative: %v", r.LoadTolerance)
+	}
+	if len(r.Zones) == 0 {
+		return errors.New("zones is empty")
+	}
+	zones := make(map[string]struct{}, len(r.Zones))
+	for _, zone := range r.Zones {
+		if zone.ID == "" {
+			return errors.New("zone id is empty")
+		}
+		if zone.Weight <= 0 {
+			return fmt.Errorf("weight of zone %s must be positive", zone.ID)
+		}
+		if _, ok := zones[zone.ID]; ok {
+			return fmt.Errorf("zone %s is repeated", zone.ID)
+		}
+		zones[zone.ID] = struct{}{}
+	}
+	for key, zone := range r.Whitelist {
+		if _, ok := zones[zone]; !ok {
+			return fmt.Errorf("zone %s of whitelist %s not found", zone, key)
+		}
+	}
+	return nil
+}
@@ -27,6 +27,7 @@ func (d *TcpDialer) DialAndHandshake(ctx qim.DialerContext) (net.Conn, error) {
 	}
 	req := &pkt.InnerHandshakeReq{
 		ServiceId: d.ServiceID,
+		Index:     uint32(ctx.Index),
 	}
 
 	bts, _ := proto.Marshal(req)
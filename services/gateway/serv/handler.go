@@ -2,6 +2,7 @@ package serv
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
@@ -9,9 +10,13 @@ import (
 
 	"github.com/joeyscat/qim"
 	"github.com/joeyscat/qim/container"
+	"github.com/joeyscat/qim/tracing"
 	"github.com/joeyscat/qim/wire"
 	"github.com/joeyscat/qim/wire/pkt"
 	"github.com/joeyscat/qim/wire/token"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -93,6 +98,7 @@ func (h *Handler) Accept(conn qim.Conn, timeout time.Duration) (string, qim.Meta
 		GateId:    h.serviceID,
 		App:       tk.App,
 		RemoteIp:  getIP(conn.RemoteAddr().String()),
+		Device:    tk.Device,
 	})
 	req.AddStringMeta(MetaKeyApp, tk.App)
 	req.AddStringMeta(MetaKeyAccount, tk.Account)
@@ -127,6 +133,8 @@ func (h *Handler) Receive(agent qim.Agent, payload []byte) {
 
 	if logicPkt, ok := packet.(*pkt.LogicPkt); ok {
 		logicPkt.ChannelId = agent.ID()
+		// only the services call each other, a client cannot pass itself off as one
+		logicPkt.DelMeta(wire.MetaCallFrom)
 
 		messageInTotal.WithLabelValues(h.serviceID, wire.SNTGateway, logicPkt.GetCommand()).Inc()
 		messageInFlowBytes.WithLabelValues(h.serviceID, wire.SNTGateway, logicPkt.GetCommand()).Add(float64(len(payload)))
@@ -136,8 +144,19 @@ func (h *Handler) Receive(agent qim.Agent, payload []byte) {
 			logicPkt.AddStringMeta(MetaKeyAccount, agent.GetMeta()[MetaKeyAccount])
 		}
 
+		ctx, span := tracing.Tracer().Start(tracing.Extract(context.Background(), &logicPkt.Header), logicPkt.GetCommand(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("qim.command", logicPkt.GetCommand()),
+				attribute.String("qim.channel_id", agent.ID()),
+				attribute.Int64("qim.sequence", int64(logicPkt.GetSequence())),
+			))
+		defer span.End()
+		tracing.Inject(ctx, &logicPkt.Header)
+
 		err = container.Forward(logicPkt.ServiceName(), logicPkt)
 		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
 			h.lg.Error("container.Forward error", zap.Error(err),
 				zap.String("id", agent.ID()),
 				zap.String("command", logicPkt.GetCommand()),
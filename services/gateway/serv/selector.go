@@ -3,16 +3,20 @@ package serv
 import (
 	"hash/crc32"
 	"math/rand"
+	"sync"
 
 	"github.com/joeyscat/qim"
 	"github.com/joeyscat/qim/container"
 	"github.com/joeyscat/qim/services/gateway/conf"
+	"github.com/joeyscat/qim/wire"
 	"github.com/joeyscat/qim/wire/pkt"
 	"go.uber.org/zap"
 )
 
 type RouteSelector struct {
+	sync.RWMutex
 	route *conf.Route
+	ring  *container.RingSelector
 	lg    *zap.Logger
 }
 
@@ -23,12 +27,36 @@ func NewRouteSelector(configPath string, lg *zap.Logger) (*RouteSelector, error)
 	}
 	return &RouteSelector{
 		route: route,
+		ring:  container.NewRingSelector(route.VirtualNodes),
 		lg:    lg,
 	}, nil
 }
 
 var _ container.Selector = (*RouteSelector)(nil)
 
+// Route returns the route config of the selector
+func (s *RouteSelector) Route() any {
+	s.RLock()
+	defer s.RUnlock()
+	return s.route
+}
+
+// Reload replaces the route with the config file if it is valid
+func (s *RouteSelector) Reload(configPath string) error {
+	route, err := conf.ReadRoute(configPath)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	if route.VirtualNodes != s.route.VirtualNodes {
+		s.ring = container.NewRingSelector(route.VirtualNodes)
+	}
+	s.route = route
+	s.Unlock()
+	s.lg.Info("route reloaded", zap.Any("route", route))
+	return nil
+}
+
 // Lookup implements container.Selector
 func (s *RouteSelector) Lookup(header *pkt.Header, srvs []qim.Service) string {
 	// read meta from header
@@ -41,10 +69,14 @@ func (s *RouteSelector) Lookup(header *pkt.Header, srvs []qim.Service) string {
 
 	log := s.lg.With(zap.String("app", app.(string)), zap.String("account", accout.(string)))
 
-	zone, ok := s.route.Whitelist[app.(string)]
+	s.RLock()
+	route, ring := s.route, s.ring
+	s.RUnlock()
+
+	zone, ok := route.Whitelist[app.(string)]
 	if !ok {
 		var key string
-		switch s.route.RouteBy {
+		switch route.RouteBy {
 		case MetaKeyApp:
 			key = app.(string)
 		case MetaKeyAccount:
@@ -53,9 +85,9 @@ func (s *RouteSelector) Lookup(header *pkt.Header, srvs []qim.Service) string {
 			key = accout.(string)
 		}
 
-		slot := hashcode(key) % len(s.route.Slots)
-		i := s.route.Slots[slot]
-		zone = s.route.Zones[i].ID
+		slot := hashcode(key) % len(route.Slots)
+		i := route.Slots[slot]
+		zone = route.Zones[i].ID
 	} else {
 		log.Info("hit a zone in whitelist", zap.String("zone", zone))
 	}
@@ -68,8 +100,12 @@ func (s *RouteSelector) Lookup(header *pkt.Header, srvs []qim.Service) string {
 		return srvs[ri].ServiceID()
 	}
 
-	srv := selectSsrvs(zoneSrvs, accout.(string))
-	return srv.ServiceID()
+	// the chat servers keep no state of the accounts, so the chat packets and the sign-ins avoid the
+	// overloaded services, while the other login packets stay on the login server of the account
+	if header.ServiceName() == wire.SNChat || header.Command == wire.CommandLoginSignIn {
+		zoneSrvs = container.Underloaded(zoneSrvs, route.LoadTolerance)
+	}
+	return ring.LookupKey(accout.(string), zoneSrvs)
 }
 
 func filterSrvs(srvs []qim.Service, zone string) []qim.Service {
@@ -82,17 +118,6 @@ func filterSrvs(srvs []qim.Service, zone string) []qim.Service {
 	return res
 }
 
-func selectSsrvs(srvs []qim.Service, account string) qim.Service {
-	slots := make([]int, 0, len(srvs)*10)
-	for i := range srvs {
-		for j := 0; j < 10; j++ {
-			slots = append(slots, i)
-		}
-	}
-	slot := hashcode(account) % len(slots)
-	return srvs[slots[slot]]
-}
-
 func hashcode(key string) int {
 	hash32 := crc32.NewIEEE()
 	hash32.Write([]byte(key))
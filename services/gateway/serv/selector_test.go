@@ -1,9 +1,13 @@
 package serv
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/container"
 	"github.com/joeyscat/qim/naming"
 	"github.com/joeyscat/qim/wire"
 	"github.com/joeyscat/qim/wire/pkt"
@@ -48,3 +52,54 @@ func TestRouteSelector_Lookup(t *testing.T) {
 
 	t.Log(hits)
 }
+
+func TestRouteSelector_Reload(t *testing.T) {
+	rs, err := NewRouteSelector("../route.json", zap.NewNop())
+	assert.Nil(t, err)
+	route := rs.Route()
+
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	err = os.WriteFile(invalid, []byte(`{"route_by":"account","zones":[{"id":"zone_01","weight":0}]}`), 0644)
+	assert.Nil(t, err)
+	assert.Error(t, rs.Reload(invalid))
+	assert.Equal(t, route, rs.Route())
+
+	valid := filepath.Join(dir, "valid.json")
+	err = os.WriteFile(valid, []byte(`{"route_by":"app","zones":[{"id":"zone_09","weight":10}]}`), 0644)
+	assert.Nil(t, err)
+	assert.Nil(t, rs.Reload(valid))
+
+	srvs := []qim.Service{
+		&naming.DefaultService{ID: "s1", Meta: map[string]string{"zone": "zone_01"}},
+		&naming.DefaultService{ID: "s9", Meta: map[string]string{"zone": "zone_09"}},
+	}
+	packet := pkt.New(wire.CommandChatUserTalk, pkt.WithChannel(ksuid.New().String()))
+	packet.AddStringMeta(MetaKeyApp, "qim")
+	packet.AddStringMeta(MetaKeyAccount, "test1")
+	assert.Equal(t, "s9", rs.Lookup(&packet.Header, srvs))
+}
+
+func TestRouteSelector_Underloaded(t *testing.T) {
+	srvs := []qim.Service{
+		&naming.DefaultService{ID: "s1", Meta: map[string]string{"zone": "zone_02", container.KeyLoadChannels: "1000"}},
+		&naming.DefaultService{ID: "s2", Meta: map[string]string{"zone": "zone_02", container.KeyLoadChannels: "10"}},
+	}
+	rs, err := NewRouteSelector("../route.json", zap.NewNop())
+	assert.Nil(t, err)
+
+	lookup := func(command, account string) string {
+		packet := pkt.New(command, pkt.WithChannel(ksuid.New().String()))
+		packet.AddStringMeta(MetaKeyApp, "qim")
+		packet.AddStringMeta(MetaKeyAccount, account)
+		return rs.Lookup(&packet.Header, srvs)
+	}
+	for i := 0; i < 100; i++ {
+		account := fmt.Sprintf("account_%d", i)
+		// the accounts signing in and the chat packets go to the service not overloaded
+		assert.Equal(t, "s2", lookup(wire.CommandLoginSignIn, account))
+		assert.Equal(t, "s2", lookup(wire.CommandChatUserTalk, account))
+		// the other login packets stay on the login server of the account
+		assert.Equal(t, rs.ring.LookupKey(account, srvs), lookup(wire.CommandLoginSignOut, account))
+	}
+}
@@ -0,0 +1,94 @@
+package serv
+
+import (
+	"sync"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/container"
+	"github.com/joeyscat/qim/naming"
+	"go.uber.org/zap"
+)
+
+// GatewaySuggester suggests the draining channels to reconnect to the other gateways in the same
+// IDC, like the router does. The gateways are found again once in interval, that is once per batch
+// of the drain, so that a failed lookup is retried at the next batch.
+type GatewaySuggester struct {
+	ns        naming.Naming
+	self      qim.ServiceRegistration
+	tolerance float64
+	interval  time.Duration
+	ring      *container.RingSelector
+	lg        *zap.Logger
+
+	mu       sync.Mutex
+	expire   time.Time
+	gateways []qim.ServiceRegistration
+}
+
+// NewGatewaySuggester returns a suggester refreshing the gateways once in interval, it is
+// container.DefaultDrainInterval if interval is not positive.
+func NewGatewaySuggester(ns naming.Naming, self qim.ServiceRegistration, tolerance float64, interval time.Duration, lg *zap.Logger) *GatewaySuggester {
+	if interval <= 0 {
+		interval = container.DefaultDrainInterval
+	}
+	return &GatewaySuggester{
+		ns:        ns,
+		self:      self,
+		tolerance: tolerance,
+		interval:  interval,
+		ring:      container.NewRingSelector(container.DefaultVirtualNodes),
+		lg:        lg,
+	}
+}
+
+// Suggest is a container.SuggestGateway, the domain of a gateway not overloaded is returned
+func (s *GatewaySuggester) Suggest(ch qim.Channel) string {
+	gateways := s.refresh()
+	if len(gateways) == 0 {
+		return ""
+	}
+	key := ch.ID()
+	if account, ok := ch.GetMeta()[MetaKeyAccount]; ok {
+		key = account
+	}
+	srvs := make([]qim.Service, len(gateways))
+	for i, gateway := range gateways {
+		srvs[i] = gateway
+	}
+	id := s.ring.LookupKey(key, srvs)
+	for _, gateway := range gateways {
+		if gateway.ServiceID() == id {
+			return gateway.GetMeta()["domain"]
+		}
+	}
+	return ""
+}
+
+// refresh returns the gateways found, they are found again if they are expired
+func (s *GatewaySuggester) refresh() []qim.ServiceRegistration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := time.Now(); now.After(s.expire) {
+		s.expire = now.Add(s.interval)
+		s.find()
+	}
+	return s.gateways
+}
+
+// find keeps the gateways found last if the lookup fails
+func (s *GatewaySuggester) find() {
+	gateways, err := s.ns.Find(s.self.ServiceName(), naming.Equals("idc", s.self.GetMeta()["idc"]))
+	if err != nil {
+		s.lg.Warn("find gateways failed", zap.Error(err))
+		return
+	}
+	others := make([]qim.ServiceRegistration, 0, len(gateways))
+	for _, gateway := range gateways {
+		if gateway.ServiceID() != s.self.ServiceID() && gateway.GetMeta()["domain"] != "" {
+			others = append(others, gateway)
+		}
+	}
+	s.gateways = container.Underloaded(others, s.tolerance)
+	s.lg.Info("gateways suggested", zap.Int("count", len(s.gateways)))
+}
@@ -0,0 +1,63 @@
+package serv
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/naming"
+	"github.com/joeyscat/qim/naming/memory"
+	"github.com/joeyscat/qim/wire"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// failNaming fails the lookups while fail is set
+type failNaming struct {
+	naming.Naming
+	fail bool
+}
+
+func (n *failNaming) Find(serviceName string, selectors ...naming.Selector) ([]qim.ServiceRegistration, error) {
+	if n.fail {
+		return nil, errors.New("naming is unreachable")
+	}
+	return n.Naming.Find(serviceName, selectors...)
+}
+
+func gatewayEntry(id, idc, domain string) *naming.DefaultService {
+	gateway := naming.NewEntry(id, wire.SNWGateway, "ws", "127.0.0.1", 8000)
+	gateway.Meta = map[string]string{"idc": idc, "domain": domain}
+	return gateway
+}
+
+func TestGatewaySuggester_Suggest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ch := qim.NewMockChannel(ctrl)
+	ch.EXPECT().ID().AnyTimes().Return("channel1")
+	ch.EXPECT().GetMeta().AnyTimes().Return(qim.Meta{MetaKeyAccount: "test1"})
+
+	self := gatewayEntry("gateway1", "SH_ALI", "ws://gateway1")
+	ns := &failNaming{Naming: memory.NewNaming(), fail: true}
+	assert.Nil(t, ns.Register(self))
+	assert.Nil(t, ns.Register(gatewayEntry("gateway2", "SH_ALI", "ws://gateway2")))
+	assert.Nil(t, ns.Register(gatewayEntry("gateway3", "HZ_ALI", "ws://gateway3")))
+
+	s := NewGatewaySuggester(ns, self, 0, time.Millisecond*20, zap.NewNop())
+	assert.Equal(t, "", s.Suggest(ch))
+
+	// the failed lookup is retried once the gateways are expired
+	ns.fail = false
+	assert.Equal(t, "", s.Suggest(ch))
+	time.Sleep(time.Millisecond * 30)
+	assert.Equal(t, "ws://gateway2", s.Suggest(ch))
+	// the gateways in the other IDC are not suggested
+	assert.Equal(t, 1, len(s.gateways))
+
+	// the gateways found last are kept if the lookup fails
+	ns.fail = true
+	time.Sleep(time.Millisecond * 30)
+	assert.Equal(t, "ws://gateway2", s.Suggest(ch))
+}
@@ -4,17 +4,17 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	"github.com/joeyscat/qim"
 	"github.com/joeyscat/qim/container"
 	"github.com/joeyscat/qim/logger"
 	"github.com/joeyscat/qim/naming"
-	"github.com/joeyscat/qim/naming/etcd"
+	"github.com/joeyscat/qim/naming/backend"
 	"github.com/joeyscat/qim/services/gateway/conf"
 	"github.com/joeyscat/qim/services/gateway/serv"
 	"github.com/joeyscat/qim/tcp"
+	"github.com/joeyscat/qim/tracing"
 	"github.com/joeyscat/qim/websocket"
 	"github.com/joeyscat/qim/wire"
 	"github.com/spf13/cobra"
@@ -52,6 +52,7 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 
 	err = logger.Init(logger.Settings{
 		Filename: "./data/gateway.log",
+		Level:    config.LogLevel,
 	})
 	if err != nil {
 		log.Fatal(err)
@@ -59,10 +60,25 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 
 	logger.L.Debug("load config finished", zap.String("config", config.String()))
 
+	shutdownTracing, err := tracing.Init(tracing.Settings{
+		ServiceName: config.ServiceName,
+		ServiceID:   config.ServiceID,
+		Exporter:    config.TraceExporter,
+		Endpoint:    config.TraceEndpoint,
+		SampleRatio: config.TraceSampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = shutdownTracing(context.Background())
+	}()
+
 	handler := serv.NewHander(config.ServiceID, config.AppSecret, logger.L.With(zap.String("module", "gateway.handler")))
 
 	meta := make(map[string]string)
 	meta["domain"] = config.Domain
+	meta["idc"] = config.IdcOf()
 
 	var srv qim.Server
 	service := &naming.DefaultService{
@@ -96,9 +112,18 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 	if err != nil {
 		log.Fatal(err)
 	}
+	container.SetAdminToken(config.AdminToken)
 	container.EnableMonitor(fmt.Sprintf(":%d", config.MonitorPort))
-
-	ns, err := etcd.NewNaming(strings.Split(config.EtcdEndpoints, ","), logger.L.With(zap.String("module", "gateway.naming")))
+	container.SetLoadReport(config.LoadReport)
+
+	ns, err := backend.New(backend.Settings{
+		Backend:       config.Naming,
+		EtcdEndpoints: config.EtcdEndpoints,
+		ConsulAddress: config.ConsulAddress,
+		File:          config.NamingFile,
+		DNSDomain:     config.DNSDomain,
+		K8sNamespace:  config.K8sNamespace,
+	}, logger.L.With(zap.String("module", "gateway.naming")))
 	if err != nil {
 		return err
 	}
@@ -108,6 +133,39 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 	if err != nil {
 		return err
 	}
-	container.SetSelector(selector)
+	container.SetSelector(container.NewSlowStartSelector(selector, config.SlowStart))
+	container.AddAdminInfo("route", selector.Route)
+	container.OnReload("config", func() error {
+		newConfig, err := conf.Reload(opts.config)
+		if err != nil {
+			return err
+		}
+		return logger.SetLevel(newConfig.LogLevel)
+	})
+	container.OnReload("route", func() error {
+		return selector.Reload(opts.route)
+	})
+	container.SetFailover(container.FailoverOptions{
+		MaxRetries:        config.ForwardRetries,
+		BudgetRatio:       config.RetryBudget,
+		MinRetries:        container.DefaultMinRetries,
+		EjectionThreshold: config.OutlierFailures,
+		EjectionTime:      config.OutlierEjection,
+	})
+	container.SetDrain(container.DrainOptions{
+		BatchSize: config.DrainBatch,
+		Interval:  config.DrainInterval,
+		Timeout:   config.DrainTimeout,
+		Suggest: serv.NewGatewaySuggester(ns, service, container.DefaultLoadTolerance, config.DrainInterval,
+			logger.L.With(zap.String("module", "gateway.suggester"))).Suggest,
+	})
+	for _, dep := range []string{wire.SNChat, wire.SNLogin} {
+		container.SetPoolSize(dep, config.PoolSize)
+		// a new chat or login server receives messages once it answers the inner ping
+		container.SetReadinessCheck(dep, container.Ping)
+	}
+	for dep, warmup := range config.Warmups {
+		container.SetWarmup(dep, warmup)
+	}
 	return container.Start()
 }
@@ -1,11 +1,12 @@
 package apis
 
 import (
-	"fmt"
 	"hash/crc32"
+	"sync"
 	"time"
 
 	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/container"
 	"github.com/joeyscat/qim/naming"
 	"github.com/joeyscat/qim/services/router/conf"
 	"github.com/joeyscat/qim/services/router/ipregion"
@@ -21,6 +22,27 @@ type RouterApi struct {
 	IPRegion ipregion.IPRegion
 	Config   conf.Router
 	Lg       *zap.Logger
+	// LoadTolerance skips the gateways overloaded if it is positive
+	LoadTolerance float64
+
+	mu sync.RWMutex
+}
+
+// Reload replaces the mapping and regions if they are valid
+func (r *RouterApi) Reload(config conf.Router) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.Config = config
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *RouterApi) config() conf.Router {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Config
 }
 
 type LookupResp struct {
@@ -41,13 +63,14 @@ func (r *RouterApi) Lookup(c iris.Context) {
 		location = conf.Country(ipinfo.Country)
 	}
 
-	regionID, ok := r.Config.Mapping[location]
+	config := r.config()
+	regionID, ok := config.Mapping[location]
 	if !ok {
 		c.StopWithError(iris.StatusForbidden, err)
 		return
 	}
 
-	region, ok := r.Config.Regions[regionID]
+	region, ok := config.Regions[regionID]
 	if !ok {
 		c.StopWithError(iris.StatusInternalServerError, err)
 		return
@@ -55,13 +78,13 @@ func (r *RouterApi) Lookup(c iris.Context) {
 
 	idc := selectIdc(token, region)
 
-	gateways, err := r.Naming.Find(wire.SNWGateway, fmt.Sprintf("IDC:%s", idc.ID))
+	gateways, err := r.Naming.Find(wire.SNWGateway, naming.Equals("idc", idc.ID))
 	if err != nil {
 		c.StopWithError(iris.StatusInternalServerError, err)
 		return
 	}
 
-	hits := selectGateways(token, gateways, 3)
+	hits := selectLeastLoadedGateways(token, gateways, 3, r.LoadTolerance)
 	domains := make([]string, len(hits))
 	for i, hit := range hits {
 		domains[i] = hit.GetMeta()["domain"]
@@ -110,6 +133,30 @@ func selectGateways(token string, gateways []qim.ServiceRegistration, num int) [
 	return hits
 }
 
+// selectLeastLoadedGateways prefers the gateways not overloaded, the same gateways as
+// selectGateways are returned for a token unless some of them are overloaded.
+func selectLeastLoadedGateways(token string, gateways []qim.ServiceRegistration, num int, tolerance float64) []qim.ServiceRegistration {
+	candidates := container.Underloaded(gateways, tolerance)
+	hits := selectGateways(token, candidates, num)
+	if len(hits) >= num || len(candidates) == len(gateways) {
+		return hits
+	}
+	// not enough gateways, fill with the overloaded ones
+	selected := make(map[string]bool, len(hits))
+	for _, hit := range hits {
+		selected[hit.ServiceID()] = true
+	}
+	for _, gateway := range selectGateways(token, gateways, len(gateways)) {
+		if len(hits) >= num {
+			break
+		}
+		if !selected[gateway.ServiceID()] {
+			hits = append(hits, gateway)
+		}
+	}
+	return hits
+}
+
 func hashcode(s string) int {
 	hash32 := crc32.NewIEEE()
 	_, _ = hash32.Write([]byte(s))
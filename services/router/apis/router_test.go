@@ -1,12 +1,23 @@
 package apis
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 
 	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/container"
 	"github.com/joeyscat/qim/naming"
+	"github.com/joeyscat/qim/naming/memory"
 	"github.com/joeyscat/qim/services/router/conf"
+	"github.com/joeyscat/qim/services/router/ipregion"
+	"github.com/joeyscat/qim/wire"
+	"github.com/kataras/iris/v12"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 )
 
 func Test_selectIdc(t *testing.T) {
@@ -116,3 +127,73 @@ func Test_hashcode(t *testing.T) {
 		})
 	}
 }
+
+func Test_selectLeastLoadedGateways(t *testing.T) {
+	gateways := make([]qim.ServiceRegistration, 6)
+	for i := range gateways {
+		gateways[i] = &naming.DefaultService{
+			ID:   fmt.Sprintf("g%d", i+1),
+			Meta: map[string]string{container.KeyLoadChannels: "100"},
+		}
+	}
+	ids := func(hits []qim.ServiceRegistration) []string {
+		res := make([]string, len(hits))
+		for i, hit := range hits {
+			res[i] = hit.ServiceID()
+		}
+		return res
+	}
+
+	// the same as selectGateways if none is overloaded
+	assert.Equal(t, ids(selectGateways("token1", gateways, 3)),
+		ids(selectLeastLoadedGateways("token1", gateways, 3, container.DefaultLoadTolerance)))
+
+	gateways[4].GetMeta()[container.KeyLoadChannels] = "1000"
+	hits := ids(selectLeastLoadedGateways("token1", gateways, 3, container.DefaultLoadTolerance))
+	assert.Len(t, hits, 3)
+	assert.NotContains(t, hits, "g5")
+
+	// not enough gateways, the overloaded one is used
+	hits = ids(selectLeastLoadedGateways("token1", gateways[3:5], 3, container.DefaultLoadTolerance))
+	assert.Equal(t, []string{"g4", "g5"}, hits)
+}
+
+type fakeIPRegion struct{}
+
+func (fakeIPRegion) Search(ip string) (*ipregion.IPInfo, error) {
+	return &ipregion.IPInfo{Country: "中国"}, nil
+}
+
+func TestRouterApi_Lookup(t *testing.T) {
+	ns := memory.NewNaming()
+	for i, idc := range []string{"SH_ALI", "SH_ALI", "HZ_ALI"} {
+		gateway := naming.NewEntry(fmt.Sprintf("gate%d", i), wire.SNWGateway, "ws", "127.0.0.1", uint16(8000+i))
+		gateway.Meta = map[string]string{"idc": idc, "domain": fmt.Sprintf("ws://gate%d", i)}
+		assert.Nil(t, ns.Register(gateway))
+	}
+
+	router := &RouterApi{
+		Naming:   ns,
+		IPRegion: fakeIPRegion{},
+		Config: conf.Router{
+			Mapping: map[conf.Country]string{"中国": "sh"},
+			Regions: map[string]*conf.Region{
+				"sh": {ID: "sh", Idcs: []conf.IDC{{ID: "SH_ALI", Weight: 1}}, Slots: []byte{0}},
+			},
+		},
+		Lg: zap.NewNop(),
+	}
+	app := iris.New()
+	app.Get("/api/lookup/{token}", router.Lookup)
+	assert.Nil(t, app.Build())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/lookup/token1", nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp LookupResp
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	// the gateways are selected by the idc in their meta
+	assert.ElementsMatch(t, []string{"ws://gate0", "ws://gate1"}, resp.Domains)
+}
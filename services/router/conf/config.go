@@ -2,6 +2,7 @@ package conf
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 
 	"github.com/kelseyhightower/envconfig"
@@ -10,8 +11,15 @@ import (
 
 type Config struct {
 	Listen        string `default:":8100"`
+	Naming        string `default:"etcd"`
 	EtcdEndpoints string
+	ConsulAddress string
+	NamingFile    string
+	DNSDomain     string
+	K8sNamespace  string
 	LogLevel      string `default:"debug"`
+	// LoadTolerance is the ratio a gateway is allowed to be loaded above the mean, 0 disables it
+	LoadTolerance float64 `default:"0.25"`
 }
 
 func (c Config) String() string {
@@ -42,3 +50,22 @@ func Init(file string) (*Config, error) {
 
 	return &config, nil
 }
+
+// Reload reads the config file again, it returns the error instead of exiting
+func Reload(file string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("yaml")
+
+	var config Config
+	if err := envconfig.Process("qim", &config); err != nil {
+		return nil, err
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read config error: %w", err)
+	}
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
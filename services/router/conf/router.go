@@ -2,6 +2,7 @@ package conf
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 )
 
@@ -28,6 +29,26 @@ type Router struct {
 	Regions map[string]*Region
 }
 
+// Validate checks that every mapped region exists and every idc has a positive weight
+func (r Router) Validate() error {
+	for country, regionID := range r.Mapping {
+		if _, ok := r.Regions[regionID]; !ok {
+			return fmt.Errorf("region %s of %s not found", regionID, country)
+		}
+	}
+	for id, region := range r.Regions {
+		if len(region.Idcs) == 0 {
+			return fmt.Errorf("no idc in region %s", id)
+		}
+		for _, idc := range region.Idcs {
+			if idc.Weight <= 0 {
+				return fmt.Errorf("weight of idc %s in region %s must be positive", idc.ID, id)
+			}
+		}
+	}
+	return nil
+}
+
 func LoadMapping(path string) (map[Country]string, error) {
 	bts, err := os.ReadFile(path)
 	if err != nil {
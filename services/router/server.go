@@ -3,17 +3,20 @@ package router
 import (
 	"context"
 	"log"
+	"os"
+	"os/signal"
 	"path"
-	"strings"
+	"syscall"
 
 	"github.com/joeyscat/qim/logger"
-	"github.com/joeyscat/qim/naming/etcd"
+	"github.com/joeyscat/qim/naming/backend"
 	"github.com/joeyscat/qim/services/router/apis"
 	"github.com/joeyscat/qim/services/router/conf"
 	"github.com/joeyscat/qim/services/router/ipregion"
 	"github.com/kataras/iris/v12"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type ServerStartOptions struct {
@@ -45,43 +48,44 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 
 	err = logger.Init(logger.Settings{
 		Filename: "./data/gateway.log",
+		Level:    config.LogLevel,
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 	logger.L.Debug("load config finished", zap.String("config", config.String()))
 
-	mappings, err := conf.LoadMapping(path.Join(opts.data, "mapping.json"))
+	routerConfig, err := loadRouter(opts.data)
 	if err != nil {
 		return err
 	}
-	logger.L.Info("load mapping", zap.Any("mapping", mappings))
-
-	regions, err := conf.LoadRegions(path.Join(opts.data, "region.json"))
-	if err != nil {
-		return err
-	}
-	logger.L.Info("load region", zap.Any("region", regions))
 
 	region, err := ipregion.NewIP2Region(path.Join(opts.data, "ip2region.db"))
 	if err != nil {
 		return err
 	}
 
-	ns, err := etcd.NewNaming(strings.Split(config.EtcdEndpoints, ","), logger.L.With(zap.String("module", "router.naming")))
+	ns, err := backend.New(backend.Settings{
+		Backend:       config.Naming,
+		EtcdEndpoints: config.EtcdEndpoints,
+		ConsulAddress: config.ConsulAddress,
+		File:          config.NamingFile,
+		DNSDomain:     config.DNSDomain,
+		K8sNamespace:  config.K8sNamespace,
+	}, logger.L.With(zap.String("module", "router.naming")))
 	if err != nil {
 		return err
 	}
 
-	router := apis.RouterApi{
+	router := &apis.RouterApi{
 		Naming:   ns,
 		IPRegion: region,
-		Config: conf.Router{
-			Mapping: mappings,
-			Regions: regions,
-		},
-		Lg: logger.L.With(zap.String("module", "router")),
+		Config:   *routerConfig,
+		Lg:       logger.L.With(zap.String("module", "router")),
+
+		LoadTolerance: config.LoadTolerance,
 	}
+	go reloadOnSignal(opts, router)
 
 	app := iris.Default()
 
@@ -96,3 +100,59 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 
 	return app.Listen(config.Listen, iris.WithOptimizations)
 }
+
+func loadRouter(data string) (*conf.Router, error) {
+	mappings, err := conf.LoadMapping(path.Join(data, "mapping.json"))
+	if err != nil {
+		return nil, err
+	}
+	logger.L.Info("load mapping", zap.Any("mapping", mappings))
+
+	regions, err := conf.LoadRegions(path.Join(data, "region.json"))
+	if err != nil {
+		return nil, err
+	}
+	logger.L.Info("load region", zap.Any("region", regions))
+
+	config := &conf.Router{
+		Mapping: mappings,
+		Regions: regions,
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// reloadOnSignal reloads the log level, mapping and regions on SIGHUP,
+// the config in use is kept if any of them is invalid.
+func reloadOnSignal(opts *ServerStartOptions, router *apis.RouterApi) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		err := reload(opts, router)
+		if err != nil {
+			logger.L.Error("reload failed", zap.Error(err))
+			continue
+		}
+		logger.L.Info("reloaded")
+	}
+}
+
+func reload(opts *ServerStartOptions, router *apis.RouterApi) error {
+	config, err := conf.Reload(opts.config)
+	if err != nil {
+		return err
+	}
+	if _, err := zapcore.ParseLevel(config.LogLevel); err != nil {
+		return err
+	}
+	routerConfig, err := loadRouter(opts.data)
+	if err != nil {
+		return err
+	}
+	if err := router.Reload(*routerConfig); err != nil {
+		return err
+	}
+	return logger.SetLevel(config.LogLevel)
+}
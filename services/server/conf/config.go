@@ -10,6 +10,7 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/middleware"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/spf13/viper"
 )
@@ -17,20 +18,56 @@ import (
 type Server struct {
 }
 
+// the options of Config.SessionStorage, memory is only for a server running alone
+const (
+	SessionStorageRedis  = "redis"
+	SessionStorageMemory = "memory"
+)
+
+// DeviceClass allows an account to be logged in on Limit devices of the class at once,
+// such as one of android and ios for mobile.
+type DeviceClass struct {
+	Name    string
+	Devices []string
+	Limit   int
+}
+
 type Config struct {
-	ServiceID       string
-	Listen          string `default:":8005"`
-	MonitorPort     uint16 `default:"8006"`
-	PublicAddress   string
-	PublicPort      uint16 `default:"8005"`
-	Tags            []string
-	Zone            string `default:"zone_03"`
-	EtcdEndpoints   string
-	RedisAddrs      string
-	RoyalURL        string
-	LogLevel        string `default:"debug"`
-	MessageGPool    int    `default:"5000"`
-	ConnectionGPool int    `default:"500"`
+	ServiceID         string
+	Listen            string `default:":8005"`
+	MonitorPort       uint16 `default:"8006"`
+	PublicAddress     string
+	PublicPort        uint16 `default:"8005"`
+	Tags              []string
+	Zone              string `default:"zone_03"`
+	Naming            string `default:"etcd"`
+	EtcdEndpoints     string
+	ConsulAddress     string
+	NamingFile        string
+	DNSDomain         string
+	K8sNamespace      string
+	RedisAddrs        string
+	SessionStorage    string `default:"redis"`
+	RoyalURL          string
+	RoyalTimeout      time.Duration `default:"5s"`
+	RoyalRetryCount   int           `default:"3"`
+	RoyalConcurrency  int           `default:"500"`
+	RoyalBreakerLimit int           `default:"5"`
+	RoyalBreakerDelay time.Duration `default:"10s"`
+	LogLevel          string        `default:"debug"`
+	MessageGPool      int           `default:"5000"`
+	ConnectionGPool   int           `default:"500"`
+	RateLimitBy       string        `default:"account"`
+	RateLimitRedis    bool
+	RateLimits        []middleware.RateLimitRule
+	DeviceClasses     []DeviceClass
+	IdempotencyWindow time.Duration `default:"5m"`
+	IdempotencyRedis  bool
+	TraceExporter     string
+	TraceEndpoint     string
+	TraceSampleRatio  float64       `default:"1"`
+	AdminToken        string        `json:"-"`
+	LoadReport        time.Duration `default:"10s"`
 }
 
 func (c Config) String() string {
@@ -70,6 +107,26 @@ func Init(file string) (*Config, error) {
 	return &config, nil
 }
 
+// Reload reads the config file again, unlike Init it returns the error
+// instead of exiting, so that the config in use is kept if the file is broken.
+func Reload(file string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("yaml")
+
+	var config Config
+	if err := envconfig.Process("qim", &config); err != nil {
+		return nil, err
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read config error: %w", err)
+	}
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
 func InitRedis(addr string, pass string) (*redis.Client, error) {
 	redisdb := redis.NewClient(&redis.Options{
 		Addr:         addr,
@@ -38,17 +38,17 @@ func (h *ChatHandler) DoUserTalk(ctx qim.Context) {
 		return
 	}
 
-	// get the location of the receiver
+	// get the locations of the receiver on all the devices
 	receiver := ctx.Header().GetDest()
-	loc, err := ctx.GetLocation(receiver, "")
-	if err != nil && err != qim.ErrSessionNil {
+	locs, err := ctx.GetLocations(receiver)
+	if err != nil {
 		_ = ctx.RespWithError(pkt.Status_SystemException, err)
 		return
 	}
 
 	// save offline message
 	sendTime := time.Now().Local().UnixNano()
-	resp, err := h.msgService.InsertUser(ctx.Session().GetApp(), &rpcc.InsertMessageReq{
+	resp, err := h.msgService.InsertUser(ctx.Context(), ctx.Session().GetApp(), &rpcc.InsertMessageReq{
 		Sender:   ctx.Session().GetAccount(),
 		Dest:     receiver,
 		SendTime: sendTime,
@@ -59,12 +59,12 @@ func (h *ChatHandler) DoUserTalk(ctx qim.Context) {
 		},
 	})
 	if err != nil {
-		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		_ = ctx.RespWithError(serviceStatus(err), err)
 		return
 	}
 
 	// push the message to the receiver if online
-	if loc != nil {
+	if len(locs) > 0 {
 		if err = ctx.Dispatch(&pkt.MessagePush{
 			MessageId: resp.GetMessageId(),
 			Type:      req.GetType(),
@@ -72,7 +72,7 @@ func (h *ChatHandler) DoUserTalk(ctx qim.Context) {
 			Extra:     req.GetExtra(),
 			Sender:    ctx.Session().GetAccount(),
 			SendTime:  sendTime,
-		}, loc); err != nil {
+		}, locs...); err != nil {
 			_ = ctx.RespWithError(pkt.Status_SystemException, err)
 			return
 		}
@@ -100,7 +100,7 @@ func (h *ChatHandler) DoGroupTalk(ctx qim.Context) {
 	group := ctx.Header().GetDest()
 	sendTime := time.Now().Local().UnixNano()
 
-	resp, err := h.msgService.InsertGroup(ctx.Session().GetApp(), &rpcc.InsertMessageReq{
+	resp, err := h.msgService.InsertGroup(ctx.Context(), ctx.Session().GetApp(), &rpcc.InsertMessageReq{
 		Sender:   ctx.Session().GetAccount(),
 		Dest:     group,
 		SendTime: sendTime,
@@ -111,15 +111,15 @@ func (h *ChatHandler) DoGroupTalk(ctx qim.Context) {
 		},
 	})
 	if err != nil {
-		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		_ = ctx.RespWithError(serviceStatus(err), err)
 		return
 	}
 
-	membersResponse, err := h.groupService.Members(ctx.Session().GetApp(), &rpcc.GroupMembersReq{
+	membersResponse, err := h.groupService.Members(ctx.Context(), ctx.Session().GetApp(), &rpcc.GroupMembersReq{
 		GroupId: group,
 	})
 	if err != nil {
-		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		_ = ctx.RespWithError(serviceStatus(err), err)
 		return
 	}
 	var members = make([]string, len(membersResponse.GetUsers()))
@@ -160,12 +160,12 @@ func (h *ChatHandler) DoTalkAck(ctx qim.Context) {
 		return
 	}
 
-	err := h.msgService.SetAck(ctx.Session().GetApp(), &rpcc.AckMessageReq{
+	err := h.msgService.SetAck(ctx.Context(), ctx.Session().GetApp(), &rpcc.AckMessageReq{
 		Account:   ctx.Session().GetAccount(),
 		MessageId: req.GetMessageId(),
 	})
 	if err != nil {
-		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		_ = ctx.RespWithError(serviceStatus(err), err)
 		return
 	}
 
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/services/server/conf"
+)
+
+// KickoutPolicy decides the sessions kicked out by a new login. A device not in any of
+// the classes is a class of its own with limit 1, and the old session on the same device
+// is always kicked out.
+type KickoutPolicy struct {
+	// key: device
+	classes map[string]conf.DeviceClass
+}
+
+func ValidateDeviceClasses(classes []conf.DeviceClass) error {
+	seen := make(map[string]string)
+	names := make(map[string]bool)
+	for _, class := range classes {
+		if names[class.Name] {
+			return fmt.Errorf("duplicate device class %s", class.Name)
+		}
+		names[class.Name] = true
+		if class.Limit < 1 {
+			return fmt.Errorf("invalid limit %d of device class %s", class.Limit, class.Name)
+		}
+		for _, device := range class.Devices {
+			if name, ok := seen[device]; ok {
+				return fmt.Errorf("device %s is in both class %s and %s", device, name, class.Name)
+			}
+			seen[device] = class.Name
+		}
+	}
+	return nil
+}
+
+func NewKickoutPolicy(classes []conf.DeviceClass) (*KickoutPolicy, error) {
+	if err := ValidateDeviceClasses(classes); err != nil {
+		return nil, err
+	}
+	p := &KickoutPolicy{
+		classes: make(map[string]conf.DeviceClass),
+	}
+	for _, class := range classes {
+		for _, device := range class.Devices {
+			p.classes[device] = class
+		}
+	}
+	return p, nil
+}
+
+func (p *KickoutPolicy) limitOf(device string) int {
+	if class, ok := p.classes[device]; ok {
+		return class.Limit
+	}
+	return 1
+}
+
+func (p *KickoutPolicy) sameClass(a, b string) bool {
+	ca, oka := p.classes[a]
+	cb, okb := p.classes[b]
+	if !oka || !okb {
+		return a == b
+	}
+	return ca.Name == cb.Name
+}
+
+// Kickout returns the locations of olds kicked out by the login on device. If the sessions
+// of the class are over the limit, the ones at the end of olds are kicked out.
+func (p *KickoutPolicy) Kickout(device string, olds []*qim.Location) []*qim.Location {
+	limit := p.limitOf(device)
+	var kicked []*qim.Location
+	// the login itself is one of the class
+	kept := 1
+	for _, old := range olds {
+		switch {
+		case old.Device == device:
+			kicked = append(kicked, old)
+		case !p.sameClass(device, old.Device):
+		case kept < limit:
+			kept++
+		default:
+			kicked = append(kicked, old)
+		}
+	}
+	return kicked
+}
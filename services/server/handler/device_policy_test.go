@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/services/server/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKickoutPolicy_Kickout(t *testing.T) {
+	policy, err := NewKickoutPolicy([]conf.DeviceClass{
+		{Name: "mobile", Devices: []string{"android", "ios"}, Limit: 1},
+		{Name: "desktop", Devices: []string{"windows", "mac", "linux"}, Limit: 2},
+	})
+	assert.Nil(t, err)
+
+	android := &qim.Location{ChannelID: "c1", Device: "android"}
+	ios := &qim.Location{ChannelID: "c2", Device: "ios"}
+	ipad := &qim.Location{ChannelID: "c3", Device: "ipad"}
+	linux := &qim.Location{ChannelID: "c4", Device: "linux"}
+	mac := &qim.Location{ChannelID: "c5", Device: "mac"}
+	dft := &qim.Location{ChannelID: "c6"}
+
+	// one mobile
+	assert.Equal(t, []*qim.Location{android}, policy.Kickout("ios", []*qim.Location{android, ipad, linux}))
+	// the same device
+	assert.Equal(t, []*qim.Location{ios}, policy.Kickout("ios", []*qim.Location{ios, linux}))
+	assert.Equal(t, []*qim.Location{ipad}, policy.Kickout("ipad", []*qim.Location{android, ipad}))
+	assert.Equal(t, []*qim.Location{dft}, policy.Kickout("", []*qim.Location{dft, ipad}))
+	// two desktops
+	assert.Nil(t, policy.Kickout("windows", []*qim.Location{android, linux}))
+	assert.Equal(t, []*qim.Location{mac}, policy.Kickout("windows", []*qim.Location{linux, mac}))
+	assert.Nil(t, policy.Kickout("android", nil))
+}
+
+func TestValidateDeviceClasses(t *testing.T) {
+	assert.Nil(t, ValidateDeviceClasses(nil))
+	assert.NotNil(t, ValidateDeviceClasses([]conf.DeviceClass{{Name: "mobile", Devices: []string{"ios"}}}))
+	assert.NotNil(t, ValidateDeviceClasses([]conf.DeviceClass{
+		{Name: "mobile", Devices: []string{"ios"}, Limit: 1},
+		{Name: "tablet", Devices: []string{"ios"}, Limit: 1},
+	}))
+	assert.NotNil(t, ValidateDeviceClasses([]conf.DeviceClass{
+		{Name: "mobile", Devices: []string{"ios"}, Limit: 1},
+		{Name: "mobile", Devices: []string{"android"}, Limit: 1},
+	}))
+}
@@ -24,7 +24,7 @@ func (h *GroupHandler) DoCreate(ctx qim.Context) {
 		return
 	}
 
-	resp, err := h.groupService.Create(ctx.Session().GetApp(), &rpcc.CreateGroupReq{
+	resp, err := h.groupService.Create(ctx.Context(), ctx.Session().GetApp(), &rpcc.CreateGroupReq{
 		Name:         req.GetName(),
 		Avatar:       req.GetAvatar(),
 		Introduction: req.GetIntroduction(),
@@ -32,7 +32,7 @@ func (h *GroupHandler) DoCreate(ctx qim.Context) {
 		Members:      req.GetMembers(),
 	})
 	if err != nil {
-		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		_ = ctx.RespWithError(serviceStatus(err), err)
 		return
 	}
 
@@ -64,12 +64,12 @@ func (h *GroupHandler) DoJoin(ctx qim.Context) {
 		return
 	}
 
-	err := h.groupService.Join(ctx.Session().GetApp(), &rpcc.JoinGroupReq{
+	err := h.groupService.Join(ctx.Context(), ctx.Session().GetApp(), &rpcc.JoinGroupReq{
 		Account: req.GetAccount(),
 		GroupId: req.GetGroupId(),
 	})
 	if err != nil {
-		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		_ = ctx.RespWithError(serviceStatus(err), err)
 		return
 	}
 
@@ -83,12 +83,12 @@ func (h *GroupHandler) DoQuit(ctx qim.Context) {
 		return
 	}
 
-	err := h.groupService.Quit(ctx.Session().GetApp(), &rpcc.QuitGroupReq{
+	err := h.groupService.Quit(ctx.Context(), ctx.Session().GetApp(), &rpcc.QuitGroupReq{
 		Account: req.GetAccount(),
 		GroupId: req.GetGroupId(),
 	})
 	if err != nil {
-		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		_ = ctx.RespWithError(serviceStatus(err), err)
 		return
 	}
 
@@ -102,18 +102,18 @@ func (h *GroupHandler) DoDetail(ctx qim.Context) {
 		return
 	}
 
-	resp, err := h.groupService.Detail(ctx.Session().GetApp(), &rpcc.GetGroupReq{
+	resp, err := h.groupService.Detail(ctx.Context(), ctx.Session().GetApp(), &rpcc.GetGroupReq{
 		GroupId: req.GetGroupId(),
 	})
 	if err != nil {
-		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		_ = ctx.RespWithError(serviceStatus(err), err)
 		return
 	}
-	membersResp, err := h.groupService.Members(ctx.Session().GetApp(), &rpcc.GroupMembersReq{
+	membersResp, err := h.groupService.Members(ctx.Context(), ctx.Session().GetApp(), &rpcc.GroupMembersReq{
 		GroupId: req.GetGroupId(),
 	})
 	if err != nil {
-		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		_ = ctx.RespWithError(serviceStatus(err), err)
 		return
 	}
 	var members = make([]*pkt.Member, len(membersResp.GetUsers()))
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/middleware"
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+)
+
+var (
+	ErrNotOwner       = errors.New("the owner must be the caller")
+	ErrNotSelfAccount = errors.New("the account must be the caller")
+)
+
+// GroupPolicies authorizes the group commands against the account of the caller
+func GroupPolicies() middleware.Policies {
+	return middleware.Policies{
+		"chat.group.*": {middleware.Authenticated},
+		wire.CommandGroupCreate: {middleware.Body(func(session qim.Session, req *pkt.GroupCreateReq) error {
+			if req.GetOwner() != session.GetAccount() {
+				return ErrNotOwner
+			}
+			return nil
+		})},
+		wire.CommandGroupJoin: {middleware.Body(func(session qim.Session, req *pkt.GroupJoinReq) error {
+			if req.GetAccount() != session.GetAccount() {
+				return ErrNotSelfAccount
+			}
+			return nil
+		})},
+		wire.CommandGroupQuit: {middleware.Body(func(session qim.Session, req *pkt.GroupQuitReq) error {
+			if req.GetAccount() != session.GetAccount() {
+				return ErrNotSelfAccount
+			}
+			return nil
+		})},
+	}
+}
@@ -1,17 +1,27 @@
 package handler
 
 import (
+	"sync/atomic"
+
 	"github.com/joeyscat/qim"
 	"github.com/joeyscat/qim/wire/pkt"
 	"go.uber.org/zap"
 )
 
 type loginHandler struct {
-	lg *zap.Logger
+	policy atomic.Value // *KickoutPolicy
+	lg     *zap.Logger
+}
+
+func NewLoginHandler(policy *KickoutPolicy, lg *zap.Logger) *loginHandler {
+	h := &loginHandler{lg: lg}
+	h.SetKickoutPolicy(policy)
+	return h
 }
 
-func NewLoginHandler(lg *zap.Logger) *loginHandler {
-	return &loginHandler{lg: lg}
+// SetKickoutPolicy replaces the policy of the logins after
+func (h *loginHandler) SetKickoutPolicy(policy *KickoutPolicy) {
+	h.policy.Store(policy)
 }
 
 func (h *loginHandler) DoSysLogin(ctx qim.Context) {
@@ -23,14 +33,15 @@ func (h *loginHandler) DoSysLogin(ctx qim.Context) {
 
 	h.lg.Info("do login", zap.String("session", session.String()))
 
-	// check if this account is already logged in
-	old, err := ctx.GetLocation(session.GetAccount(), "")
-	if err != nil && err != qim.ErrSessionNil {
+	// check if this account is already logged in on the devices
+	olds, err := ctx.GetLocations(session.GetAccount())
+	if err != nil {
 		_ = ctx.RespWithError(pkt.Status_SystemException, err)
 		return
 	}
 
-	if old != nil {
+	policy := h.policy.Load().(*KickoutPolicy)
+	for _, old := range policy.Kickout(session.GetDevice(), olds) {
 		// kick out
 		_ = ctx.Dispatch(&pkt.KickoutNotify{ChannelId: old.ChannelID}, old)
 	}
@@ -26,12 +26,12 @@ func (h *OfflineHandler) DoSyncIndex(ctx qim.Context) {
 		return
 	}
 
-	resp, err := h.msgService.GetMessageIndex(ctx.Session().GetApp(), &rpcc.GetOfflineMessageIndexReq{
+	resp, err := h.msgService.GetMessageIndex(ctx.Context(), ctx.Session().GetApp(), &rpcc.GetOfflineMessageIndexReq{
 		Account:   ctx.Session().GetAccount(),
 		MessageId: req.GetMessageId(),
 	})
 	if err != nil {
-		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		_ = ctx.RespWithError(serviceStatus(err), err)
 		return
 	}
 
@@ -61,11 +61,11 @@ func (h *OfflineHandler) DoSyncContent(ctx qim.Context) {
 		return
 	}
 
-	resp, err := h.msgService.GetMessageContent(ctx.Session().GetApp(), &rpcc.GetOfflineMessageContentReq{
+	resp, err := h.msgService.GetMessageContent(ctx.Context(), ctx.Session().GetApp(), &rpcc.GetOfflineMessageContentReq{
 		MessageIds: req.GetMessageIds(),
 	})
 	if err != nil {
-		_ = ctx.RespWithError(pkt.Status_SystemException, err)
+		_ = ctx.RespWithError(serviceStatus(err), err)
 		return
 	}
 
@@ -0,0 +1,16 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/joeyscat/qim/services/server/service"
+	"github.com/joeyscat/qim/wire/pkt"
+)
+
+// serviceStatus tells the client to retry later if the royal service is unavailable
+func serviceStatus(err error) pkt.Status {
+	if errors.Is(err, service.ErrServiceUnavailable) {
+		return pkt.Status_ServiceUnavailable
+	}
+	return pkt.Status_SystemException
+}
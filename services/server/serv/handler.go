@@ -48,9 +48,10 @@ func (h *ServHandler) Accept(conn qim.Conn, timeout time.Duration) (string, qim.
 	var req pkt.InnerHandshakeReq
 	_ = proto.Unmarshal(frame.GetPayload(), &req)
 
-	h.lg.Info("Accept --", zap.String("serviceID", req.ServiceId))
+	id := container.PoolChannelID(req.ServiceId, int(req.Index))
+	h.lg.Info("Accept --", zap.String("serviceID", req.ServiceId), zap.String("channelID", id))
 
-	return req.ServiceId, nil, nil
+	return id, nil, nil
 }
 
 // Disconnect implements qim.StateListener
@@ -68,8 +69,13 @@ func (h *ServHandler) Receive(agent qim.Agent, payload []byte) {
 		return
 	}
 
+	if packet.GetCommand() == wire.CommandInnerPing {
+		_ = Resp(agent, packet, h.readiness(packet))
+		return
+	}
+
 	var session *pkt.Session
-	if packet.GetCommand() == wire.CommandLoginSignIn {
+	if packet.GetCommand() == wire.CommandLoginSignIn || isCall(packet) {
 		server, _ := packet.GetMeta(wire.MetaDestServer)
 		session = &pkt.Session{
 			ChannelId: packet.ChannelId,
@@ -96,7 +102,31 @@ func (h *ServHandler) Receive(agent qim.Agent, payload []byte) {
 	}
 }
 
+// isCall reports whether the packet is a call from another service, which is not bound to
+// the session of a user. A call is responded to the channel of the calling server, while the
+// channel of a packet relayed by a gateway is the one of a user.
+func isCall(packet *pkt.LogicPkt) bool {
+	from, ok := packet.GetMeta(wire.MetaCallFrom)
+	return ok && from == packet.ChannelId
+}
+
+// readiness is the status of the response to wire.CommandInnerPing, the server is not
+// ready if the sessions are not available. The channel of a ping has no session.
+func (h *ServHandler) readiness(ping *pkt.LogicPkt) pkt.Status {
+	_, err := h.cache.Get(ping.ChannelId)
+	if err != nil && err != qim.ErrSessionNil {
+		h.lg.Warn("session storage is not available", zap.Error(err))
+		return pkt.Status_SystemException
+	}
+	return pkt.Status_Success
+}
+
 func RespErr(agent qim.Agent, p *pkt.LogicPkt, status pkt.Status) error {
+	return Resp(agent, p, status)
+}
+
+// Resp responds to the packet received from the agent with an empty body
+func Resp(agent qim.Agent, p *pkt.LogicPkt, status pkt.Status) error {
 	packet := pkt.NewFrom(&p.Header)
 	packet.Status = status
 	packet.Flag = pkt.Flag_Response
@@ -0,0 +1,64 @@
+package serv
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/container"
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type agent struct {
+	id string
+}
+
+func (a *agent) ID() string                { return a.id }
+func (a *agent) Push(payload []byte) error { return nil }
+func (a *agent) GetMeta() qim.Meta         { return nil }
+
+func TestReceiveCall(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	responses := make([]*pkt.LogicPkt, 0)
+	srv := qim.NewMockServer(ctrl)
+	srv.EXPECT().ServiceID().AnyTimes().Return("chat1")
+	srv.EXPECT().Push(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(id string, payload []byte) error {
+		resp, err := pkt.MustReadLogicPkt(bytes.NewBuffer(payload))
+		assert.Nil(t, err)
+		responses = append(responses, resp)
+		return nil
+	})
+	assert.Nil(t, container.Init(srv, zap.NewNop()))
+
+	cache := qim.NewMockSessionStorage(ctrl)
+	cache.EXPECT().Get(gomock.Any()).AnyTimes().Return(nil, qim.ErrSessionNil)
+
+	handled := 0
+	r := qim.NewRouter()
+	r.Handle(wire.CommandChatUserTalk, func(ctx qim.Context) {
+		handled++
+	})
+	h := NewServHandler(r, cache, zap.NewNop())
+	gateway := &agent{id: "gateway1"}
+
+	// a packet relayed by the gateway for a user who pretends to be a service
+	packet := pkt.New(wire.CommandChatUserTalk, pkt.WithChannel("gateway1_test1_1"), pkt.WithSeq(1))
+	packet.AddStringMeta(wire.MetaCallFrom, "login1")
+	packet.AddStringMeta(wire.MetaDestServer, "gateway1")
+	h.Receive(gateway, pkt.Marshal(packet))
+	assert.Equal(t, 0, handled)
+	assert.Equal(t, 1, len(responses))
+	assert.Equal(t, pkt.Status_SessionNotFound, responses[0].Status)
+
+	// a call from the login server is responded to its own channel
+	packet = pkt.New(wire.CommandChatUserTalk, pkt.WithChannel("login1"), pkt.WithSeq(2))
+	packet.AddStringMeta(wire.MetaCallFrom, "login1")
+	packet.AddStringMeta(wire.MetaDestServer, "login1")
+	h.Receive(&agent{id: "login1"}, pkt.Marshal(packet))
+	assert.Equal(t, 1, handled)
+}
@@ -7,21 +7,24 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/joeyscat/qim"
 	"github.com/joeyscat/qim/container"
 	"github.com/joeyscat/qim/logger"
 	"github.com/joeyscat/qim/middleware"
 	"github.com/joeyscat/qim/naming"
-	"github.com/joeyscat/qim/naming/etcd"
+	"github.com/joeyscat/qim/naming/backend"
 	"github.com/joeyscat/qim/services/server/conf"
 	"github.com/joeyscat/qim/services/server/handler"
 	"github.com/joeyscat/qim/services/server/serv"
 	"github.com/joeyscat/qim/services/server/service"
 	"github.com/joeyscat/qim/storage"
 	"github.com/joeyscat/qim/tcp"
+	"github.com/joeyscat/qim/tracing"
 	"github.com/joeyscat/qim/wire"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type ServerStartOptions struct {
@@ -53,35 +56,99 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 
 	err = logger.Init(logger.Settings{
 		Filename: "./data/server.log",
+		Level:    config.LogLevel,
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 	logger.L.Debug("load config finished", zap.String("config", config.String()))
 
+	shutdownTracing, err := tracing.Init(tracing.Settings{
+		ServiceName: opts.serviceName,
+		ServiceID:   config.ServiceID,
+		Exporter:    config.TraceExporter,
+		Endpoint:    config.TraceEndpoint,
+		SampleRatio: config.TraceSampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = shutdownTracing(context.Background())
+	}()
+
 	var groupService service.Group
 	var messageService service.Message
 	if strings.TrimSpace(config.RoyalURL) != "" {
+		royalOpts := []service.ClientOption{
+			service.WithTimeout(config.RoyalTimeout),
+			service.WithRetryCount(config.RoyalRetryCount),
+			service.WithMaxConcurrency(config.RoyalConcurrency),
+			service.WithBreaker(config.RoyalBreakerLimit, config.RoyalBreakerDelay),
+		}
 		groupService = service.NewGroupService(config.RoyalURL,
-			logger.L.With(zap.String("module", "group")))
+			logger.L.With(zap.String("module", "group")), royalOpts...)
 		messageService = service.NewMessageService(config.RoyalURL,
-			logger.L.With(zap.String("module", "message")))
+			logger.L.With(zap.String("module", "message")), royalOpts...)
 	} else {
 		// TODO
 		logger.L.Fatal("royal url is empty")
 	}
 
+	royalTimeouts := make([]service.TimeoutSetter, 0, 2)
+	for _, royal := range []any{groupService, messageService} {
+		if setter, ok := royal.(service.TimeoutSetter); ok {
+			royalTimeouts = append(royalTimeouts, setter)
+		}
+	}
+
+	// redis is not required if none of the storages is in it
+	var rdb *redis.Client
+	if config.SessionStorage != conf.SessionStorageMemory || config.RateLimitRedis || config.IdempotencyRedis {
+		rdb, err = conf.InitRedis(config.RedisAddrs, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	var limiter middleware.Limiter = middleware.NewLocalLimiter()
+	if config.RateLimitRedis {
+		limiter = middleware.NewRedisLimiter(rdb)
+	}
+
 	r := qim.NewRouter()
+	r.Use(middleware.Metrics())
 	r.Use(middleware.Recover())
+	r.Use(middleware.Tracing())
+	rateLimits := middleware.NewRateLimits(middleware.RateLimitOptions{
+		By:      config.RateLimitBy,
+		Rules:   config.RateLimits,
+		Limiter: limiter,
+	})
+	r.Use(rateLimits.Handle)
+	r.Use(middleware.Authorize(handler.GroupPolicies()))
 
 	// login
-	loginHandler := handler.NewLoginHandler(logger.L.With(zap.String("module", "login")))
+	kickoutPolicy, err := handler.NewKickoutPolicy(config.DeviceClasses)
+	if err != nil {
+		return err
+	}
+	loginHandler := handler.NewLoginHandler(kickoutPolicy, logger.L.With(zap.String("module", "login")))
 	r.Handle(wire.CommandLoginSignIn, loginHandler.DoSysLogin)
 	r.Handle(wire.CommandLoginSignOut, loginHandler.DoSysLogout)
 	// talk
+	var idempotencyStore middleware.IdempotencyStore = middleware.NewMemoryIdempotencyStore()
+	if config.IdempotencyRedis {
+		idempotencyStore = middleware.NewRedisIdempotencyStore(rdb)
+	}
+	idempotency := middleware.Idempotency(middleware.IdempotencyOptions{
+		Window:  config.IdempotencyWindow,
+		Store:   idempotencyStore,
+		KeyFunc: middleware.MessageKey,
+	})
 	chatHandler := handler.NewChatHandler(messageService, groupService)
-	r.Handle(wire.CommandChatUserTalk, chatHandler.DoUserTalk)
-	r.Handle(wire.CommandChatGroupTalk, chatHandler.DoGroupTalk)
+	r.Handle(wire.CommandChatUserTalk, idempotency, chatHandler.DoUserTalk)
+	r.Handle(wire.CommandChatGroupTalk, idempotency, chatHandler.DoGroupTalk)
 	r.Handle(wire.CommandChatTalkAck, chatHandler.DoTalkAck)
 	// group
 	groupHandler := handler.NewGroupHandler(groupService)
@@ -94,11 +161,15 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 	r.Handle(wire.CommandOfflineIndex, offlineHandler.DoSyncIndex)
 	r.Handle(wire.CommandOfflineContent, offlineHandler.DoSyncContent)
 
-	rdb, err := conf.InitRedis(config.RedisAddrs, "")
-	if err != nil {
-		return err
+	var cache qim.SessionStorage
+	switch config.SessionStorage {
+	case conf.SessionStorageMemory:
+		cache = storage.NewMemoryStorage()
+	case conf.SessionStorageRedis:
+		cache = storage.NewRedisStorage(rdb)
+	default:
+		return fmt.Errorf("unsupported session storage: %s", config.SessionStorage)
 	}
-	cache := storage.NewRedisStorage(rdb)
 	servhandler := serv.NewServHandler(r, cache,
 		logger.L.With(zap.String("module", "service")))
 
@@ -129,14 +200,54 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 	if err != nil {
 		log.Fatal(err)
 	}
+	container.SetAdminToken(config.AdminToken)
 	container.EnableMonitor(fmt.Sprintf(":%d", config.MonitorPort))
-
-	ns, err := etcd.NewNaming(strings.Split(config.EtcdEndpoints, ","),
-		logger.L.With(zap.String("module", "server.naming")))
+	container.SetLoadReport(config.LoadReport)
+
+	ns, err := backend.New(backend.Settings{
+		Backend:       config.Naming,
+		EtcdEndpoints: config.EtcdEndpoints,
+		ConsulAddress: config.ConsulAddress,
+		File:          config.NamingFile,
+		DNSDomain:     config.DNSDomain,
+		K8sNamespace:  config.K8sNamespace,
+	}, logger.L.With(zap.String("module", "server.naming")))
 	if err != nil {
 		return err
 	}
 	container.SetServiceNaming(ns)
+	container.AddAdminInfo("rate_limits", func() any {
+		return rateLimits.Rules()
+	})
+	container.OnReload("config", func() error {
+		newConfig, err := conf.Reload(opts.config)
+		if err != nil {
+			return err
+		}
+		// validate all of them first, nothing is applied if any of them is invalid
+		if err := middleware.ValidateRateLimitRules(newConfig.RateLimits); err != nil {
+			return err
+		}
+		if _, err := zapcore.ParseLevel(newConfig.LogLevel); err != nil {
+			return err
+		}
+		if newConfig.RoyalTimeout <= 0 {
+			return fmt.Errorf("invalid royal timeout: %s", newConfig.RoyalTimeout)
+		}
+		newPolicy, err := handler.NewKickoutPolicy(newConfig.DeviceClasses)
+		if err != nil {
+			return err
+		}
+
+		_ = rateLimits.Update(newConfig.RateLimits)
+		loginHandler.SetKickoutPolicy(newPolicy)
+		_ = logger.SetLevel(newConfig.LogLevel)
+		for _, setter := range royalTimeouts {
+			setter.SetTimeout(newConfig.RoyalTimeout)
+		}
+		logger.L.Info("config reloaded", zap.String("config", newConfig.String()))
+		return nil
+	})
 
 	return container.Start()
 }
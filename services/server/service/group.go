@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -11,51 +12,50 @@ import (
 )
 
 type Group interface {
-	Create(app string, req *rpcc.CreateGroupReq) (*rpcc.CreateGroupResp, error)
-	Members(app string, req *rpcc.GroupMembersReq) (*rpcc.GroupMembersResp, error)
-	Join(app string, req *rpcc.JoinGroupReq) error
-	Quit(app string, req *rpcc.QuitGroupReq) error
-	Detail(app string, req *rpcc.GetGroupReq) (*rpcc.GetGroupResp, error)
+	Create(ctx context.Context, app string, req *rpcc.CreateGroupReq) (*rpcc.CreateGroupResp, error)
+	Members(ctx context.Context, app string, req *rpcc.GroupMembersReq) (*rpcc.GroupMembersResp, error)
+	Join(ctx context.Context, app string, req *rpcc.JoinGroupReq) error
+	Quit(ctx context.Context, app string, req *rpcc.QuitGroupReq) error
+	Detail(ctx context.Context, app string, req *rpcc.GetGroupReq) (*rpcc.GetGroupResp, error)
 }
 
 type GroupHttp struct {
-	url string
-	cli *resty.Client
-	srv *resty.SRVRecord
-	lg  *zap.Logger
+	url   string
+	cli   *resty.Client
+	srv   *resty.SRVRecord
+	guard *guardTransport
+	lg    *zap.Logger
 }
 
-func NewGroupService(url string, lg *zap.Logger) Group {
-	client := resty.New().SetRetryCount(3).SetTimeout(time.Second * 5)
-	client.SetHeader("Content-Type", "application/x-protobuf")
-	client.SetHeader("Accept", "application/x-protobuf")
+func NewGroupService(url string, lg *zap.Logger, opts ...ClientOption) Group {
+	client, guard := newClient(opts...)
 	client.SetScheme("http")
 	return &GroupHttp{
-		url: url,
-		cli: client,
-		lg:  lg,
+		url:   url,
+		cli:   client,
+		guard: guard,
+		lg:    lg,
 	}
 }
 
-func NewGroupServiceWithSRV(scheme string, srv *resty.SRVRecord, lg *zap.Logger) Group {
-	cli := resty.New().SetRetryCount(3).SetTimeout(time.Second * 5)
-	cli.SetHeader("Content-Type", "application/x-protobuf")
-	cli.SetHeader("Accept", "application/x-protobuf")
+func NewGroupServiceWithSRV(scheme string, srv *resty.SRVRecord, lg *zap.Logger, opts ...ClientOption) Group {
+	cli, guard := newClient(opts...)
 	cli.SetScheme(scheme)
 	return &GroupHttp{
-		url: "",
-		cli: cli,
-		srv: srv,
-		lg:  lg,
+		url:   "",
+		cli:   cli,
+		srv:   srv,
+		guard: guard,
+		lg:    lg,
 	}
 }
 
 // Create implements Group
-func (g *GroupHttp) Create(app string, req *rpcc.CreateGroupReq) (*rpcc.CreateGroupResp, error) {
+func (g *GroupHttp) Create(ctx context.Context, app string, req *rpcc.CreateGroupReq) (*rpcc.CreateGroupResp, error) {
 	path := fmt.Sprintf("%s/api/%s/group", g.url, app)
 	body, _ := proto.Marshal(req)
 
-	response, err := g.Req().SetBody(body).Post(path)
+	response, err := g.Req(ctx, "GroupHttp.Create").SetBody(body).Post(path)
 	if err != nil {
 		return nil, err
 	}
@@ -71,10 +71,10 @@ func (g *GroupHttp) Create(app string, req *rpcc.CreateGroupReq) (*rpcc.CreateGr
 }
 
 // Detail implements Group
-func (g *GroupHttp) Detail(app string, req *rpcc.GetGroupReq) (*rpcc.GetGroupResp, error) {
+func (g *GroupHttp) Detail(ctx context.Context, app string, req *rpcc.GetGroupReq) (*rpcc.GetGroupResp, error) {
 	path := fmt.Sprintf("%s/api/%s/group", g.url, app)
 
-	response, err := g.Req().Get(path)
+	response, err := g.Req(ctx, "GroupHttp.Detail").Get(path)
 	if err != nil {
 		return nil, err
 	}
@@ -90,11 +90,11 @@ func (g *GroupHttp) Detail(app string, req *rpcc.GetGroupReq) (*rpcc.GetGroupRes
 }
 
 // Join implements Group
-func (g *GroupHttp) Join(app string, req *rpcc.JoinGroupReq) error {
+func (g *GroupHttp) Join(ctx context.Context, app string, req *rpcc.JoinGroupReq) error {
 	path := fmt.Sprintf("%s/api/%s/group/member", g.url, app)
 	body, _ := proto.Marshal(req)
 
-	response, err := g.Req().SetBody(body).Post(path)
+	response, err := g.Req(ctx, "GroupHttp.Join").SetBody(body).Post(path)
 	if err != nil {
 		return err
 	}
@@ -106,10 +106,10 @@ func (g *GroupHttp) Join(app string, req *rpcc.JoinGroupReq) error {
 }
 
 // Members implements Group
-func (g *GroupHttp) Members(app string, req *rpcc.GroupMembersReq) (*rpcc.GroupMembersResp, error) {
+func (g *GroupHttp) Members(ctx context.Context, app string, req *rpcc.GroupMembersReq) (*rpcc.GroupMembersResp, error) {
 	path := fmt.Sprintf("%s/api/%s/group/members/%s", g.url, app, req.GetGroupId())
 
-	response, err := g.Req().Get(path)
+	response, err := g.Req(ctx, "GroupHttp.Members").Get(path)
 	if err != nil {
 		return nil, err
 	}
@@ -125,11 +125,11 @@ func (g *GroupHttp) Members(app string, req *rpcc.GroupMembersReq) (*rpcc.GroupM
 }
 
 // Quit implements Group
-func (g *GroupHttp) Quit(app string, req *rpcc.QuitGroupReq) error {
+func (g *GroupHttp) Quit(ctx context.Context, app string, req *rpcc.QuitGroupReq) error {
 	path := fmt.Sprintf("%s/api/%s/group/member", g.url, app)
 	body, _ := proto.Marshal(req)
 
-	response, err := g.Req().SetBody(body).Delete(path)
+	response, err := g.Req(ctx, "GroupHttp.Quit").SetBody(body).Delete(path)
 	if err != nil {
 		return err
 	}
@@ -140,9 +140,15 @@ func (g *GroupHttp) Quit(app string, req *rpcc.QuitGroupReq) error {
 	return nil
 }
 
-func (g *GroupHttp) Req() *resty.Request {
+func (g *GroupHttp) Req(ctx context.Context, endpoint string) *resty.Request {
+	ctx = withEndpoint(ctx, endpoint)
 	if g.srv == nil {
-		return g.cli.R()
+		return g.cli.R().SetContext(ctx)
 	}
-	return g.cli.R().SetSRV(g.srv)
+	return g.cli.R().SetContext(ctx).SetSRV(g.srv)
+}
+
+// SetTimeout implements TimeoutSetter
+func (g *GroupHttp) SetTimeout(timeout time.Duration) {
+	g.guard.setTimeout(timeout)
 }
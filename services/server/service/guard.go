@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// ErrServiceUnavailable is returned without calling the royal service
+// when the circuit of the endpoint is open or too many calls are in flight
+var ErrServiceUnavailable = errors.New("royal service unavailable")
+
+const (
+	DefaultTimeout          = time.Second * 5
+	DefaultRetryCount       = 3
+	DefaultMaxConcurrency   = 500
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = time.Second * 10
+)
+
+// idempotentEndpoints can be retried safely, the others are sent only once
+var idempotentEndpoints = map[string]bool{
+	"MessageHttp.GetMessageContent": true,
+	"MessageHttp.GetMessageIndex":   true,
+	"MessageHttp.SetAck":            true,
+	"GroupHttp.Detail":              true,
+	"GroupHttp.Members":             true,
+	"GroupHttp.Quit":                true,
+}
+
+type ClientOptions struct {
+	Timeout          time.Duration
+	RetryCount       int
+	MaxConcurrency   int
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+type ClientOption func(*ClientOptions)
+
+// WithTimeout sets the timeout of each attempt
+func WithTimeout(val time.Duration) ClientOption {
+	return func(opts *ClientOptions) {
+		opts.Timeout = val
+	}
+}
+
+// WithRetryCount sets the retry count of the idempotent calls
+func WithRetryCount(val int) ClientOption {
+	return func(opts *ClientOptions) {
+		opts.RetryCount = val
+	}
+}
+
+// WithMaxConcurrency bounds the calls in flight of a service, 0 means unlimited
+func WithMaxConcurrency(val int) ClientOption {
+	return func(opts *ClientOptions) {
+		opts.MaxConcurrency = val
+	}
+}
+
+// WithBreaker opens the circuit of an endpoint after threshold consecutive failures,
+// and lets a probe through after cooldown.
+func WithBreaker(threshold int, cooldown time.Duration) ClientOption {
+	return func(opts *ClientOptions) {
+		opts.BreakerThreshold = threshold
+		opts.BreakerCooldown = cooldown
+	}
+}
+
+func newClient(opts ...ClientOption) (*resty.Client, *guardTransport) {
+	options := &ClientOptions{
+		Timeout:          DefaultTimeout,
+		RetryCount:       DefaultRetryCount,
+		MaxConcurrency:   DefaultMaxConcurrency,
+		BreakerThreshold: DefaultBreakerThreshold,
+		BreakerCooldown:  DefaultBreakerCooldown,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	cli := resty.New().SetRetryCount(options.RetryCount)
+	cli.AddRetryCondition(retryIdempotent)
+	guard := newGuardTransport(&metricsTransport{base: cli.GetClient().Transport}, options)
+	cli.SetTransport(otelhttp.NewTransport(guard))
+	cli.SetHeader("Content-Type", "application/x-protobuf")
+	cli.SetHeader("Accept", "application/x-protobuf")
+	return cli, guard
+}
+
+// TimeoutSetter is implemented by the royal services whose timeout can be changed at runtime
+type TimeoutSetter interface {
+	SetTimeout(timeout time.Duration)
+}
+
+// retryIdempotent replaces the default retry condition of resty,
+// only the idempotent calls failed by the royal service are retried.
+func retryIdempotent(resp *resty.Response, err error) bool {
+	if errors.Is(err, ErrServiceUnavailable) {
+		return false
+	}
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+	if !idempotentEndpoints[endpointOf(resp.Request.Context())] {
+		return false
+	}
+	return err != nil || resp.StatusCode() >= http.StatusInternalServerError
+}
+
+func endpointOf(ctx context.Context) string {
+	endpoint, ok := ctx.Value(endpointKey{}).(string)
+	if !ok {
+		return "unknown"
+	}
+	return endpoint
+}
+
+// guardTransport is the bulkhead of a service and the circuit breakers of its endpoints,
+// it also applies the timeout of each attempt.
+type guardTransport struct {
+	base      http.RoundTripper
+	timeout   int64
+	sem       chan struct{}
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func newGuardTransport(base http.RoundTripper, options *ClientOptions) *guardTransport {
+	t := &guardTransport{
+		base:      base,
+		timeout:   int64(options.Timeout),
+		threshold: options.BreakerThreshold,
+		cooldown:  options.BreakerCooldown,
+		breakers:  make(map[string]*breaker),
+	}
+	if options.MaxConcurrency > 0 {
+		t.sem = make(chan struct{}, options.MaxConcurrency)
+	}
+	return t
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *guardTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := endpointOf(req.Context())
+
+	if t.sem != nil {
+		select {
+		case t.sem <- struct{}{}:
+			defer func() { <-t.sem }()
+		default:
+			royalRejectedTotal.WithLabelValues(endpoint, "bulkhead").Inc()
+			return nil, ErrServiceUnavailable
+		}
+	}
+
+	b := t.breaker(endpoint)
+	if !b.allow() {
+		royalRejectedTotal.WithLabelValues(endpoint, "breaker").Inc()
+		return nil, ErrServiceUnavailable
+	}
+
+	// the context of the caller, the one of the timeout is canceled once the call fails
+	caller := req.Context()
+	cancel := func() {}
+	if timeout := t.getTimeout(); timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), timeout)
+		req = req.WithContext(ctx)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		cancel()
+	} else {
+		// the body is read after RoundTrip returns
+		resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	}
+	switch {
+	case err != nil && caller.Err() == context.Canceled:
+		// canceled by the caller, it says nothing about the royal service
+		b.release()
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		b.failure()
+	default:
+		b.success()
+	}
+	return resp, err
+}
+
+func (t *guardTransport) getTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.timeout))
+}
+
+func (t *guardTransport) setTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&t.timeout, int64(timeout))
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func (t *guardTransport) breaker(endpoint string) *breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[endpoint]
+	if !ok {
+		b = newBreaker(endpoint, t.threshold, t.cooldown)
+		t.breakers[endpoint] = b
+	}
+	return b
+}
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// breaker is a consecutive failures circuit breaker,
+// only one probe is allowed while it is half open.
+type breaker struct {
+	endpoint  string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(endpoint string, threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		endpoint:  endpoint,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+func (b *breaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(stateHalfOpen)
+		b.probing = true
+		return true
+	case stateHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+	if b.state != stateClosed {
+		b.setState(stateClosed)
+	}
+}
+
+func (b *breaker) failure() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setState(stateOpen)
+	}
+}
+
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) setState(state breakerState) {
+	b.state = state
+	royalBreakerState.WithLabelValues(b.endpoint).Set(float64(state))
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joeyscat/qim/wire/rpcc"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := newBreaker("test", 2, time.Second)
+	b.now = func() time.Time { return now }
+
+	assert.True(t, b.allow())
+	b.failure()
+	assert.True(t, b.allow())
+	b.failure()
+	// open
+	assert.False(t, b.allow())
+
+	// half open, only one probe
+	now = now.Add(time.Second)
+	assert.True(t, b.allow())
+	assert.False(t, b.allow())
+	b.failure()
+	assert.False(t, b.allow())
+
+	now = now.Add(time.Second)
+	assert.True(t, b.allow())
+	b.success()
+	assert.True(t, b.allow())
+	assert.True(t, b.allow())
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	svc := NewMessageService(ts.URL, zap.NewNop(), WithRetryCount(2), WithBreaker(0, 0))
+
+	_, err := svc.InsertUser(context.Background(), app, &rpcc.InsertMessageReq{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	_, err = svc.GetMessageIndex(context.Background(), app, &rpcc.GetOfflineMessageIndexReq{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestCircuitOpen(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	svc := NewGroupService(ts.URL, zap.NewNop(), WithRetryCount(0), WithBreaker(3, time.Minute))
+	for i := 0; i < 3; i++ {
+		_, err := svc.Create(context.Background(), app, &rpcc.CreateGroupReq{})
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, ErrServiceUnavailable))
+	}
+
+	_, err := svc.Create(context.Background(), app, &rpcc.CreateGroupReq{})
+	assert.True(t, errors.Is(err, ErrServiceUnavailable))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// the circuit is per endpoint
+	_, err = svc.Detail(context.Background(), app, &rpcc.GetGroupReq{})
+	assert.False(t, errors.Is(err, ErrServiceUnavailable))
+}
+
+func TestCircuitOpen_Refused(t *testing.T) {
+	// the connections to a closed server are refused
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+
+	svc := NewGroupService(ts.URL, zap.NewNop(), WithRetryCount(0), WithBreaker(3, time.Minute))
+	for i := 0; i < 3; i++ {
+		_, err := svc.Create(context.Background(), app, &rpcc.CreateGroupReq{})
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, ErrServiceUnavailable))
+	}
+
+	_, err := svc.Create(context.Background(), app, &rpcc.CreateGroupReq{})
+	assert.True(t, errors.Is(err, ErrServiceUnavailable))
+}
+
+func TestBulkhead(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}))
+	defer ts.Close()
+
+	svc := NewGroupService(ts.URL, zap.NewNop(), WithMaxConcurrency(1))
+	done := make(chan error)
+	go func() {
+		done <- svc.Join(context.Background(), app, &rpcc.JoinGroupReq{})
+	}()
+	// the only slot is taken by the request in flight
+	<-entered
+
+	err := svc.Join(context.Background(), app, &rpcc.JoinGroupReq{})
+	assert.True(t, errors.Is(err, ErrServiceUnavailable))
+
+	close(release)
+	assert.NoError(t, <-done)
+}
+
+func TestSetTimeout(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the requests after the first one are blocked until the test is done
+		if atomic.AddInt32(&calls, 1) > 1 {
+			<-release
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	svc := NewGroupService(ts.URL, zap.NewNop(), WithRetryCount(0), WithBreaker(0, 0))
+	assert.NoError(t, svc.Join(context.Background(), app, &rpcc.JoinGroupReq{}))
+
+	svc.(TimeoutSetter).SetTimeout(time.Millisecond * 50)
+	assert.Error(t, svc.Join(context.Background(), app, &rpcc.JoinGroupReq{}))
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -11,50 +12,49 @@ import (
 )
 
 type Message interface {
-	InsertUser(app string, req *rpcc.InsertMessageReq) (*rpcc.InsertMessageResp, error)
-	InsertGroup(app string, req *rpcc.InsertMessageReq) (*rpcc.InsertMessageResp, error)
-	SetAck(app string, req *rpcc.AckMessageReq) error
-	GetMessageIndex(app string, req *rpcc.GetOfflineMessageIndexReq) (*rpcc.GetOfflineMessageIndexResp, error)
-	GetMessageContent(app string, req *rpcc.GetOfflineMessageContentReq) (*rpcc.GetOfflineMessageContentResp, error)
+	InsertUser(ctx context.Context, app string, req *rpcc.InsertMessageReq) (*rpcc.InsertMessageResp, error)
+	InsertGroup(ctx context.Context, app string, req *rpcc.InsertMessageReq) (*rpcc.InsertMessageResp, error)
+	SetAck(ctx context.Context, app string, req *rpcc.AckMessageReq) error
+	GetMessageIndex(ctx context.Context, app string, req *rpcc.GetOfflineMessageIndexReq) (*rpcc.GetOfflineMessageIndexResp, error)
+	GetMessageContent(ctx context.Context, app string, req *rpcc.GetOfflineMessageContentReq) (*rpcc.GetOfflineMessageContentResp, error)
 }
 
 type MessageHttp struct {
-	url string
-	cli *resty.Client
-	srv *resty.SRVRecord
-	lg  *zap.Logger
+	url   string
+	cli   *resty.Client
+	srv   *resty.SRVRecord
+	guard *guardTransport
+	lg    *zap.Logger
 }
 
-func NewMessageService(url string, lg *zap.Logger) Message {
-	client := resty.New().SetRetryCount(3).SetTimeout(time.Second * 5)
-	client.SetHeader("Content-Type", "application/x-protobuf")
-	client.SetHeader("Accept", "application/x-protobuf")
+func NewMessageService(url string, lg *zap.Logger, opts ...ClientOption) Message {
+	client, guard := newClient(opts...)
 	return &MessageHttp{
-		url: url,
-		cli: client,
-		lg:  lg,
+		url:   url,
+		cli:   client,
+		guard: guard,
+		lg:    lg,
 	}
 }
-func NewMessageServiceWithSRV(scheme string, srv *resty.SRVRecord, lg *zap.Logger) Message {
-	cli := resty.New().SetRetryCount(3).SetTimeout(time.Second * 5)
-	cli.SetHeader("Content-Type", "application/x-protobuf")
-	cli.SetHeader("Accept", "application/x-protobuf")
+func NewMessageServiceWithSRV(scheme string, srv *resty.SRVRecord, lg *zap.Logger, opts ...ClientOption) Message {
+	cli, guard := newClient(opts...)
 	cli.SetScheme(scheme)
 
 	return &MessageHttp{
-		url: "",
-		cli: cli,
-		srv: srv,
-		lg:  lg,
+		url:   "",
+		cli:   cli,
+		srv:   srv,
+		guard: guard,
+		lg:    lg,
 	}
 }
 
 // GetMessageContent implements Message
-func (m *MessageHttp) GetMessageContent(app string, req *rpcc.GetOfflineMessageContentReq) (*rpcc.GetOfflineMessageContentResp, error) {
+func (m *MessageHttp) GetMessageContent(ctx context.Context, app string, req *rpcc.GetOfflineMessageContentReq) (*rpcc.GetOfflineMessageContentResp, error) {
 	path := fmt.Sprintf("%s/api/%s/offline/content", m.url, app)
 
 	body, _ := proto.Marshal(req)
-	response, err := m.Req().SetBody(body).Post(path)
+	response, err := m.Req(ctx, "MessageHttp.GetMessageContent").SetBody(body).Post(path)
 	if err != nil {
 		return nil, err
 	}
@@ -68,11 +68,11 @@ func (m *MessageHttp) GetMessageContent(app string, req *rpcc.GetOfflineMessageC
 }
 
 // GetMessageIndex implements Message
-func (m *MessageHttp) GetMessageIndex(app string, req *rpcc.GetOfflineMessageIndexReq) (*rpcc.GetOfflineMessageIndexResp, error) {
+func (m *MessageHttp) GetMessageIndex(ctx context.Context, app string, req *rpcc.GetOfflineMessageIndexReq) (*rpcc.GetOfflineMessageIndexResp, error) {
 	path := fmt.Sprintf("%s/api/%s/offline/index", m.url, app)
 	body, _ := proto.Marshal(req)
 
-	response, err := m.Req().SetBody(body).Post(path)
+	response, err := m.Req(ctx, "MessageHttp.GetMessageIndex").SetBody(body).Post(path)
 	if err != nil {
 		return nil, err
 	}
@@ -86,12 +86,12 @@ func (m *MessageHttp) GetMessageIndex(app string, req *rpcc.GetOfflineMessageInd
 }
 
 // InsertGroup implements Message
-func (m *MessageHttp) InsertGroup(app string, req *rpcc.InsertMessageReq) (*rpcc.InsertMessageResp, error) {
+func (m *MessageHttp) InsertGroup(ctx context.Context, app string, req *rpcc.InsertMessageReq) (*rpcc.InsertMessageResp, error) {
 	path := fmt.Sprintf("%s/api/%s/message/group", m.url, app)
 	t1 := time.Now()
 	body, _ := proto.Marshal(req)
 
-	response, err := m.Req().SetBody(body).Post(path)
+	response, err := m.Req(ctx, "MessageHttp.InsertGroup").SetBody(body).Post(path)
 	if err != nil {
 		return nil, err
 	}
@@ -106,12 +106,12 @@ func (m *MessageHttp) InsertGroup(app string, req *rpcc.InsertMessageReq) (*rpcc
 }
 
 // InsertUser implements Message
-func (m *MessageHttp) InsertUser(app string, req *rpcc.InsertMessageReq) (*rpcc.InsertMessageResp, error) {
+func (m *MessageHttp) InsertUser(ctx context.Context, app string, req *rpcc.InsertMessageReq) (*rpcc.InsertMessageResp, error) {
 	path := fmt.Sprintf("%s/api/%s/message/user", m.url, app)
 	t1 := time.Now()
 	body, _ := proto.Marshal(req)
 
-	response, err := m.Req().SetBody(body).Post(path)
+	response, err := m.Req(ctx, "MessageHttp.InsertUser").SetBody(body).Post(path)
 	if err != nil {
 		return nil, err
 	}
@@ -126,11 +126,11 @@ func (m *MessageHttp) InsertUser(app string, req *rpcc.InsertMessageReq) (*rpcc.
 }
 
 // SetAck implements Message
-func (m *MessageHttp) SetAck(app string, req *rpcc.AckMessageReq) error {
+func (m *MessageHttp) SetAck(ctx context.Context, app string, req *rpcc.AckMessageReq) error {
 	path := fmt.Sprintf("%s/api/%s/message/ack", m.url, app)
 	body, _ := proto.Marshal(req)
 
-	response, err := m.Req().SetBody(body).Post(path)
+	response, err := m.Req(ctx, "MessageHttp.SetAck").SetBody(body).Post(path)
 	if err != nil {
 		return err
 	}
@@ -141,9 +141,15 @@ func (m *MessageHttp) SetAck(app string, req *rpcc.AckMessageReq) error {
 	return nil
 }
 
-func (m MessageHttp) Req() *resty.Request {
+func (m MessageHttp) Req(ctx context.Context, endpoint string) *resty.Request {
+	ctx = withEndpoint(ctx, endpoint)
 	if m.srv == nil {
-		return m.cli.R()
+		return m.cli.R().SetContext(ctx)
 	}
-	return m.cli.R().SetSRV(m.srv)
+	return m.cli.R().SetContext(ctx).SetSRV(m.srv)
+}
+
+// SetTimeout implements TimeoutSetter
+func (m *MessageHttp) SetTimeout(timeout time.Duration) {
+	m.guard.setTimeout(timeout)
 }
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -26,7 +27,7 @@ func TestMessage(t *testing.T) {
 		Body: "hello",
 	}
 	dest := fmt.Sprintf("u%d", time.Now().Unix())
-	_, err := messageService.InsertUser(app, &rpcc.InsertMessageReq{
+	_, err := messageService.InsertUser(context.Background(), app, &rpcc.InsertMessageReq{
 		Sender:   "u1",
 		Dest:     dest,
 		SendTime: time.Now().UnixNano(),
@@ -34,7 +35,7 @@ func TestMessage(t *testing.T) {
 	})
 	assert.NoError(t, err)
 
-	resp, err := messageService.GetMessageIndex(app, &rpcc.GetOfflineMessageIndexReq{
+	resp, err := messageService.GetMessageIndex(context.Background(), app, &rpcc.GetOfflineMessageIndexReq{
 		Account: dest,
 	})
 	assert.NoError(t, err)
@@ -43,7 +44,7 @@ func TestMessage(t *testing.T) {
 	index := resp.GetList()[0]
 	assert.Equal(t, "u1", index.GetAccountB())
 
-	resp2, err := messageService.GetMessageContent(app, &rpcc.GetOfflineMessageContentReq{
+	resp2, err := messageService.GetMessageContent(context.Background(), app, &rpcc.GetOfflineMessageContentReq{
 		MessageIds: []int64{index.GetMessageId()},
 	})
 	assert.NoError(t, err)
@@ -54,14 +55,14 @@ func TestMessage(t *testing.T) {
 	assert.Equal(t, m.GetType(), content.GetType())
 	assert.Equal(t, index.GetMessageId(), content.GetId())
 
-	resp, err = messageService.GetMessageIndex(app, &rpcc.GetOfflineMessageIndexReq{
+	resp, err = messageService.GetMessageIndex(context.Background(), app, &rpcc.GetOfflineMessageIndexReq{
 		Account:   dest,
 		MessageId: index.GetMessageId(),
 	})
 	assert.NoError(t, err)
 	assert.Equal(t, 0, len(resp.GetList()))
 
-	resp, err = messageService.GetMessageIndex(app, &rpcc.GetOfflineMessageIndexReq{
+	resp, err = messageService.GetMessageIndex(context.Background(), app, &rpcc.GetOfflineMessageIndexReq{
 		Account: dest,
 	})
 	assert.NoError(t, err)
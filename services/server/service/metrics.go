@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var royalRequestDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "qim",
+	Name:      "royal_request_duration_seconds",
+	Help:      "调用royal服务的耗时",
+	Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+}, []string{"endpoint"})
+
+var royalRequestTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "royal_request_total",
+	Help:      "调用royal服务的次数",
+}, []string{"endpoint", "code"})
+
+var royalRejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "qim",
+	Name:      "royal_rejected_total",
+	Help:      "被熔断或舱壁拒绝的royal服务调用数",
+}, []string{"endpoint", "reason"})
+
+var royalBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "qim",
+	Name:      "royal_breaker_state",
+	Help:      "royal服务接口的熔断状态, 0: 关闭 1: 打开 2: 半开",
+}, []string{"endpoint"})
+
+type endpointKey struct{}
+
+func withEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, endpoint)
+}
+
+// metricsTransport records every attempt of the http requests to the royal service
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := endpointOf(req.Context())
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	royalRequestDurationSeconds.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	royalRequestTotal.WithLabelValues(endpoint, code).Inc()
+	return resp, err
+}
@@ -21,18 +21,26 @@ type Server struct {
 }
 
 type Config struct {
-	ServiceID     string
-	NodeID        int64
-	Listen        string `default:":8080"`
-	PublicAddress string
-	PublicPort    uint16 `default:"8080"`
-	Tags          []string
-	EtcdEndpoints string
-	RedisAddrs    string
-	Driver        string `default:"mysql"`
-	BaseDB        string
-	MessageDB     string
-	LogLevel      string `default:"debug"`
+	ServiceID        string
+	NodeID           int64
+	Listen           string `default:":8080"`
+	PublicAddress    string
+	PublicPort       uint16 `default:"8080"`
+	Tags             []string
+	Naming           string `default:"etcd"`
+	EtcdEndpoints    string
+	ConsulAddress    string
+	NamingFile       string
+	DNSDomain        string
+	K8sNamespace     string
+	RedisAddrs       string
+	Driver           string `default:"mysql"`
+	BaseDB           string
+	MessageDB        string
+	LogLevel         string `default:"debug"`
+	TraceExporter    string
+	TraceEndpoint    string
+	TraceSampleRatio float64 `default:"1"`
 }
 
 func (c Config) String() string {
@@ -4,17 +4,22 @@ import (
 	"context"
 	"hash/crc32"
 	"log"
-	"strings"
 
 	"github.com/joeyscat/qim/logger"
 	"github.com/joeyscat/qim/naming"
-	"github.com/joeyscat/qim/naming/etcd"
+	"github.com/joeyscat/qim/naming/backend"
 	"github.com/joeyscat/qim/services/service/conf"
 	"github.com/joeyscat/qim/services/service/database"
 	"github.com/joeyscat/qim/services/service/handler"
+	"github.com/joeyscat/qim/tracing"
 	"github.com/joeyscat/qim/wire"
 	"github.com/kataras/iris/v12"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -51,6 +56,20 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 	}
 	logger.L.Debug("load config finished", zap.String("config", config.String()))
 
+	shutdownTracing, err := tracing.Init(tracing.Settings{
+		ServiceName: wire.SNService,
+		ServiceID:   config.ServiceID,
+		Exporter:    config.TraceExporter,
+		Endpoint:    config.TraceEndpoint,
+		SampleRatio: config.TraceSampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = shutdownTracing(context.Background())
+	}()
+
 	var (
 		baseDB    *gorm.DB
 		messageDB *gorm.DB
@@ -81,8 +100,14 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 		return err
 	}
 
-	ns, err := etcd.NewNaming(strings.Split(config.EtcdEndpoints, ","),
-		logger.L.With(zap.String("module", "service.naming")))
+	ns, err := backend.New(backend.Settings{
+		Backend:       config.Naming,
+		EtcdEndpoints: config.EtcdEndpoints,
+		ConsulAddress: config.ConsulAddress,
+		File:          config.NamingFile,
+		DNSDomain:     config.DNSDomain,
+		K8sNamespace:  config.K8sNamespace,
+	}, logger.L.With(zap.String("module", "service.naming")))
 	if err != nil {
 		return err
 	}
@@ -112,6 +137,7 @@ func RunServerStart(ctx context.Context, opts *ServerStartOptions, version strin
 
 	app := newApp(&serviceHandler)
 	app.UseRouter(ac.Handler)
+	app.UseRouter(tracingHandler)
 	app.UseRouter(setAllowedResponses)
 
 	return app.Listen(config.Listen, iris.WithOptimizations)
@@ -157,6 +183,24 @@ func setAllowedResponses(ctx iris.Context) {
 	ctx.Next()
 }
 
+// continue the trace propagated by the chat server in http headers
+func tracingHandler(ctx iris.Context) {
+	r := ctx.Request()
+	parent := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	spanCtx, span := tracing.Tracer().Start(parent, r.Method+" "+r.URL.Path,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.HTTPMethod(r.Method), semconv.HTTPTarget(r.URL.Path)))
+	defer span.End()
+
+	ctx.ResetRequest(r.WithContext(spanCtx))
+	ctx.Next()
+
+	span.SetAttributes(semconv.HTTPStatusCode(ctx.GetStatusCode()))
+	if ctx.GetStatusCode() >= 500 {
+		span.SetStatus(codes.Error, "")
+	}
+}
+
 func HashCode(key string) uint32 {
 	hash32 := crc32.NewIEEE()
 	hash32.Write([]byte(key))
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/wire/pkt"
+	"google.golang.org/protobuf/proto"
+)
+
+// MemoryStorage keeps the sessions in the memory of the process, the keys expire the same
+// as the keys of RedisStorage. It is for a chat server running alone, such as in local.
+type MemoryStorage struct {
+	sync.Mutex
+	// key: account, value: the devices the account is logged in on
+	devices map[string]*memoryDevices
+	// key: KeyLocation
+	locations map[string]*memoryLocation
+	// key: channelID
+	sessions  map[string]*memorySession
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryDevices struct {
+	devices  map[string]struct{}
+	expireAt time.Time
+}
+
+type memoryLocation struct {
+	loc      qim.Location
+	expireAt time.Time
+}
+
+type memorySession struct {
+	// the session is marshaled, so that it is copied like the one read from redis
+	buf      []byte
+	expireAt time.Time
+}
+
+var _ qim.SessionStorage = (*MemoryStorage)(nil)
+
+func NewMemoryStorage() qim.SessionStorage {
+	return newMemoryStorage(time.Now)
+}
+
+func newMemoryStorage(now func() time.Time) *MemoryStorage {
+	return &MemoryStorage{
+		devices:   make(map[string]*memoryDevices),
+		locations: make(map[string]*memoryLocation),
+		sessions:  make(map[string]*memorySession),
+		lastSweep: now(),
+		now:       now,
+	}
+}
+
+// Add implements qim.SessionStorage
+func (s *MemoryStorage) Add(session *pkt.Session) error {
+	buf, _ := proto.Marshal(session)
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	expireAt := now.Add(LocationExpired)
+
+	s.locations[KeyLocation(session.GetAccount(), session.GetDevice())] = &memoryLocation{
+		loc: qim.Location{
+			ChannelID: session.GetChannelId(),
+			GateID:    session.GetGateId(),
+			Device:    session.GetDevice(),
+		},
+		expireAt: expireAt,
+	}
+	devs := s.getDevices(session.GetAccount(), now)
+	if devs == nil {
+		devs = &memoryDevices{devices: make(map[string]struct{})}
+		s.devices[session.GetAccount()] = devs
+	}
+	devs.devices[session.GetDevice()] = struct{}{}
+	devs.expireAt = expireAt
+	s.sessions[session.GetChannelId()] = &memorySession{buf: buf, expireAt: expireAt}
+	return nil
+}
+
+// Delete implements qim.SessionStorage, the location of the device is only deleted if it
+// is still of the channel.
+func (s *MemoryStorage) Delete(account string, channelID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.now()
+	if devs := s.getDevices(account, now); devs != nil {
+		for device := range devs.devices {
+			key := KeyLocation(account, device)
+			loc := s.getLocation(key, now)
+			if loc == nil || loc.ChannelID != channelID {
+				continue
+			}
+			delete(s.locations, key)
+			delete(devs.devices, device)
+		}
+		// an empty set is removed by redis
+		if len(devs.devices) == 0 {
+			delete(s.devices, account)
+		}
+	}
+	delete(s.sessions, channelID)
+	return nil
+}
+
+// Get implements qim.SessionStorage
+func (s *MemoryStorage) Get(channelID string) (*pkt.Session, error) {
+	s.Lock()
+	sn, ok := s.sessions[channelID]
+	if ok && !s.now().Before(sn.expireAt) {
+		delete(s.sessions, channelID)
+		ok = false
+	}
+	s.Unlock()
+	if !ok {
+		return nil, qim.ErrSessionNil
+	}
+
+	var session pkt.Session
+	_ = proto.Unmarshal(sn.buf, &session)
+	return &session, nil
+}
+
+// GetLocation implements qim.SessionStorage
+func (s *MemoryStorage) GetLocation(account string, device string) (*qim.Location, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	loc := s.getLocation(KeyLocation(account, device), s.now())
+	if loc == nil {
+		return nil, qim.ErrSessionNil
+	}
+	copied := *loc
+	return &copied, nil
+}
+
+// GetLocations implements qim.SessionStorage, the locations of all the devices of
+// the accounts are returned, sorted by account and device.
+func (s *MemoryStorage) GetLocations(account ...string) ([]*qim.Location, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.now()
+	var result = make([]*qim.Location, 0)
+	for _, acc := range account {
+		devs := s.getDevices(acc, now)
+		if devs == nil {
+			continue
+		}
+		devices := make([]string, 0, len(devs.devices))
+		for device := range devs.devices {
+			devices = append(devices, device)
+		}
+		sort.Strings(devices)
+		for _, device := range devices {
+			// the location is expired or deleted
+			loc := s.getLocation(KeyLocation(acc, device), now)
+			if loc == nil {
+				continue
+			}
+			copied := *loc
+			result = append(result, &copied)
+		}
+	}
+	return result, nil
+}
+
+func (s *MemoryStorage) getDevices(account string, now time.Time) *memoryDevices {
+	devs, ok := s.devices[account]
+	if !ok {
+		return nil
+	}
+	if !now.Before(devs.expireAt) {
+		delete(s.devices, account)
+		return nil
+	}
+	return devs
+}
+
+func (s *MemoryStorage) getLocation(key string, now time.Time) *qim.Location {
+	loc, ok := s.locations[key]
+	if !ok {
+		return nil
+	}
+	if !now.Before(loc.expireAt) {
+		delete(s.locations, key)
+		return nil
+	}
+	return &loc.loc
+}
+
+// sweep removes the expired keys which are never read again
+func (s *MemoryStorage) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, devs := range s.devices {
+		if !now.Before(devs.expireAt) {
+			delete(s.devices, key)
+		}
+	}
+	for key, loc := range s.locations {
+		if !now.Before(loc.expireAt) {
+			delete(s.locations, key)
+		}
+	}
+	for key, sn := range s.sessions {
+		if !now.Before(sn.expireAt) {
+			delete(s.sessions, key)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is the clock of the memory storage moved forward by the tests
+type fakeClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Forward(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestMemoryStorage() (*MemoryStorage, *fakeClock) {
+	clock := &fakeClock{now: time.Now()}
+	return newMemoryStorage(clock.Now), clock
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testSessionStorage(t, func(t *testing.T) (qim.SessionStorage, func(time.Duration)) {
+		s, clock := newTestMemoryStorage()
+		return s, clock.Forward
+	})
+}
+
+func TestMemoryStorage_Sweep(t *testing.T) {
+	s, clock := newTestMemoryStorage()
+	assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c1", GateId: "g1", Account: "a1", Device: "ios"}))
+
+	clock.Forward(LocationExpired)
+	// the keys never read again are removed by the next Add
+	assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c2", GateId: "g1", Account: "a2"}))
+	assert.Equal(t, 1, len(s.devices))
+	assert.Equal(t, 1, len(s.locations))
+	assert.Equal(t, 1, len(s.sessions))
+}
+
+func TestMemoryStorage_Concurrent(t *testing.T) {
+	s := NewMemoryStorage()
+	var wg sync.WaitGroup
+	for _, device := range []string{"ios", "android", "mac", "web"} {
+		wg.Add(1)
+		go func(device string) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				channelID := device + "_channel"
+				_ = s.Add(&pkt.Session{ChannelId: channelID, GateId: "g1", Account: "a1", Device: device})
+				_, _ = s.GetLocations("a1")
+				_ = s.Delete("a1", channelID)
+			}
+		}(device)
+	}
+	wg.Wait()
+
+	locs, err := s.GetLocations("a1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(locs))
+}
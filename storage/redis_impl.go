@@ -2,6 +2,8 @@ package storage
 
 import (
 	"fmt"
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -24,35 +26,69 @@ func NewRedisStorage(cli *redis.Client) qim.SessionStorage {
 	}
 }
 
-// Add implements qim.SessionStorage
+// Add implements qim.SessionStorage, the location is saved by the device of the session,
+// so that an account is able to be logged in on more than one device.
 func (s *RedisStorage) Add(session *pkt.Session) error {
 	// save qim.Location
 	loc := qim.Location{
 		ChannelID: session.GetChannelId(),
 		GateID:    session.GetGateId(),
+		Device:    session.GetDevice(),
 	}
 	locKey := KeyLocation(session.GetAccount(), session.GetDevice())
-	err := s.cli.Set(s.cli.Context(), locKey, loc.Bytes(), LocationExpired).Err()
-	if err != nil {
-		return err
-	}
-
+	devKey := KeyDevices(session.GetAccount())
 	// save session
 	snKey := KeySession(session.GetChannelId())
 	buf, _ := proto.Marshal(session)
-	return s.cli.Set(s.cli.Context(), snKey, buf, LocationExpired).Err()
+
+	ctx := s.cli.Context()
+	_, err := s.cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, locKey, loc.Bytes(), LocationExpired)
+		pipe.SAdd(ctx, devKey, session.GetDevice())
+		// the devices expire with the latest location of them
+		pipe.Expire(ctx, devKey, LocationExpired)
+		pipe.Set(ctx, snKey, buf, LocationExpired)
+		return nil
+	})
+	return err
 }
 
-// Delete implements qim.SessionStorage
+// Delete implements qim.SessionStorage, the location of the device is only deleted if it
+// is still of the channel, it may be taken by a new login on the same device.
 func (s *RedisStorage) Delete(account string, channelID string) error {
-	locKey := KeyLocation(account, "")
-	err := s.cli.Del(s.cli.Context(), locKey).Err()
+	ctx := s.cli.Context()
+	devices, err := s.cli.SMembers(ctx, KeyDevices(account)).Result()
 	if err != nil {
 		return err
 	}
+	for _, device := range withLegacy(devices) {
+		locKey := KeyLocation(account, device)
+		err = s.cli.Watch(ctx, func(tx *redis.Tx) error {
+			bts, err := tx.Get(ctx, locKey).Bytes()
+			if err == redis.Nil {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			var loc qim.Location
+			if err = loc.Unmarshal(bts); err == nil && loc.ChannelID != channelID {
+				return nil
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Del(ctx, locKey)
+				pipe.SRem(ctx, KeyDevices(account), device)
+				return nil
+			})
+			return err
+		}, locKey)
+		if err != nil {
+			return err
+		}
+	}
 
 	snKey := KeySession(channelID)
-	return s.cli.Del(s.cli.Context(), snKey).Err()
+	return s.cli.Del(ctx, snKey).Err()
 }
 
 // Get implements qim.SessionStorage
@@ -87,16 +123,41 @@ func (s *RedisStorage) GetLocation(account string, device string) (*qim.Location
 	return &loc, nil
 }
 
-// GetLocations implements qim.SessionStorage
+// GetLocations implements qim.SessionStorage, the locations of all the devices of
+// the accounts are returned, sorted by account and device.
 func (s *RedisStorage) GetLocations(account ...string) ([]*qim.Location, error) {
-	keys := KeyLocations(account...)
-	list, err := s.cli.MGet(s.cli.Context(), keys...).Result()
+	if len(account) == 0 {
+		return []*qim.Location{}, nil
+	}
+	ctx := s.cli.Context()
+	cmds, err := s.cli.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, acc := range account {
+			pipe.SMembers(ctx, KeyDevices(acc))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for i, cmd := range cmds {
+		devices := withLegacy(cmd.(*redis.StringSliceCmd).Val())
+		for _, device := range devices {
+			keys = append(keys, KeyLocation(account[i], device))
+		}
+	}
+	var result = make([]*qim.Location, 0, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+	list, err := s.cli.MGet(ctx, keys...).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	var result = make([]*qim.Location, 0)
 	for _, v := range list {
+		// the location is expired or deleted
 		if v == nil {
 			continue
 		}
@@ -109,6 +170,17 @@ func (s *RedisStorage) GetLocations(account ...string) ([]*qim.Location, error)
 	return result, nil
 }
 
+// withLegacy adds the device "" to the devices of an account and sorts them. The locations
+// saved before the devices were introduced are at KeyLocation(account, "") without the set
+// of the devices, they are kept until the sessions log out or expire.
+func withLegacy(devices []string) []string {
+	if !slices.Contains(devices, "") {
+		devices = append(devices, "")
+	}
+	sort.Strings(devices)
+	return devices
+}
+
 func KeyLocation(account, device string) string {
 	if device == "" {
 		return fmt.Sprintf("login:loc:%s", account)
@@ -116,12 +188,9 @@ func KeyLocation(account, device string) string {
 	return fmt.Sprintf("login:loc:%s:%s", account, device)
 }
 
-func KeyLocations(accounts ...string) []string {
-	arr := make([]string, len(accounts))
-	for i, account := range accounts {
-		arr[i] = KeyLocation(account, "")
-	}
-	return arr
+// KeyDevices is the set of the devices an account is logged in on
+func KeyDevices(account string) string {
+	return fmt.Sprintf("login:dev:%s", account)
 }
 
 func KeySession(channelID string) string {
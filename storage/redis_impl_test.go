@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRedisStorage(t *testing.T) (qim.SessionStorage, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = cli.Close() })
+	return NewRedisStorage(cli), mr
+}
+
+func TestRedisStorage(t *testing.T) {
+	testSessionStorage(t, func(t *testing.T) (qim.SessionStorage, func(time.Duration)) {
+		s, mr := newRedisStorage(t)
+		return s, mr.FastForward
+	})
+}
+
+func TestRedisStorage_Keys(t *testing.T) {
+	s, mr := newRedisStorage(t)
+
+	assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c1", GateId: "g1", Account: "a1", Device: "ios"}))
+	assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c2", GateId: "g1", Account: "a1"}))
+	assert.Equal(t, LocationExpired, mr.TTL(KeyLocation("a1", "ios")))
+	assert.Equal(t, LocationExpired, mr.TTL(KeyDevices("a1")))
+	assert.Equal(t, LocationExpired, mr.TTL(KeySession("c1")))
+	assert.True(t, mr.Exists("login:loc:a1"))
+	members, err := mr.SMembers(KeyDevices("a1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"", "ios"}, members)
+
+	assert.Nil(t, s.Delete("a1", "c1"))
+	assert.False(t, mr.Exists(KeyLocation("a1", "ios")))
+	members, err = mr.SMembers(KeyDevices("a1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{""}, members)
+	assert.Nil(t, s.Delete("a1", "c2"))
+	assert.False(t, mr.Exists(KeyDevices("a1")))
+}
+
+func TestRedisStorage_Legacy(t *testing.T) {
+	s, mr := newRedisStorage(t)
+
+	// a session of the release before the devices
+	legacy := qim.Location{ChannelID: "c1", GateID: "g1"}
+	assert.Nil(t, mr.Set(KeyLocation("a1", ""), string(legacy.Bytes())))
+	assert.Nil(t, mr.Set(KeySession("c1"), "legacy"))
+
+	locs, err := s.GetLocations("a1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(locs))
+	assert.Equal(t, "c1", locs[0].ChannelID)
+
+	// logged in on a device after the upgrade
+	assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c2", GateId: "g1", Account: "a1", Device: "ios"}))
+	locs, err = s.GetLocations("a1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(locs))
+	assert.Equal(t, "c1", locs[0].ChannelID)
+	assert.Equal(t, "c2", locs[1].ChannelID)
+
+	assert.Nil(t, s.Delete("a1", "c1"))
+	assert.False(t, mr.Exists(KeyLocation("a1", "")))
+	assert.False(t, mr.Exists(KeySession("c1")))
+	locs, err = s.GetLocations("a1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(locs))
+	assert.Equal(t, "c2", locs[0].ChannelID)
+}
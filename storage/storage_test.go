@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joeyscat/qim"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+// storageFactory creates an empty storage, and a function to move its clock forward
+type storageFactory func(t *testing.T) (qim.SessionStorage, func(time.Duration))
+
+// testSessionStorage is the conformance suite of qim.SessionStorage, every implementation must pass it
+func testSessionStorage(t *testing.T, newStorage storageFactory) {
+	t.Run("Get", func(t *testing.T) {
+		s, _ := newStorage(t)
+		_, err := s.Get("c1")
+		assert.Equal(t, qim.ErrSessionNil, err)
+
+		session := &pkt.Session{ChannelId: "c1", GateId: "g1", Account: "a1", App: "qim", Device: "ios", Tags: []string{"t1"}}
+		assert.Nil(t, s.Add(session))
+		got, err := s.Get("c1")
+		assert.Nil(t, err)
+		assert.True(t, proto.Equal(session, got))
+
+		// the session returned is a copy
+		got.Account = "a2"
+		got, err = s.Get("c1")
+		assert.Nil(t, err)
+		assert.Equal(t, "a1", got.GetAccount())
+	})
+
+	t.Run("GetLocation", func(t *testing.T) {
+		s, _ := newStorage(t)
+		_, err := s.GetLocation("a1", "")
+		assert.Equal(t, qim.ErrSessionNil, err)
+
+		assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c1", GateId: "g1", Account: "a1", Device: "ios"}))
+		assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c2", GateId: "g2", Account: "a1"}))
+		loc, err := s.GetLocation("a1", "ios")
+		assert.Nil(t, err)
+		assert.Equal(t, &qim.Location{ChannelID: "c1", GateID: "g1", Device: "ios"}, loc)
+		loc, err = s.GetLocation("a1", "")
+		assert.Nil(t, err)
+		assert.Equal(t, &qim.Location{ChannelID: "c2", GateID: "g2"}, loc)
+		_, err = s.GetLocation("a1", "mac")
+		assert.Equal(t, qim.ErrSessionNil, err)
+
+		// a new login on the same device takes the location
+		assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c3", GateId: "g2", Account: "a1", Device: "ios"}))
+		loc, err = s.GetLocation("a1", "ios")
+		assert.Nil(t, err)
+		assert.Equal(t, "c3", loc.ChannelID)
+	})
+
+	t.Run("GetLocations", func(t *testing.T) {
+		s, _ := newStorage(t)
+		locs, err := s.GetLocations()
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(locs))
+		locs, err = s.GetLocations("a1")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(locs))
+
+		assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c1", GateId: "g1", Account: "a1", Device: "ios"}))
+		assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c2", GateId: "g2", Account: "a1", Device: "mac"}))
+		assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c3", GateId: "g1", Account: "a1"}))
+		assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c4", GateId: "g1", Account: "a2", Device: "ios"}))
+
+		locs, err = s.GetLocations("a2", "a1", "a3")
+		assert.Nil(t, err)
+		assert.Equal(t, []*qim.Location{
+			{ChannelID: "c4", GateID: "g1", Device: "ios"},
+			{ChannelID: "c3", GateID: "g1"},
+			{ChannelID: "c1", GateID: "g1", Device: "ios"},
+			{ChannelID: "c2", GateID: "g2", Device: "mac"},
+		}, locs)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		s, _ := newStorage(t)
+		assert.Nil(t, s.Delete("a1", "c1"))
+
+		assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c1", GateId: "g1", Account: "a1", Device: "ios"}))
+		assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c2", GateId: "g2", Account: "a1", Device: "mac"}))
+		assert.Nil(t, s.Delete("a1", "c2"))
+		_, err := s.Get("c2")
+		assert.Equal(t, qim.ErrSessionNil, err)
+		_, err = s.GetLocation("a1", "mac")
+		assert.Equal(t, qim.ErrSessionNil, err)
+		locs, err := s.GetLocations("a1")
+		assert.Nil(t, err)
+		assert.Equal(t, []*qim.Location{{ChannelID: "c1", GateID: "g1", Device: "ios"}}, locs)
+
+		// the logout of the session kicked out keeps the location of the new login
+		assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c3", GateId: "g2", Account: "a1", Device: "ios"}))
+		assert.Nil(t, s.Delete("a1", "c1"))
+		_, err = s.Get("c1")
+		assert.Equal(t, qim.ErrSessionNil, err)
+		loc, err := s.GetLocation("a1", "ios")
+		assert.Nil(t, err)
+		assert.Equal(t, "c3", loc.ChannelID)
+		_, err = s.Get("c3")
+		assert.Nil(t, err)
+
+		assert.Nil(t, s.Delete("a1", "c3"))
+		locs, err = s.GetLocations("a1")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(locs))
+	})
+
+	t.Run("Expire", func(t *testing.T) {
+		s, forward := newStorage(t)
+		assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c1", GateId: "g1", Account: "a1", Device: "ios"}))
+
+		forward(LocationExpired - time.Second)
+		_, err := s.Get("c1")
+		assert.Nil(t, err)
+		_, err = s.GetLocation("a1", "ios")
+		assert.Nil(t, err)
+
+		// the login on mac keeps the devices, but not the location of ios
+		assert.Nil(t, s.Add(&pkt.Session{ChannelId: "c2", GateId: "g1", Account: "a1", Device: "mac"}))
+		forward(time.Second)
+		_, err = s.Get("c1")
+		assert.Equal(t, qim.ErrSessionNil, err)
+		_, err = s.GetLocation("a1", "ios")
+		assert.Equal(t, qim.ErrSessionNil, err)
+		locs, err := s.GetLocations("a1")
+		assert.Nil(t, err)
+		assert.Equal(t, []*qim.Location{{ChannelID: "c2", GateID: "g1", Device: "mac"}}, locs)
+
+		forward(LocationExpired)
+		_, err = s.Get("c2")
+		assert.Equal(t, qim.ErrSessionNil, err)
+		locs, err = s.GetLocations("a1")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(locs))
+	})
+}
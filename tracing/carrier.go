@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/joeyscat/qim/wire/pkt"
+	"go.opentelemetry.io/otel"
+)
+
+// MetaCarrier carries the trace context in the meta of a packet header
+type MetaCarrier struct {
+	header *pkt.Header
+}
+
+func NewMetaCarrier(header *pkt.Header) *MetaCarrier {
+	return &MetaCarrier{header: header}
+}
+
+// Get implements propagation.TextMapCarrier
+func (c *MetaCarrier) Get(key string) string {
+	for _, m := range c.header.Meta {
+		if m.Key == key {
+			return m.Value
+		}
+	}
+	return ""
+}
+
+// Set implements propagation.TextMapCarrier
+func (c *MetaCarrier) Set(key string, value string) {
+	for _, m := range c.header.Meta {
+		if m.Key == key {
+			m.Value = value
+			m.Type = pkt.MetaType_string
+			return
+		}
+	}
+	c.header.Meta = append(c.header.Meta, &pkt.Meta{
+		Key:   key,
+		Value: value,
+		Type:  pkt.MetaType_string,
+	})
+}
+
+// Keys implements propagation.TextMapCarrier
+func (c *MetaCarrier) Keys() []string {
+	keys := make([]string, len(c.header.Meta))
+	for i, m := range c.header.Meta {
+		keys[i] = m.Key
+	}
+	return keys
+}
+
+// Inject writes the trace context of ctx into the header meta
+func Inject(ctx context.Context, header *pkt.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, NewMetaCarrier(header))
+}
+
+// Extract reads the trace context from the header meta
+func Extract(ctx context.Context, header *pkt.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, NewMetaCarrier(header))
+}
+
+// Clean removes the trace context from the header meta,
+// it is called before a packet is pushed to the client.
+func Clean(header *pkt.Header) {
+	fields := otel.GetTextMapPropagator().Fields()
+	meta := header.Meta[:0]
+	for _, m := range header.Meta {
+		drop := false
+		for _, field := range fields {
+			if m.Key == field {
+				drop = true
+				break
+			}
+		}
+		if !drop {
+			meta = append(meta, m)
+		}
+	}
+	header.Meta = meta
+}
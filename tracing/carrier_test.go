@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/joeyscat/qim/wire"
+	"github.com/joeyscat/qim/wire/pkt"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInjectExtract(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01, 0x02, 0x03},
+		SpanID:     trace.SpanID{0x04, 0x05},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	packet := pkt.New(wire.CommandChatUserTalk)
+	packet.AddStringMeta(wire.MetaDestServer, "gate01")
+	Inject(ctx, &packet.Header)
+	// inject again should replace the old value
+	Inject(ctx, &packet.Header)
+	assert.Equal(t, 2, len(packet.Meta))
+
+	// the trace context survives the marshaling between services
+	packet2, err := pkt.MustReadLogicPkt(bytes.NewBuffer(pkt.Marshal(packet)))
+	assert.Nil(t, err)
+
+	got := trace.SpanContextFromContext(Extract(context.Background(), &packet2.Header))
+	assert.Equal(t, sc.TraceID(), got.TraceID())
+	assert.Equal(t, sc.SpanID(), got.SpanID())
+	assert.True(t, got.IsRemote())
+
+	Clean(&packet2.Header)
+	assert.Equal(t, 1, len(packet2.Meta))
+	server, _ := packet2.GetMeta(wire.MetaDestServer)
+	assert.Equal(t, "gate01", server)
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TracerName = "github.com/joeyscat/qim"
+
+const (
+	ExporterNone   = ""
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+type Settings struct {
+	ServiceName string
+	ServiceID   string
+	// Exporter option is stdout or otlp, tracing is disabled if it is empty
+	Exporter string
+	// Endpoint of the otlp grpc collector, such as localhost:4317
+	Endpoint    string
+	SampleRatio float64
+}
+
+// Init sets up the global tracer provider and the W3C trace context propagator.
+// The returned function flushes and stops the exporter.
+func Init(settings Settings) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch settings.Exporter {
+	case ExporterNone:
+		return func(ctx context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		exporter, err = otlptracegrpc.New(context.Background(),
+			otlptracegrpc.WithEndpoint(settings.Endpoint),
+			otlptracegrpc.WithInsecure())
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter: %s", settings.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.SampleRatio <= 0 || settings.SampleRatio > 1 {
+		settings.SampleRatio = 1
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(settings.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(settings.ServiceName),
+			semconv.ServiceInstanceID(settings.ServiceID),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
@@ -13,6 +13,12 @@ const (
 	CommandLoginSignIn  = "login.signin"
 	CommandLoginSignOut = "login.signout"
 
+	// gateway
+	CommandGatewayReconnect = "gateway.reconnect"
+
+	// inner, sent between the services
+	CommandInnerPing = "inner.ping"
+
 	// chat
 	CommandChatUserTalk  = "chat.user.talk"
 	CommandChatGroupTalk = "chat.group.talk"
@@ -36,6 +42,8 @@ const (
 	MetaDestServer = "dest.server"
 	// Channels the message will sent to
 	MetaDestChannels = "dest.channels"
+	// ServiceID of the caller of a request sent by container.Call
+	MetaCallFrom = "call.from"
 )
 
 // Protocol
@@ -132,16 +132,15 @@ func (p *LogicPkt) GetMeta(key string) (interface{}, bool) {
 	return FindMeta(p.Meta, key)
 }
 
+// DelMeta deletes all the metas of the key
 func (p *LogicPkt) DelMeta(key string) {
-	for i, m := range p.Meta {
-		if m.Key == key {
-			length := len(p.Meta)
-			if i < length-1 {
-				copy(p.Meta[i:], p.Meta[i+1:])
-			}
-			p.Meta = p.Meta[:length-1]
+	meta := p.Meta[:0]
+	for _, m := range p.Meta {
+		if m.Key != key {
+			meta = append(meta, m)
 		}
 	}
+	p.Meta = meta
 }
 
 func (h *Header) ServiceName() string {
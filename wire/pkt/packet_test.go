@@ -64,4 +64,12 @@ func TestReadPkt(t *testing.T) {
 	packet.DelMeta(wire.MetaDestChannels)
 	assert.Equal(t, 1, len(packet.Meta))
 
+	// the repeated metas are all deleted
+	packet.AddStringMeta(wire.MetaCallFrom, "test")
+	packet.AddStringMeta(wire.MetaCallFrom, "test")
+	packet.DelMeta(wire.MetaCallFrom)
+	_, ok = packet.GetMeta(wire.MetaCallFrom)
+	assert.False(t, ok)
+	assert.Equal(t, 1, len(packet.Meta))
+
 }
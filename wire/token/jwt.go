@@ -15,7 +15,9 @@ const (
 type Token struct {
 	Account string `json:"acc,omitempty"`
 	App     string `json:"app,omitempty"`
-	Exp     int64  `json:"exp,omitempty"`
+	// Device the token is issued for, such as ios, android or web
+	Device string `json:"dev,omitempty"`
+	Exp    int64  `json:"exp,omitempty"`
 }
 
 var errExpiredToken = errors.New("expired token")